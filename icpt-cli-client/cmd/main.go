@@ -2,12 +2,10 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
-	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -20,6 +18,7 @@ import (
 	"icpt-cli-client/internal/camera"
 	"icpt-cli-client/internal/compress"
 	"icpt-cli-client/internal/config"
+	"icpt-cli-client/internal/upload"
 
 	"golang.org/x/term"
 )
@@ -41,6 +40,11 @@ func main() {
 
 	authClient = auth.NewAuthClient(authConfig)
 
+	// 配置了API密钥时直接使用，服务器同样接受 Bearer 方式传递的API密钥
+	if config.Cfg.Auth.APIKey != "" {
+		authClient.SetToken(config.Cfg.Auth.APIKey)
+	}
+
 	// 检查命令行参数
 	if len(os.Args) < 2 {
 		showUsage()
@@ -180,6 +184,16 @@ func handleLogin() {
 		log.Fatalf("登录失败: %v", err)
 	}
 
+	// 开启了两步验证的账户需要再输入验证码
+	if authResp.TwoFactorRequired {
+		fmt.Print("两步验证码（或恢复码）: ")
+		code, _ := reader.ReadString('\n')
+		authResp, err = authClient.VerifyTwoFactor(authResp.ChallengeToken, strings.TrimSpace(code))
+		if err != nil {
+			log.Fatalf("两步验证失败: %v", err)
+		}
+	}
+
 	fmt.Printf("✅ 登录成功！欢迎回来 %s\n", authResp.User.Username)
 	fmt.Printf("Token: %s...\n", authResp.Token[:20])
 }
@@ -521,65 +535,21 @@ func uploadFileWithAuth(filePath string) (*UploadResponse, error) {
 		finalFilePath = filePath
 	}
 
-	// 检查最终文件是否存在
-	file, err := os.Open(finalFilePath)
-	if err != nil {
-		return nil, fmt.Errorf("无法打开文件 '%s': %w", finalFilePath, err)
-	}
-	defer file.Close()
-
-	// 创建multipart form数据
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-	part, err := writer.CreateFormFile("image", filepath.Base(filePath)) // 使用原始文件名
-	if err != nil {
-		return nil, fmt.Errorf("创建 form-data 失败: %w", err)
-	}
-
-	// 拷贝文件内容
-	if _, err = io.Copy(part, file); err != nil {
-		return nil, fmt.Errorf("拷贝文件数据失败: %w", err)
-	}
-	writer.Close()
-
-	// 创建HTTP请求
+	// 分片上传，网络中断后再次上传同一文件会从中断处继续
 	fmt.Printf("🚀 上传文件到服务器: %s\n", config.Cfg.Server.PublicHost)
-	uploadURL := config.Cfg.Server.PublicHost + "/api/v1/upload"
-	req, err := http.NewRequest("POST", uploadURL, body)
+	uploader := upload.NewUploader(config.Cfg.Server.PublicHost, authClient.GetToken(), true)
+	result, err := uploader.Upload(finalFilePath, filepath.Base(filePath)) // 使用原始文件名
 	if err != nil {
-		return nil, fmt.Errorf("创建 HTTP 请求失败: %w", err)
+		return nil, err
 	}
-
-	// 设置请求头
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Header.Set("Authorization", "Bearer "+authClient.GetToken())
-
-	// 发送请求
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("发送请求到 '%s' 失败: %w", uploadURL, err)
-	}
-	defer resp.Body.Close()
-
-	// 读取响应
-	responseBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("读取响应失败: %w", err)
-	}
-
-	// 检查HTTP状态码
-	if resp.StatusCode != http.StatusAccepted {
-		return nil, fmt.Errorf("服务器返回错误状态 %d: %s", resp.StatusCode, string(responseBody))
-	}
-
-	// 解析JSON响应
-	var uploadResp UploadResponse
-	if err := json.NewDecoder(bytes.NewReader(responseBody)).Decode(&uploadResp); err != nil {
-		return nil, fmt.Errorf("无法解析上传响应的JSON: %w", err)
+	if result.Data.Duplicate {
+		fmt.Println("ℹ️  图片已存在，无需重复处理")
 	}
 
-	return &uploadResp, nil
+	uploadResp := &UploadResponse{Message: result.Message}
+	uploadResp.Data.ImageID = result.Data.ImageID
+	uploadResp.Data.Status = result.Data.Status
+	return uploadResp, nil
 }
 
 // 检查文件是否为支持的图像格式
@@ -638,8 +608,6 @@ func pollStatus(imageID uint) {
 			fmt.Printf("\n✅ 成功! 图像处理完成。\n")
 			if statusResp.ThumbnailURL != "" {
 				fmt.Printf("缩略图访问地址: %s\n", statusResp.ThumbnailURL)
-			} else {
-				fmt.Printf("缩略图路径: %s\n", statusResp.ThumbnailPath)
 			}
 			return // 任务完成，退出
 		case "failed":
@@ -839,7 +807,6 @@ type ImageStatusResponse struct {
 	ID               uint   `json:"id"`
 	Status           string `json:"status"`
 	ThumbnailURL     string `json:"thumbnail_url"`
-	ThumbnailPath    string `json:"thumbnail_path"`
 	OriginalFilename string `json:"original_filename"`
 	CreatedAt        string `json:"created_at"`
 	ErrorInfo        string `json:"error_info"`
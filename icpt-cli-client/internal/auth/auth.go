@@ -35,9 +35,12 @@ type UserInfo struct {
 }
 
 // AuthResponse 认证响应
+// 开启两步验证的账户登录时只返回 TwoFactorRequired 和 ChallengeToken，需要调用 VerifyTwoFactor 完成登录
 type AuthResponse struct {
-	User  UserInfo `json:"user"`
-	Token string   `json:"token"`
+	User              UserInfo `json:"user"`
+	Token             string   `json:"token"`
+	TwoFactorRequired bool     `json:"two_factor_required"`
+	ChallengeToken    string   `json:"challenge_token"`
 }
 
 // APIResponse 通用API响应
@@ -90,6 +93,20 @@ func (ac *AuthClient) Login(username, password string) (*AuthResponse, error) {
 	return authResp, err
 }
 
+// VerifyTwoFactor 两步登录的第二步：提交验证码或恢复码
+func (ac *AuthClient) VerifyTwoFactor(challengeToken, code string) (*AuthResponse, error) {
+	reqData := map[string]string{
+		"challenge_token": challengeToken,
+		"code":            code,
+	}
+
+	authResp, err := ac.doAuthRequest("POST", "/api/v1/auth/2fa/verify", reqData)
+	if err == nil && authResp != nil {
+		ac.token = authResp.Token
+	}
+	return authResp, err
+}
+
 // GetProfile 获取用户信息
 func (ac *AuthClient) GetProfile() (*UserInfo, error) {
 	if ac.token == "" {
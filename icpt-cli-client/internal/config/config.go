@@ -12,6 +12,9 @@ type Config struct {
 	Server struct {
 		PublicHost string `yaml:"public_host"`
 	} `yaml:"server"`
+	Auth struct {
+		APIKey string `yaml:"api_key"` // 在服务器 /api/v1/tokens 创建的API密钥，设置后无需登录
+	} `yaml:"auth"`
 }
 
 // Cfg 是一个用于存储配置的全局变量
@@ -28,4 +31,9 @@ func LoadConfig(configPath string) {
 	if err != nil {
 		log.Fatalf("错误: 无法解析配置文件: %v", err)
 	}
+
+	// 环境变量优先，便于CI脚本注入密钥而不写入配置文件
+	if apiKey := os.Getenv("ICPT_API_KEY"); apiKey != "" {
+		Cfg.Auth.APIKey = apiKey
+	}
 }
@@ -122,11 +122,15 @@ func cloneRequest(req *http.Request) *http.Request {
 	reqClone := req.Clone(req.Context())
 
 	// 如果有Body，需要重新设置
-	if req.Body != nil {
-		// 注意：这里假设Body是可以重复读取的
-		// 对于文件上传等场景，调用方需要确保Body可以重置
-		reqClone.Body = req.Body
+	// http.NewRequest 对 bytes.Reader 等类型会设置 GetBody，每次重试都能得到完整的Body；
+	// 否则只能复用原Body，调用方需要确保Body可以重置
+	if req.Body != nil && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			reqClone.Body = body
+			return reqClone
+		}
 	}
+	reqClone.Body = req.Body
 
 	return reqClone
 }
@@ -0,0 +1,328 @@
+// Package upload 实现断点续传上传
+// 文件被切分为分片逐个上传，上传进度保存在服务器的上传会话中；
+// 本地按文件内容哈希记录会话ID，网络中断或程序退出后再次上传同一文件时从服务器已接收的位置继续
+package upload
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"icpt-cli-client/internal/httpclient"
+)
+
+// Result 上传结果
+type Result struct {
+	Message string `json:"message"`
+	Data    struct {
+		ImageID   uint   `json:"imageId"`
+		Status    string `json:"status"`
+		Duplicate bool   `json:"duplicate"`
+	} `json:"data"`
+}
+
+// session 服务器返回的上传会话信息
+type session struct {
+	UploadID  string `json:"upload_id"`
+	Size      int64  `json:"size"`
+	Offset    int64  `json:"offset"`
+	ChunkSize int64  `json:"chunk_size"`
+}
+
+// state 本地保存的上传状态
+type state struct {
+	Server   string `json:"server"`
+	UploadID string `json:"upload_id"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+}
+
+// errSessionGone 服务器上的会话已过期或被清理
+var errSessionGone = errors.New("上传会话不存在或已过期")
+
+// busyRetries 会话被其他请求占用时的最大等待次数
+const busyRetries = 5
+
+// Uploader 断点续传上传器
+type Uploader struct {
+	serverURL  string
+	token      string
+	httpClient *httpclient.RetryableHTTPClient
+	stateDir   string
+}
+
+// NewUploader 创建上传器，上传状态保存在 ~/.icpt/uploads
+func NewUploader(serverURL, token string, skipTLSVerify bool) *Uploader {
+	retryConfig := httpclient.DefaultRetryConfig()
+	retryConfig.MaxRetries = 5
+	retryConfig.Timeout = 2 * time.Minute // 单个分片可能较大
+
+	stateDir := filepath.Join(os.TempDir(), "icpt-uploads")
+	if home, err := os.UserHomeDir(); err == nil {
+		stateDir = filepath.Join(home, ".icpt", "uploads")
+	}
+
+	return &Uploader{
+		serverURL:  serverURL,
+		token:      token,
+		httpClient: httpclient.NewRetryableHTTPClient(retryConfig, skipTLSVerify),
+		stateDir:   stateDir,
+	}
+}
+
+// Upload 上传文件，filename 为服务器上显示的文件名
+// 上传失败时保留本地状态，再次上传同一文件会从中断处继续
+func (u *Uploader) Upload(filePath, filename string) (*Result, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("无法打开文件 '%s': %w", filePath, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("获取文件信息失败: %w", err)
+	}
+	hash, err := fileHash(file)
+	if err != nil {
+		return nil, fmt.Errorf("计算文件哈希失败: %w", err)
+	}
+	statePath := filepath.Join(u.stateDir, hash+".json")
+
+	sess, err := u.resume(statePath, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	if sess == nil {
+		if sess, err = u.create(filename, info.Size()); err != nil {
+			return nil, err
+		}
+		u.saveState(statePath, &state{Server: u.serverURL, UploadID: sess.UploadID, Filename: filename, Size: info.Size()})
+	} else if sess.Offset > 0 {
+		fmt.Printf("⏯️  继续上次中断的上传: 已完成 %d/%d 字节\n", sess.Offset, sess.Size)
+	}
+
+	err = u.sendChunks(file, sess)
+	if errors.Is(err, errSessionGone) {
+		// 会话在上传过程中过期，重新开始
+		fmt.Println("⚠️  上传会话已过期，重新上传")
+		if sess, err = u.create(filename, info.Size()); err != nil {
+			return nil, err
+		}
+		u.saveState(statePath, &state{Server: u.serverURL, UploadID: sess.UploadID, Filename: filename, Size: info.Size()})
+		err = u.sendChunks(file, sess)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w（再次上传同一文件将从中断处继续）", err)
+	}
+
+	result, err := u.finalize(sess.UploadID)
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(statePath)
+	return result, nil
+}
+
+// resume 读取本地保存的会话并向服务器查询已接收的字节数，没有可继续的会话时返回 nil
+func (u *Uploader) resume(statePath string, size int64) (*session, error) {
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		return nil, nil
+	}
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil || st.Server != u.serverURL || st.Size != size {
+		os.Remove(statePath)
+		return nil, nil
+	}
+
+	req, err := u.newRequest(http.MethodGet, "/api/v1/uploads/"+st.UploadID, nil)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Data session `json:"data"`
+	}
+	status, body, err := u.doJSON(req, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("查询上传进度失败: %w", err)
+	}
+
+	switch status {
+	case http.StatusOK:
+		return &resp.Data, nil
+	case http.StatusNotFound:
+		os.Remove(statePath)
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("查询上传进度失败，服务器返回 %d: %s", status, body)
+	}
+}
+
+// create 在服务器上创建上传会话
+func (u *Uploader) create(filename string, size int64) (*session, error) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"filename": filename,
+		"size":     size,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := u.newRequest(http.MethodPost, "/api/v1/uploads", payload)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp struct {
+		Data session `json:"data"`
+	}
+	status, body, err := u.doJSON(req, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("创建上传会话失败: %w", err)
+	}
+	if status != http.StatusCreated {
+		return nil, fmt.Errorf("创建上传会话失败，服务器返回 %d: %s", status, body)
+	}
+	return &resp.Data, nil
+}
+
+// sendChunks 从 sess.Offset 开始逐个上传分片
+func (u *Uploader) sendChunks(file *os.File, sess *session) error {
+	busy := 0
+	for sess.Offset < sess.Size {
+		chunkSize := sess.ChunkSize
+		if chunkSize <= 0 {
+			chunkSize = 5 * 1024 * 1024
+		}
+		if remaining := sess.Size - sess.Offset; chunkSize > remaining {
+			chunkSize = remaining
+		}
+		chunk := make([]byte, chunkSize)
+		if _, err := file.ReadAt(chunk, sess.Offset); err != nil && err != io.EOF {
+			return fmt.Errorf("读取文件失败: %w", err)
+		}
+
+		req, err := u.newRequest(http.MethodPut, "/api/v1/uploads/"+sess.UploadID, chunk)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/offset+octet-stream")
+		req.Header.Set("Upload-Offset", strconv.FormatInt(sess.Offset, 10))
+
+		var resp struct {
+			Code   string  `json:"code"`
+			Offset int64   `json:"offset"`
+			Data   session `json:"data"`
+		}
+		status, body, err := u.doJSON(req, &resp)
+		if err != nil {
+			return fmt.Errorf("上传分片失败: %w", err)
+		}
+
+		switch {
+		case status == http.StatusOK:
+			sess.Offset = resp.Data.Offset
+			if resp.Data.ChunkSize > 0 {
+				sess.ChunkSize = resp.Data.ChunkSize
+			}
+			busy = 0
+			fmt.Printf("📦 已上传 %d/%d 字节 (%.1f%%)\n", sess.Offset, sess.Size, float64(sess.Offset)/float64(sess.Size)*100)
+		case status == http.StatusConflict && resp.Code == "OFFSET_MISMATCH":
+			// 上一个分片服务器已收到但响应丢失，以服务器的进度为准
+			sess.Offset = resp.Offset
+		case status == http.StatusConflict && resp.Code == "UPLOAD_BUSY" && busy < busyRetries:
+			busy++
+			time.Sleep(time.Duration(busy) * time.Second)
+		case status == http.StatusNotFound:
+			return errSessionGone
+		default:
+			return fmt.Errorf("上传分片失败，服务器返回 %d: %s", status, body)
+		}
+	}
+	return nil
+}
+
+// finalize 通知服务器合并分片并开始处理
+func (u *Uploader) finalize(uploadID string) (*Result, error) {
+	req, err := u.newRequest(http.MethodPost, "/api/v1/uploads/"+uploadID+"/finalize", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result Result
+	status, body, err := u.doJSON(req, &result)
+	if err != nil {
+		return nil, fmt.Errorf("完成上传失败: %w", err)
+	}
+	if status != http.StatusOK && status != http.StatusAccepted {
+		return nil, fmt.Errorf("完成上传失败，服务器返回 %d: %s", status, body)
+	}
+	return &result, nil
+}
+
+// newRequest 创建带认证头的请求，body 使用 bytes.Reader 以便重试时重新发送
+func (u *Uploader) newRequest(method, path string, body []byte) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, u.serverURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("创建 HTTP 请求失败: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+u.token)
+	return req, nil
+}
+
+// doJSON 发送请求并解析JSON响应，返回状态码和原始响应体
+func (u *Uploader) doJSON(req *http.Request, v interface{}) (int, string, error) {
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, "", fmt.Errorf("读取响应失败: %w", err)
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, v); err != nil && resp.StatusCode < 300 {
+			return resp.StatusCode, string(body), fmt.Errorf("解析响应失败: %w", err)
+		}
+	}
+	return resp.StatusCode, string(body), nil
+}
+
+// saveState 保存上传状态，失败时只是无法断点续传，不影响本次上传
+func (u *Uploader) saveState(statePath string, st *state) {
+	data, err := json.Marshal(st)
+	if err == nil {
+		err = os.MkdirAll(u.stateDir, 0700)
+	}
+	if err == nil {
+		err = os.WriteFile(statePath, data, 0600)
+	}
+	if err != nil {
+		fmt.Printf("⚠️  无法保存上传进度，中断后将无法续传: %v\n", err)
+	}
+}
+
+// fileHash 计算文件内容的SHA-256
+func fileHash(file *os.File) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(file, 0, 1<<62)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -30,7 +30,6 @@ type StatusResponse struct {
 	Data struct {
 		ID               uint   `json:"id"`
 		Status           string `json:"status"`
-		ThumbnailPath    string `json:"thumbnail_path"`
 		ThumbnailURL     string `json:"thumbnail_url"`
 		ErrorInfo        string `json:"error_info"`
 		OriginalFilename string `json:"original_filename"`
@@ -79,8 +78,6 @@ func main() {
 			// 使用服务器返回的完整URL
 			if statusResp.Data.ThumbnailURL != "" {
 				log.Printf("缩略图访问地址: %s", statusResp.Data.ThumbnailURL)
-			} else {
-				log.Printf("缩略图路径: %s", statusResp.Data.ThumbnailPath)
 			}
 			return // 任务完成，退出程序
 		case "failed":
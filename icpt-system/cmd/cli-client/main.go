@@ -28,7 +28,7 @@ type StatusResponse struct {
 	Data struct {
 		ID            uint   `json:"ID"`
 		Status        string `json:"Status"`
-		ThumbnailPath string `json:"ThumbnailPath"`
+		ThumbnailURL  string `json:"thumbnail_url"`
 		ErrorInfo     string `json:"ErrorInfo"`
 	} `json:"data"`
 }
@@ -73,9 +73,8 @@ func main() {
 			fmt.Printf(".") // 打印一个点表示仍在处理中
 		case "completed":
 			log.Printf("\n成功! 图像处理完成。")
-			// 构造可公开访问的 URL
-			fullURL := serverBaseURL + "/static/" + statusResp.Data.ThumbnailPath
-			log.Printf("缩略图访问地址: %s", fullURL)
+			// 服务器返回带签名的限时访问地址
+			log.Printf("缩略图访问地址: %s", statusResp.Data.ThumbnailURL)
 			return // 任务完成，退出程序
 		case "failed":
 			log.Printf("\n失败! 图像处理失败。")
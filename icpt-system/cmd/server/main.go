@@ -9,7 +9,12 @@ import (
 	"encoding/pem"
 	"icpt-system/internal/api" // <-- 导入 api 包
 	"icpt-system/internal/config"
+	"icpt-system/internal/mailer"
 	"icpt-system/internal/middleware"
+	"icpt-system/internal/models"
+	"icpt-system/internal/queue"
+	"icpt-system/internal/services"
+	"icpt-system/internal/storage"
 	"icpt-system/internal/store"
 	"icpt-system/internal/websocket"
 	"log"
@@ -26,19 +31,27 @@ import (
 )
 
 func main() {
-	// 确保上传目录存在
-	os.MkdirAll("uploads/originals", os.ModePerm)
-	os.MkdirAll("uploads/thumbnails", os.ModePerm)
-
 	// 1. 加载配置
 	config.LoadConfig("config.yaml")
 
+	// 初始化文件存储：本地目录或S3兼容存储，由 storage.driver 配置
+	storage.InitStorage()
+
 	// 2. 初始化数据库和Redis连接
 	store.InitDB()
 	store.InitRedis()
+	queue.InitTaskQueue(store.Rdb)
 
-	// 3. 初始化WebSocket Hub
+	// 3. 初始化WebSocket Hub，并订阅Redis通知频道以接收Worker等其他进程发布的事件
 	websocket.InitHub()
+	websocket.GlobalHub.SubscribeRedis(store.Ctx, store.Rdb)
+	websocket.InitPublisher(store.Rdb)
+
+	// 初始化邮件发送（找回密码）
+	mailer.InitMailer()
+
+	// 定期清理过期的分片上传会话及其分片
+	go services.RunUploadCleanup(store.Ctx, 0)
 
 	// 4. 初始化 Gin 引擎
 	r := gin.Default()
@@ -81,9 +94,12 @@ func main() {
 		AllowHeaders: []string{
 			"Origin", "Content-Length", "Content-Type", "Authorization",
 			"Accept", "X-Requested-With", "Cache-Control",
+			"X-API-Key", // API密钥认证
 		},
 		ExposeHeaders: []string{
 			"Content-Length", "Content-Type",
+			// 限流状态，浏览器端需要读取后决定何时重试
+			"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After",
 		},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
@@ -96,15 +112,10 @@ func main() {
 		log.Println("✅ 启用Gzip压缩")
 	}
 
-	// 添加限流中间件
-	if config.Cfg.Performance.EnableConcurrency {
-		r.Use(middleware.ConcurrencyLimitMiddleware(config.Cfg.Performance.MaxConcurrentUploads))
-		log.Printf("✅ 启用并发限制: %d", config.Cfg.Performance.MaxConcurrentUploads)
-	}
-
-	// 新增：配置静态文件服务
-	// 将 URL /static/ 映射到本地的 ./uploads 目录
-	r.Static("/static", "./uploads") // 静态文件服务
+	// 图片文件服务：只允许带有效签名的URL或图片所有者访问，不再公开整个上传目录
+	// 原图在任何存储下都通过 /static 返回以便去除元数据；S3存储的缩略图签名URL直接指向存储服务
+	r.GET("/static/*filepath", middleware.OptionalAuthMiddleware(), api.ServeStaticFileHandler)
+	r.HEAD("/static/*filepath", middleware.OptionalAuthMiddleware(), api.ServeStaticFileHandler)
 
 	// 配置Web前端静态文件服务
 	r.Static("/web", "./web")
@@ -121,39 +132,127 @@ func main() {
 	v1 := r.Group("/api/v1")
 	{
 		// 公开接口（无需认证）
+		// 按路由组限流，限额见 config.yaml 的 rate_limit
+		authLimit := middleware.RateLimitMiddleware("auth", config.Cfg.RateLimit.Auth)
+		uploadLimit := middleware.RateLimitMiddleware("upload", config.Cfg.RateLimit.Upload)
+		listLimit := middleware.RateLimitMiddleware("list", config.Cfg.RateLimit.List)
+
+		// 上传接口的并发限制只作用于本实例，防止大量上传同时占用内存和磁盘
+		uploadConcurrency := func(c *gin.Context) { c.Next() }
+		if config.Cfg.Performance.EnableConcurrency {
+			uploadConcurrency = middleware.ConcurrencyLimitMiddleware(config.Cfg.Performance.MaxConcurrentUploads)
+			log.Printf("✅ 启用上传并发限制: %d", config.Cfg.Performance.MaxConcurrentUploads)
+		}
+
 		auth := v1.Group("/auth")
 		{
-			auth.POST("/register", api.RegisterHandler)
-			auth.POST("/login", api.LoginHandler)
+			auth.POST("/register", authLimit, api.RegisterHandler)
+			auth.POST("/login", authLimit, api.LoginHandler)
+			auth.POST("/2fa/verify", authLimit, api.VerifyTwoFactorHandler)
+			auth.POST("/refresh", authLimit, api.RefreshTokenHandler)
+			auth.POST("/forgot-password", authLimit, api.ForgotPasswordHandler)
+			auth.POST("/reset-password", authLimit, api.ResetPasswordHandler)
+
+			// 用户名/邮箱可用性检查，两个接口共用同一个按IP的限额
+			availabilityLimit := middleware.RateLimitMiddleware("availability", config.Cfg.RateLimit.Availability)
+			auth.GET("/check-username", availabilityLimit, api.CheckUsernameHandler)
+			auth.GET("/check-email", availabilityLimit, api.CheckEmailHandler)
 		}
 
-		// 需要认证的接口
+		// 需要认证的接口，同时接受JWT和API密钥；API密钥只能访问其权限范围内的接口
 		protected := v1.Group("")
 		protected.Use(middleware.AuthMiddleware())
 		{
+			readScope := middleware.RequireScope(models.ScopeRead)
+			uploadScope := middleware.RequireScope(models.ScopeUpload)
+			deleteScope := middleware.RequireScope(models.ScopeDelete)
+
 			// 用户相关
-			protected.GET("/profile", api.GetProfileHandler)
+			protected.GET("/profile", readScope, listLimit, api.GetProfileHandler)
 
 			// 图像上传和管理
-			protected.POST("/upload", api.UploadImageHandler)
-			protected.GET("/images/:id", api.GetImageStatusHandler)
-			protected.GET("/images", api.GetUserImagesHandler)
-			protected.DELETE("/images/:id", api.DeleteImageHandler)
-			protected.POST("/images/batch-delete", api.BatchDeleteImagesHandler)
+			protected.POST("/upload", uploadScope, uploadLimit, uploadConcurrency, api.UploadImageHandler)
+
+			// 分片上传（断点续传），每个文件在创建会话时计入上传限额
+			uploads := protected.Group("/uploads", uploadScope, uploadConcurrency)
+			uploads.POST("", uploadLimit, api.CreateUploadHandler)
+			uploads.HEAD("/:id", api.GetUploadOffsetHandler)
+			uploads.GET("/:id", api.GetUploadOffsetHandler)
+			uploads.PUT("/:id", api.UploadChunkHandler)
+			uploads.POST("/:id/finalize", api.FinalizeUploadHandler)
+			uploads.DELETE("/:id", api.CancelUploadHandler)
+
+			protected.GET("/images/:id", readScope, listLimit, api.GetImageStatusHandler)
+			protected.GET("/images/:id/renditions", readScope, listLimit, api.GetImageRenditionsHandler)
+			protected.GET("/images/:id/renditions/:size", readScope, listLimit, api.ServeImageRenditionHandler)
+			protected.GET("/images/:id/render", readScope, listLimit, api.RenderImageHandler)
+			protected.GET("/images", readScope, listLimit, api.GetUserImagesHandler)
+			protected.DELETE("/images/:id", deleteScope, api.DeleteImageHandler)
+			protected.POST("/images/batch-delete", deleteScope, api.BatchDeleteImagesHandler)
 
 			// 统计信息相关
-			protected.GET("/stats/dashboard", api.GetDashboardStats(store.DB))
-			protected.GET("/activity/recent", api.GetRecentActivity(store.DB))
-			protected.GET("/stats/status-count", api.GetImageStatusCount(store.DB))
+			protected.GET("/stats/dashboard", readScope, listLimit, api.GetDashboardStats(store.DB))
+			protected.GET("/activity/recent", readScope, listLimit, api.GetRecentActivity(store.DB))
+			protected.GET("/stats/status-count", readScope, listLimit, api.GetImageStatusCount(store.DB))
 
 			// WebSocket相关
-			protected.GET("/ws", api.WebSocketHandler)
-			protected.GET("/ws/stats", api.WebSocketStatsHandler)
-			protected.POST("/notify/:userID", api.NotifyTestHandler) // 测试用
+			protected.GET("/ws", readScope, api.WebSocketHandler)
+			protected.GET("/ws/stats", readScope, api.WebSocketStatsHandler)
 		}
 
-		// 测试接口（保留用于性能测试）
-		v1.POST("/upload-sync", api.UploadImageSyncHandlerForTest)
+		// 账户设置和API密钥管理，只允许登录会话访问
+		session := v1.Group("")
+		session.Use(middleware.AuthMiddleware(), middleware.RequireSession())
+		{
+			session.POST("/auth/logout", api.LogoutHandler)
+			session.POST("/auth/change-password", authLimit, api.ChangePasswordHandler)
+			session.PUT("/profile/upload-settings", api.UpdateUploadSettingsHandler)
+
+			// 两步验证
+			session.POST("/auth/2fa/setup", api.SetupTwoFactorHandler)
+			session.POST("/auth/2fa/enable", authLimit, api.EnableTwoFactorHandler)
+			session.POST("/auth/2fa/disable", authLimit, api.DisableTwoFactorHandler)
+			session.POST("/auth/2fa/recovery-codes", authLimit, api.RegenerateRecoveryCodesHandler)
+
+			session.GET("/tokens", api.ListAPIKeysHandler)
+			session.POST("/tokens", api.CreateAPIKeyHandler)
+			session.DELETE("/tokens/:id", api.RevokeAPIKeyHandler)
+		}
+
+		// 管理接口（需要管理员权限）
+		admin := v1.Group("/admin")
+		admin.Use(middleware.AuthMiddleware(), middleware.RequireSession(), middleware.RequireRole(models.RoleAdmin))
+		{
+			// 用户管理
+			admin.GET("/users", api.ListUsersHandler)
+			admin.GET("/users/:id", api.GetUserHandler)
+			admin.PUT("/users/:id/status", api.UpdateUserStatusHandler)
+			admin.PUT("/users/:id/role", api.UpdateUserRoleHandler)
+			admin.DELETE("/users/:id/2fa", api.ResetUserTwoFactorHandler)
+			admin.GET("/users/:id/images", api.ListUserImagesHandler)
+
+			// 全站统计
+			admin.GET("/stats", api.GetSystemStatsHandler)
+
+			// 死信队列管理
+			admin.GET("/dead-letters", api.ListDeadLettersHandler)
+			admin.GET("/dead-letters/:id", api.GetDeadLetterHandler)
+			admin.POST("/dead-letters/:id/requeue", api.RequeueDeadLetterHandler)
+			admin.DELETE("/dead-letters/:id", api.PurgeDeadLetterHandler)
+			admin.DELETE("/dead-letters", api.PurgeAllDeadLettersHandler)
+
+			// Worker运行状态
+			admin.GET("/stats/workers", api.GetWorkerStats)
+
+			// 用户配额
+			admin.GET("/users/:id/quota", api.GetUserQuotaHandler)
+			admin.PUT("/users/:id/quota", api.UpdateUserQuotaHandler)
+			admin.POST("/users/:id/quota/recalculate", api.RecalculateUserQuotaHandler)
+
+			// 测试接口（开发和性能测试用）
+			admin.POST("/notify/:userID", api.NotifyTestHandler)
+			admin.POST("/upload-sync", api.UploadImageSyncHandlerForTest)
+		}
 	}
 
 	// 6. 启动服务器（支持HTTP和HTTPS）
@@ -0,0 +1,297 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"icpt-system/internal/models"
+	"icpt-system/internal/queue"
+	"icpt-system/internal/services"
+	"icpt-system/internal/store"
+	"icpt-system/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SystemStats 全站统计数据
+type SystemStats struct {
+	TotalUsers     int64            `json:"total_users"`
+	UsersByStatus  map[string]int64 `json:"users_by_status"`
+	UsersByRole    map[string]int64 `json:"users_by_role"`
+	TotalImages    int64            `json:"total_images"`
+	ImagesByStatus map[string]int64 `json:"images_by_status"`
+	TodayUploads   int64            `json:"today_uploads"`
+	StorageUsed    int64            `json:"storage_used"`    // 所有用户原图和衍生图占用的字节数
+	QueueLength    int64            `json:"queue_length"`    // 等待处理的任务数
+	DelayedTasks   int64            `json:"delayed_tasks"`   // 等待重试的任务数
+	WebSocketUsers int              `json:"websocket_users"` // 当前实例上已连接的用户数
+}
+
+// loadAdminTargetUser 按路径中的ID加载用户，失败时直接写入错误响应并返回 false
+func loadAdminTargetUser(c *gin.Context) (*models.User, bool) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	var user models.User
+	if err := store.DB.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "用户未找到",
+				"code":  "USER_NOT_FOUND",
+			})
+			return nil, false
+		}
+		log.Printf("查询用户 %d 错误: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "DATABASE_ERROR",
+		})
+		return nil, false
+	}
+	return &user, true
+}
+
+// rejectSelfModification 管理员不能修改自己的状态或角色，避免误操作后没有可用的管理员
+func rejectSelfModification(c *gin.Context, user *models.User) bool {
+	if user.ID != c.GetUint("user_id") {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": "不能修改自己的状态或角色",
+		"code":  "CANNOT_MODIFY_SELF",
+	})
+	return true
+}
+
+// ListUsersHandler 分页列出用户，支持按用户名/邮箱搜索和按状态、角色过滤
+func ListUsersHandler(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	query := store.DB.Model(&models.User{})
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		// 转义LIKE通配符，搜索词按字面匹配
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(q) + "%"
+		query = query.Where("username LIKE ? OR email LIKE ?", pattern, pattern)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("查询用户总数错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "查询失败",
+			"code":  "DATABASE_ERROR",
+		})
+		return
+	}
+
+	var users []models.User
+	if err := query.Offset((page - 1) * pageSize).Limit(pageSize).Order("id ASC").Find(&users).Error; err != nil {
+		log.Printf("查询用户列表错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "查询失败",
+			"code":  "DATABASE_ERROR",
+		})
+		return
+	}
+
+	data := make([]ProfileResponse, len(users))
+	for i := range users {
+		data[i] = ProfileResponse{User: users[i], Quota: services.Quota(&users[i])}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "查询成功",
+		"data":        data,
+		"total":       total,
+		"page":        page,
+		"page_size":   pageSize,
+		"total_pages": int((total + int64(pageSize) - 1) / int64(pageSize)),
+	})
+}
+
+// GetUserHandler 查看单个用户的信息和配额用量
+func GetUserHandler(c *gin.Context) {
+	user, ok := loadAdminTargetUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "查询成功",
+		"data":    ProfileResponse{User: *user, Quota: services.Quota(user)},
+	})
+}
+
+// UpdateUserStatusHandler 修改用户状态（启用、停用、封禁）
+// 状态不再是 active 时，用户的全部会话立即失效
+func UpdateUserStatusHandler(c *gin.Context) {
+	user, ok := loadAdminTargetUser(c)
+	if !ok || rejectSelfModification(c, user) {
+		return
+	}
+
+	var req models.UserStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求数据格式错误",
+			"code":    "INVALID_REQUEST",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if err := store.DB.Model(user).Update("status", req.Status).Error; err != nil {
+		log.Printf("更新用户 %d 状态错误: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "DATABASE_ERROR",
+		})
+		return
+	}
+
+	if req.Status != models.StatusActive {
+		if err := services.RevokeUserSessions(c.Request.Context(), user.ID); err != nil {
+			log.Printf("作废用户 %d 会话错误: %v", user.ID, err)
+		}
+	}
+
+	log.Printf("管理员 %s 将用户 %s (ID: %d) 的状态设为 %s", c.GetString("username"), user.Username, user.ID, req.Status)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "用户状态已更新",
+		"data":    ProfileResponse{User: *user, Quota: services.Quota(user)},
+	})
+}
+
+// UpdateUserRoleHandler 修改用户角色
+// 角色保存在访问令牌中，修改后用户的全部会话失效，重新登录后生效
+func UpdateUserRoleHandler(c *gin.Context) {
+	user, ok := loadAdminTargetUser(c)
+	if !ok || rejectSelfModification(c, user) {
+		return
+	}
+
+	var req models.UserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求数据格式错误",
+			"code":    "INVALID_REQUEST",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if user.Role != req.Role {
+		if err := store.DB.Model(user).Update("role", req.Role).Error; err != nil {
+			log.Printf("更新用户 %d 角色错误: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "服务器内部错误",
+				"code":  "DATABASE_ERROR",
+			})
+			return
+		}
+		if err := services.RevokeUserSessions(c.Request.Context(), user.ID); err != nil {
+			log.Printf("作废用户 %d 会话错误: %v", user.ID, err)
+		}
+		log.Printf("管理员 %s 将用户 %s (ID: %d) 的角色设为 %s", c.GetString("username"), user.Username, user.ID, req.Role)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "用户角色已更新",
+		"data":    ProfileResponse{User: *user, Quota: services.Quota(user)},
+	})
+}
+
+// ListUserImagesHandler 查看任意用户的图像列表，参数与 GET /images 相同
+func ListUserImagesHandler(c *gin.Context) {
+	user, ok := loadAdminTargetUser(c)
+	if !ok {
+		return
+	}
+	respondImageList(c, user.ID)
+}
+
+// countBy 按列分组计数
+func countBy(model interface{}, column string) (map[string]int64, error) {
+	var rows []struct {
+		Key   string
+		Count int64
+	}
+	err := store.DB.Model(model).Select(column + " AS `key`, COUNT(*) AS count").Group(column).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Key] = row.Count
+	}
+	return counts, nil
+}
+
+// GetSystemStatsHandler 全站统计：用户、图像、存储用量和任务队列
+func GetSystemStatsHandler(c *gin.Context) {
+	var stats SystemStats
+	var err error
+
+	if stats.UsersByStatus, err = countBy(&models.User{}, "status"); err == nil {
+		stats.UsersByRole, err = countBy(&models.User{}, "role")
+	}
+	if err == nil {
+		stats.ImagesByStatus, err = countBy(&models.Image{}, "status")
+	}
+	if err == nil {
+		err = store.DB.Model(&models.User{}).Select("COALESCE(SUM(storage_used), 0)").Scan(&stats.StorageUsed).Error
+	}
+	if err == nil {
+		todayStart := time.Now().Truncate(24 * time.Hour)
+		err = store.DB.Model(&models.Image{}).Where("created_at >= ?", todayStart).Count(&stats.TodayUploads).Error
+	}
+	if err != nil {
+		log.Printf("查询全站统计错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "查询失败",
+			"code":  "DATABASE_ERROR",
+		})
+		return
+	}
+
+	for _, n := range stats.UsersByStatus {
+		stats.TotalUsers += n
+	}
+	for _, n := range stats.ImagesByStatus {
+		stats.TotalImages += n
+	}
+
+	// 队列长度查询失败时只记录日志，数据库统计仍然返回
+	if stats.QueueLength, err = queue.TaskQueue.Len(c.Request.Context()); err != nil {
+		log.Printf("查询任务队列长度错误: %v", err)
+	}
+	if stats.DelayedTasks, err = queue.TaskQueue.DelayedLen(c.Request.Context()); err != nil {
+		log.Printf("查询延迟任务数错误: %v", err)
+	}
+	stats.WebSocketUsers = websocket.GlobalHub.GetConnectionCount()["authenticated_users"]
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "获取全站统计成功",
+		"data":    stats,
+	})
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"icpt-system/internal/models"
+	"icpt-system/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyResponse 组装API密钥的响应，raw 只在创建时传入
+func apiKeyResponse(key *models.APIKey, raw string) models.APIKeyResponse {
+	return models.APIKeyResponse{APIKey: key, Scopes: key.ScopeList(), Key: raw}
+}
+
+// ListAPIKeysHandler 列出当前用户的API密钥
+// @Summary 列出API密钥
+// @Description 列出当前用户未撤销的API密钥，不包含密钥原文
+// @Tags tokens
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "查询成功"
+// @Failure 401 {object} map[string]interface{} "未认证"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /api/v1/tokens [get]
+func ListAPIKeysHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	keys, err := services.ListAPIKeys(userID)
+	if err != nil {
+		log.Printf("查询API密钥错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "查询失败",
+			"code":  "DATABASE_ERROR",
+		})
+		return
+	}
+
+	data := make([]models.APIKeyResponse, len(keys))
+	for i := range keys {
+		data[i] = apiKeyResponse(&keys[i], "")
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "查询成功",
+		"data":    data,
+	})
+}
+
+// CreateAPIKeyHandler 创建API密钥
+// @Summary 创建API密钥
+// @Description 创建带权限范围和可选有效期的API密钥，密钥原文只在响应中返回一次
+// @Tags tokens
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateAPIKeyRequest true "名称、权限范围和有效天数"
+// @Success 201 {object} models.APIKeyResponse "创建成功"
+// @Failure 400 {object} map[string]interface{} "请求数据错误"
+// @Failure 401 {object} map[string]interface{} "未认证"
+// @Failure 409 {object} map[string]interface{} "密钥数量已达上限"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /api/v1/tokens [post]
+func CreateAPIKeyHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求数据格式错误",
+			"code":    "INVALID_REQUEST",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	raw, key, err := services.CreateAPIKey(userID, &req)
+	if err != nil {
+		if errors.Is(err, services.ErrAPIKeyLimitExceeded) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+				"code":  "API_KEY_LIMIT_EXCEEDED",
+			})
+			return
+		}
+		log.Printf("创建API密钥错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "DATABASE_ERROR",
+		})
+		return
+	}
+
+	log.Printf("用户 %s (ID: %d) 创建API密钥 %s (ID: %d)", c.GetString("username"), userID, key.Name, key.ID)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "API密钥已创建，请立即保存，之后无法再次查看",
+		"data":    apiKeyResponse(key, raw),
+	})
+}
+
+// RevokeAPIKeyHandler 撤销API密钥
+// @Summary 撤销API密钥
+// @Description 撤销当前用户的API密钥，使用该密钥的请求立即失效
+// @Tags tokens
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "密钥ID"
+// @Success 200 {object} map[string]interface{} "撤销成功"
+// @Failure 400 {object} map[string]interface{} "无效的密钥ID"
+// @Failure 401 {object} map[string]interface{} "未认证"
+// @Failure 404 {object} map[string]interface{} "密钥不存在"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /api/v1/tokens/{id} [delete]
+func RevokeAPIKeyHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	keyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的密钥ID",
+			"code":  "INVALID_API_KEY_ID",
+		})
+		return
+	}
+
+	if err := services.RevokeAPIKey(userID, uint(keyID)); err != nil {
+		if errors.Is(err, services.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": err.Error(),
+				"code":  "API_KEY_NOT_FOUND",
+			})
+			return
+		}
+		log.Printf("撤销API密钥错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "DATABASE_ERROR",
+		})
+		return
+	}
+
+	log.Printf("用户 %s (ID: %d) 撤销API密钥 %d", c.GetString("username"), userID, keyID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API密钥已撤销",
+	})
+}
@@ -3,8 +3,11 @@
 package api
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"icpt-system/internal/models"
 	"icpt-system/internal/services"
@@ -16,14 +19,14 @@ import (
 
 // RegisterHandler 处理用户注册请求
 // @Summary 用户注册
-// @Description 创建新用户账户，返回JWT令牌
+// @Description 创建新用户账户，返回访问令牌和刷新令牌
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param request body models.RegisterRequest true "注册信息"
 // @Success 201 {object} models.AuthResponse "注册成功"
 // @Failure 400 {object} map[string]interface{} "请求数据错误"
-// @Failure 409 {object} map[string]interface{} "用户已存在"
+// @Failure 409 {object} map[string]interface{} "用户名或邮箱已存在（USERNAME_EXISTS / EMAIL_EXISTS）"
 // @Failure 500 {object} map[string]interface{} "服务器内部错误"
 // @Router /api/v1/auth/register [post]
 func RegisterHandler(c *gin.Context) {
@@ -39,32 +42,38 @@ func RegisterHandler(c *gin.Context) {
 		return
 	}
 
-	// 检查用户名或邮箱是否已被使用
-	var existingUser models.User
-	result := store.DB.Where("username = ? OR email = ?", req.Username, req.Email).First(&existingUser)
-	if result.Error != gorm.ErrRecordNotFound {
-		if result.Error == nil {
-			// 用户已存在，返回冲突错误
+	// 分别检查用户名和邮箱是否已被使用，返回具体冲突的字段
+	for _, check := range []struct {
+		field, value, message, code string
+	}{
+		{"username", req.Username, "用户名已存在", "USERNAME_EXISTS"},
+		{"email", req.Email, "邮箱已被注册", "EMAIL_EXISTS"},
+	} {
+		taken, err := isTaken(check.field, check.value)
+		if err != nil {
+			log.Printf("数据库查询错误: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "服务器内部错误",
+				"code":  "DATABASE_ERROR",
+			})
+			return
+		}
+		if taken {
 			c.JSON(http.StatusConflict, gin.H{
-				"error": "用户名或邮箱已存在",
-				"code":  "USER_EXISTS",
+				"error": check.message,
+				"code":  check.code,
+				"field": check.field,
 			})
 			return
 		}
-		// 数据库查询错误
-		log.Printf("数据库查询错误: %v", result.Error)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "服务器内部错误",
-			"code":  "DATABASE_ERROR",
-		})
-		return
 	}
 
 	// 创建新用户实例
 	user := models.User{
 		Username: req.Username,
 		Email:    req.Email,
-		Status:   "active", // 新用户默认为活跃状态
+		Status:   models.StatusActive, // 新用户默认为活跃状态
+		Role:     models.RoleUser,
 	}
 
 	// 对密码进行安全哈希处理
@@ -87,8 +96,8 @@ func RegisterHandler(c *gin.Context) {
 		return
 	}
 
-	// 生成JWT认证令牌
-	token, err := services.GenerateToken(user.ID, user.Username)
+	// 生成访问令牌和刷新令牌
+	response, err := services.IssueTokens(&user)
 	if err != nil {
 		log.Printf("生成令牌错误: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -101,21 +110,105 @@ func RegisterHandler(c *gin.Context) {
 	// 记录成功注册日志
 	log.Printf("用户注册成功: %s (ID: %d)", user.Username, user.ID)
 
-	// 构造并返回成功响应
-	response := models.AuthResponse{
-		User:  &user,
-		Token: token,
-	}
-
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "注册成功",
 		"data":    response,
 	})
 }
 
+// isTaken 检查 users 表中 field 列是否已有该值，field 只能是 username 或 email
+func isTaken(field, value string) (bool, error) {
+	var count int64
+	err := store.DB.Model(&models.User{}).Where(field+" = ?", value).Count(&count).Error
+	return count > 0, err
+}
+
+// availabilityResponse 返回用户名或邮箱的可用性
+func availabilityResponse(c *gin.Context, field, value string) {
+	taken, err := isTaken(field, value)
+	if err != nil {
+		log.Printf("数据库查询错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "DATABASE_ERROR",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "查询成功",
+		"data": gin.H{
+			field:       value,
+			"available": !taken,
+		},
+	})
+}
+
+// CheckUsernameHandler 检查用户名是否可以注册
+// @Summary 检查用户名
+// @Description 按注册时的规则校验用户名并检查是否已被使用，按客户端IP限流
+// @Tags auth
+// @Produce json
+// @Param username query string true "用户名"
+// @Success 200 {object} map[string]interface{} "available 表示是否可用"
+// @Failure 400 {object} map[string]interface{} "用户名格式错误"
+// @Failure 429 {object} map[string]interface{} "请求过于频繁"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /api/v1/auth/check-username [get]
+func CheckUsernameHandler(c *gin.Context) {
+	var req models.CheckUsernameRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "用户名格式错误，长度应为3-20个字符",
+			"code":    "INVALID_USERNAME",
+			"details": err.Error(),
+		})
+		return
+	}
+	availabilityResponse(c, "username", req.Username)
+}
+
+// CheckEmailHandler 检查邮箱是否可以注册
+// @Summary 检查邮箱
+// @Description 按注册时的规则校验邮箱并检查是否已被使用，按客户端IP限流
+// @Tags auth
+// @Produce json
+// @Param email query string true "邮箱"
+// @Success 200 {object} map[string]interface{} "available 表示是否可用"
+// @Failure 400 {object} map[string]interface{} "邮箱格式错误"
+// @Failure 429 {object} map[string]interface{} "请求过于频繁"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /api/v1/auth/check-email [get]
+func CheckEmailHandler(c *gin.Context) {
+	var req models.CheckEmailRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "邮箱格式错误",
+			"code":    "INVALID_EMAIL",
+			"details": err.Error(),
+		})
+		return
+	}
+	availabilityResponse(c, "email", req.Email)
+}
+
+// respondLoginBlocked 登录被限制时返回429和需要等待的秒数
+func respondLoginBlocked(c *gin.Context, blocked *services.LoginBlockedError) {
+	retryAfter := int(blocked.RetryAfter.Round(time.Second) / time.Second)
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       blocked.Error(),
+		"code":        blocked.Code,
+		"retry_after": retryAfter,
+	})
+}
+
 // LoginHandler 处理用户登录请求
 // @Summary 用户登录
-// @Description 验证用户凭据，返回JWT令牌
+// @Description 验证用户凭据，返回访问令牌和刷新令牌；开启两步验证时返回挑战令牌；连续失败后需要等待或被临时锁定
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -124,6 +217,7 @@ func RegisterHandler(c *gin.Context) {
 // @Failure 400 {object} map[string]interface{} "请求数据错误"
 // @Failure 401 {object} map[string]interface{} "认证失败"
 // @Failure 403 {object} map[string]interface{} "账户被禁用"
+// @Failure 429 {object} map[string]interface{} "尝试过于频繁或账户被锁定"
 // @Failure 500 {object} map[string]interface{} "服务器内部错误"
 // @Router /api/v1/auth/login [post]
 func LoginHandler(c *gin.Context) {
@@ -140,17 +234,12 @@ func LoginHandler(c *gin.Context) {
 	}
 
 	// 查找用户（支持用户名或邮箱登录）
-	var user models.User
-	result := store.DB.Where("username = ? OR email = ?", req.Username, req.Username).First(&user)
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			// 用户不存在，返回认证失败（不泄露具体原因）
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "用户名或密码错误",
-				"code":  "INVALID_CREDENTIALS",
-			})
-			return
-		}
+	var found models.User
+	user := &found
+	result := store.DB.Where("username = ? OR email = ?", req.Username, req.Username).First(&found)
+	if result.Error == gorm.ErrRecordNotFound {
+		user = nil
+	} else if result.Error != nil {
 		// 数据库查询错误
 		log.Printf("数据库查询错误: %v", result.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -160,8 +249,35 @@ func LoginHandler(c *gin.Context) {
 		return
 	}
 
+	ctx := c.Request.Context()
+	ip := c.ClientIP()
+	subject := services.LoginSubject(user, req.Username)
+	audit := func(result string) {
+		services.RecordLoginAttempt(user, req.Username, result, ip, c.Request.UserAgent())
+	}
+
+	// 账户或IP被锁定、重试过快时不校验密码
+	if err := services.CheckLogin(ctx, subject, ip); err != nil {
+		blocked := err.(*services.LoginBlockedError)
+		audit(blocked.Result)
+		respondLoginBlocked(c, blocked)
+		return
+	}
+
+	// 用户不存在或密码错误，返回认证失败（不泄露具体原因）
+	if user == nil || !user.CheckPassword(req.Password) {
+		services.RecordLoginFailure(ctx, subject, ip)
+		audit(models.LoginInvalidCredentials)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "用户名或密码错误",
+			"code":  "INVALID_CREDENTIALS",
+		})
+		return
+	}
+
 	// 检查用户账户状态
-	if user.Status != "active" {
+	if user.Status != models.StatusActive {
+		audit(models.LoginAccountDisabled)
 		c.JSON(http.StatusForbidden, gin.H{
 			"error": "账户已被禁用",
 			"code":  "ACCOUNT_DISABLED",
@@ -169,17 +285,29 @@ func LoginHandler(c *gin.Context) {
 		return
 	}
 
-	// 验证密码是否正确
-	if !user.CheckPassword(req.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "用户名或密码错误",
-			"code":  "INVALID_CREDENTIALS",
+	// 开启两步验证时先返回挑战令牌，提交验证码后才签发令牌
+	// 失败计数在验证码通过后才清除，密码泄露时也无法无限次尝试验证码
+	if user.TwoFactorEnabled {
+		challenge, err := services.CreateLoginChallenge(ctx, user)
+		if err != nil {
+			log.Printf("创建两步验证挑战错误: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "服务器内部错误",
+				"code":  "TWO_FACTOR_ERROR",
+			})
+			return
+		}
+		audit(models.LoginTwoFactorRequired)
+		c.JSON(http.StatusOK, gin.H{
+			"message": "请输入两步验证码",
+			"code":    "TWO_FACTOR_REQUIRED",
+			"data":    challenge,
 		})
 		return
 	}
 
-	// 生成新的JWT认证令牌
-	token, err := services.GenerateToken(user.ID, user.Username)
+	// 生成访问令牌和新一组刷新令牌
+	response, err := services.IssueTokens(user)
 	if err != nil {
 		log.Printf("生成令牌错误: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -189,21 +317,125 @@ func LoginHandler(c *gin.Context) {
 		return
 	}
 
+	services.ResetLoginFailures(ctx, subject)
+	audit(models.LoginSucceeded)
+
 	// 记录成功登录日志
 	log.Printf("用户登录成功: %s (ID: %d)", user.Username, user.ID)
 
-	// 构造并返回成功响应
-	response := models.AuthResponse{
-		User:  &user,
-		Token: token,
+	c.JSON(http.StatusOK, gin.H{
+		"message": "登录成功",
+		"data":    response,
+	})
+}
+
+// RefreshTokenHandler 用刷新令牌换取新的访问令牌
+// @Summary 刷新令牌
+// @Description 用刷新令牌换取新的访问令牌，刷新令牌同时轮换，旧令牌立即失效
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.RefreshRequest true "刷新令牌"
+// @Success 200 {object} models.AuthResponse "刷新成功"
+// @Failure 400 {object} map[string]interface{} "请求数据错误"
+// @Failure 401 {object} map[string]interface{} "刷新令牌无效或已被使用"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /api/v1/auth/refresh [post]
+func RefreshTokenHandler(c *gin.Context) {
+	var req models.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "缺少刷新令牌",
+			"code":  "MISSING_REFRESH_TOKEN",
+		})
+		return
+	}
+
+	response, err := services.RefreshTokens(req.RefreshToken)
+	switch {
+	case errors.Is(err, services.ErrRefreshTokenInvalid):
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": err.Error(),
+			"code":  "INVALID_REFRESH_TOKEN",
+		})
+		return
+	case errors.Is(err, services.ErrRefreshTokenReused):
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": err.Error(),
+			"code":  "REFRESH_TOKEN_REUSED",
+		})
+		return
+	case err != nil:
+		log.Printf("刷新令牌错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "TOKEN_REFRESH_ERROR",
+		})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "登录成功",
+		"message": "令牌刷新成功",
 		"data":    response,
 	})
 }
 
+// LogoutHandler 处理用户登出请求
+// @Summary 用户登出
+// @Description 作废当前访问令牌，并作废请求中的刷新令牌所属的整组令牌
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.RefreshRequest false "刷新令牌"
+// @Success 200 {object} map[string]interface{} "登出成功"
+// @Failure 401 {object} map[string]interface{} "未认证"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /api/v1/auth/logout [post]
+func LogoutHandler(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	// 请求体可以为空，此时只作废访问令牌
+	var req models.RefreshRequest
+	_ = c.ShouldBindJSON(&req)
+
+	if err := services.RevokeRefreshToken(req.RefreshToken, userID); err != nil {
+		log.Printf("作废刷新令牌失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "LOGOUT_ERROR",
+		})
+		return
+	}
+
+	if claims, ok := c.Get("token_claims"); ok {
+		if err := services.RevokeAccessToken(c.Request.Context(), claims.(*services.JWTClaims)); err != nil {
+			log.Printf("作废访问令牌失败: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "服务器内部错误",
+				"code":  "LOGOUT_ERROR",
+			})
+			return
+		}
+	}
+
+	log.Printf("用户登出: %s (ID: %d)", c.GetString("username"), userID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "已退出登录",
+	})
+}
+
+// recentLoginLimit 用户信息中返回的登录记录条数
+const recentLoginLimit = 20
+
+// ProfileResponse 用户信息及配额用量
+type ProfileResponse struct {
+	models.User
+	Quota        services.QuotaUsage   `json:"quota"`
+	RecentLogins []models.LoginAttempt `json:"recent_logins,omitempty"` // 只在查看自己的信息时返回
+}
+
 // GetProfileHandler 获取当前用户信息
 // @Summary 获取用户信息
 // @Description 获取当前认证用户的详细信息
@@ -211,7 +443,7 @@ func LoginHandler(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Success 200 {object} models.User "用户信息"
+// @Success 200 {object} ProfileResponse "用户信息"
 // @Failure 401 {object} map[string]interface{} "未认证"
 // @Failure 404 {object} map[string]interface{} "用户不存在"
 // @Failure 500 {object} map[string]interface{} "服务器内部错误"
@@ -245,9 +477,19 @@ func GetProfileHandler(c *gin.Context) {
 		return
 	}
 
-	// 返回用户信息
+	// 最近的登录记录，便于用户发现异常登录；查询失败不影响返回用户信息
+	recentLogins, err := services.RecentLoginAttempts(user.ID, recentLoginLimit)
+	if err != nil {
+		log.Printf("查询登录记录错误: %v", err)
+	}
+
+	// 返回用户信息、配额用量和最近的登录记录
 	c.JSON(http.StatusOK, gin.H{
 		"message": "获取用户信息成功",
-		"data":    user,
+		"data": ProfileResponse{
+			User:         user,
+			Quota:        services.Quota(&user),
+			RecentLogins: recentLogins,
+		},
 	})
 }
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"icpt-system/internal/models"
+	"icpt-system/internal/store"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// currentUserID 返回认证中间件设置的当前用户ID，未认证时写入401响应并返回false
+func currentUserID(c *gin.Context) (uint, bool) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "用户未认证",
+			"code":  "UNAUTHENTICATED",
+		})
+		return 0, false
+	}
+	return userID, true
+}
+
+// loadOwnedImage 查询路径参数 id 对应的、当前用户拥有的图片
+// 其他用户的图片与不存在的图片一样返回404，失败时已写入响应并返回false
+func loadOwnedImage(c *gin.Context) (*models.Image, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	image, err := store.Images().FindOwned(userID, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "图像未找到",
+				"code":  "IMAGE_NOT_FOUND",
+			})
+			return nil, false
+		}
+		log.Printf("查询图像错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "DATABASE_ERROR",
+		})
+		return nil, false
+	}
+	return image, true
+}
@@ -0,0 +1,259 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"icpt-system/internal/models"
+	"icpt-system/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 分片上传（断点续传）协议：
+//  1. POST   /uploads                创建会话，返回 upload_id 和最大分片大小
+//  2. PUT    /uploads/:id            请求头 Upload-Offset 指明分片的起始位置，请求体为分片数据
+//  3. HEAD   /uploads/:id            连接中断后查询服务器已接收的字节数（响应头 Upload-Offset），从该位置继续
+//  4. POST   /uploads/:id/finalize   全部上传后合并分片，之后与普通上传相同
+//  5. DELETE /uploads/:id            取消上传
+
+// uploadOffsetHeader 分片偏移量请求/响应头
+const uploadOffsetHeader = "Upload-Offset"
+
+// CreateUploadRequest 创建分片上传会话的请求
+type CreateUploadRequest struct {
+	Filename string `json:"filename" binding:"required,max=255"`
+	Size     int64  `json:"size" binding:"required,min=1"`
+	OptimizeRequest
+}
+
+// uploadSessionResponse 分片上传会话的响应数据
+func uploadSessionResponse(session *services.UploadSession) gin.H {
+	data := gin.H{
+		"upload_id":  session.ID,
+		"filename":   session.Filename,
+		"size":       session.Size,
+		"offset":     session.Offset,
+		"chunk_size": services.UploadChunkSize(),
+		"expires_at": session.ExpiresAt.Format(time.RFC3339),
+	}
+	if session.ImageID != 0 {
+		data["imageId"] = session.ImageID
+	}
+	return data
+}
+
+// loadUploadSession 读取当前用户的分片上传会话，失败时直接写入错误响应并返回 nil
+func loadUploadSession(c *gin.Context) *services.UploadSession {
+	session, err := services.GetUploadSession(c.Request.Context(), c.Param("id"))
+	if err == nil && session.UserID != c.GetUint("user_id") {
+		err = services.ErrUploadNotFound // 不暴露其他用户的会话是否存在
+	}
+	if err != nil {
+		writeUploadError(c, session, err)
+		return nil
+	}
+	return session
+}
+
+// writeUploadError 将分片上传的错误转换为响应
+func writeUploadError(c *gin.Context, session *services.UploadSession, err error) {
+	switch {
+	case errors.Is(err, services.ErrUploadNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+			"code":  "UPLOAD_NOT_FOUND",
+		})
+	case errors.Is(err, services.ErrUploadOffsetMismatch):
+		c.Header(uploadOffsetHeader, strconv.FormatInt(session.Offset, 10))
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  err.Error(),
+			"code":   "OFFSET_MISMATCH",
+			"offset": session.Offset,
+		})
+	case errors.Is(err, services.ErrUploadBusy):
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+			"code":  "UPLOAD_BUSY",
+		})
+	case errors.Is(err, services.ErrChunkTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":      fmt.Sprintf("%v，单个分片最大 %d 字节且不能超出文件大小", err, services.UploadChunkSize()),
+			"code":       "CHUNK_TOO_LARGE",
+			"chunk_size": services.UploadChunkSize(),
+		})
+	case errors.Is(err, services.ErrUploadIncomplete):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  err.Error(),
+			"code":   "UPLOAD_INCOMPLETE",
+			"offset": session.Offset,
+			"size":   session.Size,
+		})
+	default:
+		log.Printf("错误: 分片上传失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "UPLOAD_FAILED",
+		})
+	}
+}
+
+// CreateUploadHandler 创建分片上传会话
+func CreateUploadHandler(c *gin.Context) {
+	var req CreateUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求参数错误: " + err.Error(),
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	// 在接收任何分片之前检查声明的文件大小和配额
+	if err := services.CheckUploadSize(req.Size); err != nil {
+		writeUploadValidationError(c, err)
+		return
+	}
+	filename := services.SanitizeFilename(req.Filename)
+
+	userID := c.GetUint("user_id")
+	if err := services.CheckQuota(userID, req.Size); err != nil {
+		writeUploadValidationError(c, err)
+		return
+	}
+	var user models.User
+	if !loadUploadSettings(c, userID, &user) {
+		return
+	}
+	optimize, err := resolveOptimizeOptions(req.OptimizeRequest, &user)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+			"code":  "INVALID_OPTIMIZE_OPTIONS",
+		})
+		return
+	}
+
+	session, err := services.CreateUploadSession(c.Request.Context(), userID, filename, req.Size, optimize)
+	if err != nil {
+		writeUploadError(c, session, err)
+		return
+	}
+
+	log.Printf("用户 %d 创建分片上传会话 %s: %s (%d bytes)", userID, session.ID, session.Filename, session.Size)
+	c.Header("Location", "/api/v1/uploads/"+session.ID)
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "上传会话已创建",
+		"data":    uploadSessionResponse(session),
+	})
+}
+
+// GetUploadOffsetHandler 查询已接收的字节数（HEAD只返回响应头，GET同时返回会话信息）
+func GetUploadOffsetHandler(c *gin.Context) {
+	session := loadUploadSession(c)
+	if session == nil {
+		return
+	}
+
+	c.Header(uploadOffsetHeader, strconv.FormatInt(session.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(session.Size, 10))
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"data": uploadSessionResponse(session)})
+}
+
+// UploadChunkHandler 接收一个分片
+func UploadChunkHandler(c *gin.Context) {
+	session := loadUploadSession(c)
+	if session == nil {
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader(uploadOffsetHeader), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "缺少或无效的 Upload-Offset 请求头",
+			"code":  "INVALID_OFFSET",
+		})
+		return
+	}
+	// 偏移量不一致时不读取请求体，客户端应先查询偏移量
+	if offset != session.Offset {
+		writeUploadError(c, session, services.ErrUploadOffsetMismatch)
+		return
+	}
+
+	updated, err := services.AppendUploadChunk(c.Request.Context(), session.ID, offset, c.Request.Body)
+	if err != nil {
+		if updated == nil {
+			updated = session
+		}
+		writeUploadError(c, updated, err)
+		return
+	}
+
+	c.Header(uploadOffsetHeader, strconv.FormatInt(updated.Offset, 10))
+	c.JSON(http.StatusOK, gin.H{"data": uploadSessionResponse(updated)})
+}
+
+// FinalizeUploadHandler 合并分片并创建图片，响应与普通上传相同
+// 重复提交时返回第一次创建的图片
+func FinalizeUploadHandler(c *gin.Context) {
+	session := loadUploadSession(c)
+	if session == nil {
+		return
+	}
+
+	// 会话锁保持到记录图片之后，并发的完成请求不会重复创建图片
+	session, staged, release, err := services.StageUploadSession(c.Request.Context(), session.ID)
+	defer release()
+	if err != nil {
+		writeUploadError(c, session, err)
+		return
+	}
+	if staged == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "上传已完成",
+			"data": gin.H{
+				"imageId":   session.ImageID,
+				"duplicate": true,
+			},
+		})
+		return
+	}
+
+	// 合并后的文件不是允许的图片时删除会话，重新上传相同内容也不会通过
+	if _, err := services.ValidateStagedUpload(staged); err != nil {
+		staged.Discard()
+		if err := services.AbortUploadSession(c.Request.Context(), session); err != nil {
+			log.Printf("错误: 删除上传会话 %s 失败: %v", session.ID, err)
+		}
+		writeUploadValidationError(c, err)
+		return
+	}
+
+	imageID, ok := submitStagedUpload(c, session.UserID, session.Filename, staged, session.Optimize)
+	if !ok {
+		return
+	}
+	if err := services.CompleteUploadSession(c.Request.Context(), session, imageID); err != nil {
+		log.Printf("错误: 更新上传会话 %s 失败: %v", session.ID, err)
+	}
+}
+
+// CancelUploadHandler 取消上传并删除已上传的分片
+func CancelUploadHandler(c *gin.Context) {
+	session := loadUploadSession(c)
+	if session == nil {
+		return
+	}
+
+	if err := services.DeleteUploadSession(c.Request.Context(), session); err != nil {
+		writeUploadError(c, session, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "上传已取消"})
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"icpt-system/internal/models"
+	"icpt-system/internal/queue"
+	"icpt-system/internal/store"
+	"icpt-system/internal/tasks"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeadLetterResponse 死信详情，附带解析后的任务内容（无法解析时为空）
+type DeadLetterResponse struct {
+	queue.DeadLetter
+	Task *tasks.Task `json:"task,omitempty"`
+}
+
+// newDeadLetterResponse 构造死信响应
+func newDeadLetterResponse(entry queue.DeadLetter) DeadLetterResponse {
+	response := DeadLetterResponse{DeadLetter: entry}
+	if task, err := tasks.Decode(entry.Payload); err == nil {
+		response.Task = task
+	}
+	return response
+}
+
+// ListDeadLettersHandler 分页列出死信队列中的任务
+func ListDeadLettersHandler(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	offset := int64((page - 1) * pageSize)
+	letters, total, err := queue.TaskQueue.ListDeadLetters(store.Ctx, offset, int64(pageSize))
+	if err != nil {
+		log.Printf("查询死信队列错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "查询失败",
+			"code":  "QUEUE_ERROR",
+		})
+		return
+	}
+
+	data := make([]DeadLetterResponse, len(letters))
+	for i, entry := range letters {
+		data[i] = newDeadLetterResponse(entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "查询成功",
+		"data":        data,
+		"total":       total,
+		"page":        page,
+		"page_size":   pageSize,
+		"total_pages": int((total + int64(pageSize) - 1) / int64(pageSize)),
+	})
+}
+
+// GetDeadLetterHandler 查看单条死信
+func GetDeadLetterHandler(c *gin.Context) {
+	entry, err := queue.TaskQueue.GetDeadLetter(store.Ctx, c.Param("id"))
+	if err != nil {
+		respondDeadLetterError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "查询成功",
+		"data":    newDeadLetterResponse(*entry),
+	})
+}
+
+// RequeueDeadLetterHandler 将死信重新放回处理队列，重试次数清零
+func RequeueDeadLetterHandler(c *gin.Context) {
+	id := c.Param("id")
+
+	entry, err := queue.TaskQueue.GetDeadLetter(store.Ctx, id)
+	if err != nil {
+		respondDeadLetterError(c, err)
+		return
+	}
+
+	task, err := tasks.Decode(entry.Payload)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "任务内容无法解析，不能重新入队",
+			"code":    "INVALID_TASK",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	task.Attempt = 0
+	payload, err := tasks.Encode(task)
+	if err != nil {
+		log.Printf("编码任务错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "QUEUE_ERROR",
+		})
+		return
+	}
+
+	// 先恢复图片状态，再放回队列，避免Worker处理完成后被覆盖
+	store.DB.Model(&models.Image{}).Where("id = ?", task.ImageID).Updates(map[string]interface{}{
+		"status":     "processing",
+		"error_info": "",
+	})
+
+	if err := queue.TaskQueue.RequeueDeadLetter(store.Ctx, id, payload); err != nil {
+		respondDeadLetterError(c, err)
+		return
+	}
+
+	log.Printf("死信 %s 已重新入队 (图片 ID: %d)", id, task.ImageID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "已重新入队",
+		"data": gin.H{
+			"id":       id,
+			"image_id": task.ImageID,
+		},
+	})
+}
+
+// PurgeDeadLetterHandler 删除单条死信
+func PurgeDeadLetterHandler(c *gin.Context) {
+	id := c.Param("id")
+	if err := queue.TaskQueue.PurgeDeadLetter(store.Ctx, id); err != nil {
+		respondDeadLetterError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "删除成功",
+		"data": gin.H{
+			"id": id,
+		},
+	})
+}
+
+// PurgeAllDeadLettersHandler 清空死信队列
+func PurgeAllDeadLettersHandler(c *gin.Context) {
+	count, err := queue.TaskQueue.PurgeDeadLetters(store.Ctx)
+	if err != nil {
+		log.Printf("清空死信队列错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "删除失败",
+			"code":  "QUEUE_ERROR",
+		})
+		return
+	}
+
+	log.Printf("死信队列已清空，共删除 %d 条", count)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "死信队列已清空",
+		"data": gin.H{
+			"deleted_count": count,
+		},
+	})
+}
+
+// respondDeadLetterError 统一处理死信相关错误
+func respondDeadLetterError(c *gin.Context, err error) {
+	if errors.Is(err, queue.ErrDeadLetterNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "死信未找到",
+			"code":  "DEAD_LETTER_NOT_FOUND",
+		})
+		return
+	}
+
+	log.Printf("死信队列操作错误: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": "服务器内部错误",
+		"code":  "QUEUE_ERROR",
+	})
+}
@@ -4,15 +4,15 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 
 	"icpt-system/internal/models"
+	"icpt-system/internal/services"
+	"icpt-system/internal/storage"
 	"icpt-system/internal/store"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 // ImageListResponse 图像列表响应结构
@@ -20,9 +20,11 @@ type ImageListResponse struct {
 	ID               uint    `json:"id"`
 	OriginalFilename string  `json:"original_filename"`
 	Status           string  `json:"status"`
-	ThumbnailURL     string  `json:"thumbnail_url,omitempty"`
-	OriginalURL      string  `json:"original_url,omitempty"`
+	ThumbnailURL     string  `json:"thumbnail_url,omitempty"` // 带签名的限时访问地址
+	OriginalURL      string  `json:"original_url,omitempty"`  // 带签名的限时访问地址
 	FileSize         int64   `json:"file_size"`
+	OriginalSize     int64   `json:"original_size,omitempty"`  // 上传时的大小
+	OptimizedSize    int64   `json:"optimized_size,omitempty"` // 优化后的大小，未优化时为空
 	CreatedAt        string  `json:"created_at"`
 	ProcessedAt      *string `json:"processed_at,omitempty"` // 新增处理时间字段
 	ErrorInfo        string  `json:"error_info,omitempty"`
@@ -39,15 +41,16 @@ type PaginatedResponse struct {
 
 // GetUserImagesHandler 获取用户的图像列表（分页）
 func GetUserImagesHandler(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "用户未认证",
-			"code":  "UNAUTHENTICATED",
-		})
+	userID, ok := currentUserID(c)
+	if !ok {
 		return
 	}
 
+	respondImageList(c, userID)
+}
+
+// respondImageList 分页返回用户的图像列表，支持按状态过滤
+func respondImageList(c *gin.Context, userID uint) {
 	// 获取分页参数
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
@@ -60,27 +63,8 @@ func GetUserImagesHandler(c *gin.Context) {
 		pageSize = 10
 	}
 
-	// 构建查询
-	query := store.DB.Where("user_id = ?", userID)
-	if status != "" {
-		query = query.Where("status = ?", status)
-	}
-
-	// 获取总数
-	var total int64
-	if err := query.Model(&models.Image{}).Count(&total).Error; err != nil {
-		log.Printf("查询图像总数错误: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "查询失败",
-			"code":  "DATABASE_ERROR",
-		})
-		return
-	}
-
-	// 分页查询
-	var images []models.Image
-	offset := (page - 1) * pageSize
-	if err := query.Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&images).Error; err != nil {
+	images, total, err := store.Images().ListOwned(userID, status, (page-1)*pageSize, pageSize)
+	if err != nil {
 		log.Printf("查询图像列表错误: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "查询失败",
@@ -97,6 +81,8 @@ func GetUserImagesHandler(c *gin.Context) {
 			OriginalFilename: img.OriginalFilename,
 			Status:           img.Status,
 			FileSize:         img.FileSize,
+			OriginalSize:     img.OriginalSize,
+			OptimizedSize:    img.OptimizedSize,
 			CreatedAt:        img.CreatedAt.Format("2006-01-02 15:04:05"),
 		}
 
@@ -106,21 +92,9 @@ func GetUserImagesHandler(c *gin.Context) {
 			imageList[i].ProcessedAt = &processedTime
 		}
 
-		// 如果有缩略图，添加URL (去掉开头的uploads/以匹配静态文件配置)
-		if img.ThumbnailPath != "" {
-			// 数据库存储: uploads/thumbnails/thumb-xxx.jpg
-			// 静态服务配置: /static -> ./uploads
-			// 所以API应该返回: thumbnails/thumb-xxx.jpg
-			// 前端访问: /static/thumbnails/thumb-xxx.jpg -> ./uploads/thumbnails/thumb-xxx.jpg ✓
-			thumbnailPath := strings.TrimPrefix(img.ThumbnailPath, "uploads/")
-			imageList[i].ThumbnailURL = thumbnailPath
-		}
-
-		// 原始图片URL (同样去掉uploads/前缀)
-		if img.StoragePath != "" {
-			originalPath := strings.TrimPrefix(img.StoragePath, "uploads/")
-			imageList[i].OriginalURL = originalPath
-		}
+		// 缩略图和原图URL带签名和过期时间，<img>标签无需认证头即可直接使用；原图经过API服务器去除元数据
+		imageList[i].ThumbnailURL = signedURL(c.Request.Context(), img.ThumbnailPath)
+		imageList[i].OriginalURL = originalURL(img.StoragePath)
 
 		// 错误信息
 		if img.ErrorInfo != "" {
@@ -144,42 +118,25 @@ func GetUserImagesHandler(c *gin.Context) {
 
 // DeleteImageHandler 删除用户的图像
 func DeleteImageHandler(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "用户未认证",
-			"code":  "UNAUTHENTICATED",
-		})
+	// 确保只能删除自己的图像
+	image, ok := loadOwnedImage(c)
+	if !ok {
 		return
 	}
+	userID := image.UserID
 
-	imageID := c.Param("id")
-
-	var image models.Image
-	// 确保只能删除自己的图像
-	result := store.DB.Where("id = ? AND user_id = ?", imageID, userID).First(&image)
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error": "图像未找到",
-				"code":  "IMAGE_NOT_FOUND",
-			})
-			return
-		}
-		log.Printf("查询图像错误: %v", result.Error)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "服务器内部错误",
-			"code":  "DATABASE_ERROR",
-		})
-		return
+	// 计入配额的字节数，必须在删除衍生图记录之前统计
+	usage, err := services.ImageUsage([]models.Image{*image})
+	if err != nil {
+		log.Printf("统计图像 %d 占用空间错误: %v", image.ID, err)
 	}
 
 	// 删除物理文件
 	var deletionErrors []string
 	
-	// 删除原始文件
+	// 删除原始文件（共享的原图只在最后一个引用删除时才删除文件）
 	if image.StoragePath != "" {
-		if err := os.Remove(image.StoragePath); err != nil && !os.IsNotExist(err) {
+		if err := services.RemoveImageFile(image.ContentHash, image.StoragePath); err != nil {
 			log.Printf("删除原始文件失败 %s: %v", image.StoragePath, err)
 			deletionErrors = append(deletionErrors, fmt.Sprintf("原始文件: %v", err))
 		} else {
@@ -187,9 +144,17 @@ func DeleteImageHandler(c *gin.Context) {
 		}
 	}
 	
+	// 删除优化时保留的未压缩原图
+	if image.RawOriginalPath != "" {
+		if err := services.RemoveImageFile(image.ContentHash, image.RawOriginalPath); err != nil {
+			log.Printf("删除未压缩原图失败 %s: %v", image.RawOriginalPath, err)
+			deletionErrors = append(deletionErrors, fmt.Sprintf("未压缩原图: %v", err))
+		}
+	}
+
 	// 删除缩略图文件
 	if image.ThumbnailPath != "" {
-		if err := os.Remove(image.ThumbnailPath); err != nil && !os.IsNotExist(err) {
+		if err := storage.Backend.Delete(c.Request.Context(), image.ThumbnailPath); err != nil {
 			log.Printf("删除缩略图文件失败 %s: %v", image.ThumbnailPath, err)
 			deletionErrors = append(deletionErrors, fmt.Sprintf("缩略图: %v", err))
 		} else {
@@ -197,8 +162,18 @@ func DeleteImageHandler(c *gin.Context) {
 		}
 	}
 
+	// 删除衍生图文件和记录
+	_, renditionErrors := deleteImageRenditions([]uint{image.ID})
+	deletionErrors = append(deletionErrors, renditionErrors...)
+
+	// 删除元数据记录
+	if err := deleteImageMetadata([]uint{image.ID}); err != nil {
+		log.Printf("删除元数据记录错误: %v", err)
+		deletionErrors = append(deletionErrors, fmt.Sprintf("元数据: %v", err))
+	}
+
 	// 删除数据库记录
-	if err := store.DB.Delete(&image).Error; err != nil {
+	if err := store.DB.Delete(image).Error; err != nil {
 		log.Printf("删除图像记录错误: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "删除失败",
@@ -207,6 +182,10 @@ func DeleteImageHandler(c *gin.Context) {
 		return
 	}
 
+	if err := services.AdjustUsage(store.DB, image.UserID, -usage, -1); err != nil {
+		log.Printf("更新用户 %d 存储用量错误: %v", image.UserID, err)
+	}
+
 	log.Printf("用户 %v 删除了图像 %d", userID, image.ID)
 
 	response := gin.H{
@@ -226,12 +205,8 @@ func DeleteImageHandler(c *gin.Context) {
 
 // BatchDeleteImagesHandler 批量删除图像
 func BatchDeleteImagesHandler(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "用户未认证",
-			"code":  "UNAUTHENTICATED",
-		})
+	userID, ok := currentUserID(c)
+	if !ok {
 		return
 	}
 
@@ -257,8 +232,8 @@ func BatchDeleteImagesHandler(c *gin.Context) {
 	}
 
 	// 首先查询要删除的图像信息（用于删除物理文件）
-	var images []models.Image
-	if err := store.DB.Where("id IN ? AND user_id = ?", req.ImageIDs, userID).Find(&images).Error; err != nil {
+	images, err := store.Images().FindOwnedByIDs(userID, req.ImageIDs)
+	if err != nil {
 		log.Printf("查询待删除图像错误: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "查询失败",
@@ -275,14 +250,20 @@ func BatchDeleteImagesHandler(c *gin.Context) {
 		return
 	}
 
+	// 计入配额的字节数，必须在删除衍生图记录之前统计
+	usage, err := services.ImageUsage(images)
+	if err != nil {
+		log.Printf("统计待删除图像占用空间错误: %v", err)
+	}
+
 	// 删除物理文件
 	var deletionErrors []string
 	filesDeleted := 0
 
 	for _, image := range images {
-		// 删除原始文件
+		// 删除原始文件（共享的原图只在最后一个引用删除时才删除文件）
 		if image.StoragePath != "" {
-			if err := os.Remove(image.StoragePath); err != nil && !os.IsNotExist(err) {
+			if err := services.RemoveImageFile(image.ContentHash, image.StoragePath); err != nil {
 				log.Printf("删除原始文件失败 %s: %v", image.StoragePath, err)
 				deletionErrors = append(deletionErrors, fmt.Sprintf("图像%d原始文件: %v", image.ID, err))
 			} else {
@@ -291,9 +272,19 @@ func BatchDeleteImagesHandler(c *gin.Context) {
 			}
 		}
 		
+		// 删除优化时保留的未压缩原图
+		if image.RawOriginalPath != "" {
+			if err := services.RemoveImageFile(image.ContentHash, image.RawOriginalPath); err != nil {
+				log.Printf("删除未压缩原图失败 %s: %v", image.RawOriginalPath, err)
+				deletionErrors = append(deletionErrors, fmt.Sprintf("图像%d未压缩原图: %v", image.ID, err))
+			} else {
+				filesDeleted++
+			}
+		}
+
 		// 删除缩略图文件
 		if image.ThumbnailPath != "" {
-			if err := os.Remove(image.ThumbnailPath); err != nil && !os.IsNotExist(err) {
+			if err := storage.Backend.Delete(c.Request.Context(), image.ThumbnailPath); err != nil {
 				log.Printf("删除缩略图文件失败 %s: %v", image.ThumbnailPath, err)
 				deletionErrors = append(deletionErrors, fmt.Sprintf("图像%d缩略图: %v", image.ID, err))
 			} else {
@@ -303,10 +294,25 @@ func BatchDeleteImagesHandler(c *gin.Context) {
 		}
 	}
 
+	// 删除衍生图文件和记录
+	imageIDs := make([]uint, len(images))
+	for i, image := range images {
+		imageIDs[i] = image.ID
+	}
+	renditionFilesDeleted, renditionErrors := deleteImageRenditions(imageIDs)
+	filesDeleted += renditionFilesDeleted
+	deletionErrors = append(deletionErrors, renditionErrors...)
+
+	// 删除元数据记录
+	if err := deleteImageMetadata(imageIDs); err != nil {
+		log.Printf("删除元数据记录错误: %v", err)
+		deletionErrors = append(deletionErrors, fmt.Sprintf("元数据: %v", err))
+	}
+
 	// 删除数据库记录
-	result := store.DB.Where("id IN ? AND user_id = ?", req.ImageIDs, userID).Delete(&models.Image{})
-	if result.Error != nil {
-		log.Printf("批量删除图像错误: %v", result.Error)
+	deleted, err := store.Images().DeleteOwned(userID, imageIDs)
+	if err != nil {
+		log.Printf("批量删除图像错误: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "删除失败",
 			"code":  "DATABASE_ERROR",
@@ -314,12 +320,16 @@ func BatchDeleteImagesHandler(c *gin.Context) {
 		return
 	}
 
-	log.Printf("用户 %v 批量删除了 %d 个图像，删除了 %d 个物理文件", userID, result.RowsAffected, filesDeleted)
+	if err := services.AdjustUsage(store.DB, userID, -usage, -deleted); err != nil {
+		log.Printf("更新用户 %v 存储用量错误: %v", userID, err)
+	}
+
+	log.Printf("用户 %v 批量删除了 %d 个图像，删除了 %d 个物理文件", userID, deleted, filesDeleted)
 
 	response := gin.H{
 		"message": "批量删除成功",
 		"data": gin.H{
-			"deleted_count": result.RowsAffected,
+			"deleted_count": deleted,
 			"files_deleted": filesDeleted,
 		},
 	}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"icpt-system/internal/config"
+	"icpt-system/internal/models"
+	"icpt-system/internal/services"
+	"icpt-system/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetadataResponse 图片的EXIF元数据
+type MetadataResponse struct {
+	CameraMake  string   `json:"camera_make,omitempty"`
+	CameraModel string   `json:"camera_model,omitempty"`
+	LensModel   string   `json:"lens_model,omitempty"`
+	TakenAt     *string  `json:"taken_at,omitempty"`
+	Width       int      `json:"width"`
+	Height      int      `json:"height"`
+	Orientation int      `json:"orientation"`
+	Latitude    *float64 `json:"latitude,omitempty"`
+	Longitude   *float64 `json:"longitude,omitempty"`
+}
+
+// loadMetadataResponse 查询图片的元数据，includeGPS为false时不返回位置
+func loadMetadataResponse(imageID uint, includeGPS bool) *MetadataResponse {
+	var meta models.ImageMetadata
+	if err := store.DB.Where("image_id = ?", imageID).First(&meta).Error; err != nil {
+		return nil
+	}
+
+	response := &MetadataResponse{
+		CameraMake:  meta.CameraMake,
+		CameraModel: meta.CameraModel,
+		LensModel:   meta.LensModel,
+		Width:       meta.Width,
+		Height:      meta.Height,
+		Orientation: meta.Orientation,
+	}
+	if meta.TakenAt != nil {
+		takenAt := meta.TakenAt.Format("2006-01-02 15:04:05")
+		response.TakenAt = &takenAt
+	}
+	if includeGPS {
+		response.Latitude = meta.Latitude
+		response.Longitude = meta.Longitude
+	}
+	return response
+}
+
+// deleteImageMetadata 删除图片的元数据记录
+func deleteImageMetadata(imageIDs []uint) error {
+	return store.DB.Where("image_id IN ?", imageIDs).Delete(&models.ImageMetadata{}).Error
+}
+
+// serveOriginalFile 返回原图文件，按隐私配置去除JPEG中的EXIF等元数据
+func serveOriginalFile(c *gin.Context, key string) {
+	ext := strings.ToLower(path.Ext(key))
+	if !config.Cfg.Privacy.StripMetadata || (ext != ".jpg" && ext != ".jpeg") {
+		serveStoredFile(c, key, mime.TypeByExtension(ext))
+		return
+	}
+
+	file, _, ok := openStoredFile(c, key)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	c.Header("Content-Type", "image/jpeg")
+	c.Status(http.StatusOK)
+	if err := services.StripJPEGMetadata(c.Writer, file); err != nil {
+		log.Printf("去除元数据后返回原图 %s 失败: %v", key, err)
+	}
+}
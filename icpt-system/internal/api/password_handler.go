@@ -0,0 +1,161 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"icpt-system/internal/models"
+	"icpt-system/internal/services"
+	"icpt-system/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ChangePasswordHandler 修改当前用户的密码
+// @Summary 修改密码
+// @Description 校验当前密码后设置新密码，其他设备上的会话全部失效，返回当前客户端使用的新令牌
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.ChangePasswordRequest true "当前密码和新密码"
+// @Success 200 {object} models.AuthResponse "修改成功"
+// @Failure 400 {object} map[string]interface{} "请求数据错误或当前密码不正确"
+// @Failure 401 {object} map[string]interface{} "未认证"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /api/v1/auth/change-password [post]
+func ChangePasswordHandler(c *gin.Context) {
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求数据格式错误",
+			"code":    "INVALID_REQUEST",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var user models.User
+	if err := store.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
+		log.Printf("数据库查询错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "DATABASE_ERROR",
+		})
+		return
+	}
+
+	if err := services.ChangePassword(c.Request.Context(), &user, req.CurrentPassword, req.NewPassword); err != nil {
+		if errors.Is(err, services.ErrWrongPassword) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+				"code":  "WRONG_PASSWORD",
+			})
+			return
+		}
+		log.Printf("修改密码错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "CHANGE_PASSWORD_ERROR",
+		})
+		return
+	}
+
+	// 原有会话已全部作废，为当前客户端签发新令牌
+	response, err := services.IssueTokens(&user)
+	if err != nil {
+		log.Printf("生成令牌错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "生成认证令牌失败",
+			"code":  "TOKEN_GENERATION_ERROR",
+		})
+		return
+	}
+
+	log.Printf("用户修改密码成功: %s (ID: %d)", user.Username, user.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "密码修改成功",
+		"data":    response,
+	})
+}
+
+// ForgotPasswordHandler 发送重置密码邮件
+// @Summary 找回密码
+// @Description 向邮箱发送一次性的重置密码链接，无论邮箱是否注册都返回相同的响应
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.ForgotPasswordRequest true "注册邮箱"
+// @Success 202 {object} map[string]interface{} "请求已受理"
+// @Failure 400 {object} map[string]interface{} "请求数据错误"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /api/v1/auth/forgot-password [post]
+func ForgotPasswordHandler(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求数据格式错误",
+			"code":    "INVALID_REQUEST",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if err := services.RequestPasswordReset(req.Email); err != nil {
+		log.Printf("创建重置密码令牌错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "PASSWORD_RESET_ERROR",
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "如果该邮箱已注册，重置密码链接将发送到该邮箱",
+	})
+}
+
+// ResetPasswordHandler 使用重置令牌设置新密码
+// @Summary 重置密码
+// @Description 使用邮件中的令牌设置新密码，令牌只能使用一次，所有设备上的会话都会失效
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.ResetPasswordRequest true "重置令牌和新密码"
+// @Success 200 {object} map[string]interface{} "重置成功"
+// @Failure 400 {object} map[string]interface{} "请求数据错误或令牌无效"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /api/v1/auth/reset-password [post]
+func ResetPasswordHandler(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求数据格式错误",
+			"code":    "INVALID_REQUEST",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if err := services.ResetPassword(c.Request.Context(), req.Token, req.Password); err != nil {
+		if errors.Is(err, services.ErrResetTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+				"code":  "INVALID_RESET_TOKEN",
+			})
+			return
+		}
+		log.Printf("重置密码错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "PASSWORD_RESET_ERROR",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "密码已重置，请使用新密码登录",
+	})
+}
@@ -1,52 +1,32 @@
 package api
 
 import (
-	"icpt-system/internal/config"
-	"icpt-system/internal/models"
-	"icpt-system/internal/store"
 	"net/http"
-	"strings"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 // ImageStatusResponse 定义查询响应的结构
 type ImageStatusResponse struct {
-	ID               uint   `json:"id"`
-	Status           string `json:"status"`
-	OriginalFilename string `json:"original_filename"`
-	StoragePath      string `json:"storage_path"`
-	ThumbnailPath    string `json:"thumbnail_path,omitempty"`
-	ThumbnailURL     string `json:"thumbnail_url,omitempty"`
-	ErrorInfo        string `json:"error_info,omitempty"`
-	CreatedAt        string `json:"created_at"`
+	ID               uint                `json:"id"`
+	Status           string              `json:"status"`
+	OriginalFilename string              `json:"original_filename"`
+	OriginalURL      string              `json:"original_url,omitempty"`
+	ThumbnailURL     string              `json:"thumbnail_url,omitempty"`
+	ErrorInfo        string              `json:"error_info,omitempty"`
+	FileSize         int64               `json:"file_size"`
+	OriginalSize     int64               `json:"original_size,omitempty"`    // 上传时的大小
+	OptimizedSize    int64               `json:"optimized_size,omitempty"`   // 优化后的大小，未优化时为空
+	HasRawOriginal   bool                `json:"has_raw_original,omitempty"` // 是否保留了未压缩的原图
+	CreatedAt        string              `json:"created_at"`
+	Renditions       []RenditionResponse `json:"renditions,omitempty"`
+	Metadata         *MetadataResponse   `json:"metadata,omitempty"`
 }
 
-// GetImageStatusHandler 根据 ID 查询图片状态和信息
+// GetImageStatusHandler 根据 ID 查询图片状态和信息，只能查询自己的图片
 func GetImageStatusHandler(c *gin.Context) {
-	// 从 URL 路径中获取 id
-	id := c.Param("id")
-
-	var image models.Image
-	// 使用 First 方法根据主键查询
-	result := store.DB.First(&image, id)
-
-	// 检查查询结果
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			// 如果记录未找到，返回 404
-			c.JSON(http.StatusNotFound, gin.H{
-				"error": "图片未找到",
-				"code":  "IMAGE_NOT_FOUND",
-			})
-		} else {
-			// 如果是其他数据库错误，返回 500
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "查询数据库时发生错误",
-				"code":  "DATABASE_ERROR",
-			})
-		}
+	image, ok := loadOwnedImage(c)
+	if !ok {
 		return
 	}
 
@@ -55,20 +35,17 @@ func GetImageStatusHandler(c *gin.Context) {
 		ID:               image.ID,
 		Status:           image.Status,
 		OriginalFilename: image.OriginalFilename,
-		StoragePath:      image.StoragePath,
+		FileSize:         image.FileSize,
+		OriginalSize:     image.OriginalSize,
+		OptimizedSize:    image.OptimizedSize,
+		HasRawOriginal:   image.RawOriginalPath != "",
 		CreatedAt:        image.CreatedAt.Format("2006-01-02 15:04:05"),
 	}
 
-	// 如果有缩略图，添加缩略图信息和完整URL
+	// 只返回带签名的访问URL，不暴露存储键；原图总是经过 /static 去除元数据，缩略图在S3存储下为预签名地址
+	response.OriginalURL = originalURL(image.StoragePath)
 	if image.ThumbnailPath != "" {
-		response.ThumbnailPath = image.ThumbnailPath
-		// 构建完整的访问URL (去掉uploads/前缀以匹配静态文件配置)
-		baseURL := strings.TrimSuffix(config.Cfg.Server.PublicHost, "/")
-		// 数据库存储: uploads/thumbnails/thumb-xxx.jpg
-		// 静态服务配置: /static -> ./uploads
-		// 所以URL应该是: /static/thumbnails/thumb-xxx.jpg
-		thumbnailPath := strings.TrimPrefix(image.ThumbnailPath, "uploads/")
-		response.ThumbnailURL = baseURL + "/static/" + thumbnailPath
+		response.ThumbnailURL = signedURL(c.Request.Context(), image.ThumbnailPath)
 	}
 
 	// 如果有错误信息，添加错误信息
@@ -76,6 +53,14 @@ func GetImageStatusHandler(c *gin.Context) {
 		response.ErrorInfo = image.ErrorInfo
 	}
 
+	// 添加各尺寸衍生图（图库、详情页、移动端按需选择）
+	if renditions, err := loadRenditionResponses(image.ID); err == nil {
+		response.Renditions = renditions
+	}
+
+	// 添加EXIF元数据，只有所有者能查到图片，因此包含GPS位置
+	response.Metadata = loadMetadataResponse(image.ID, true)
+
 	// 成功找到记录，返回 200 和图片详细信息
 	c.JSON(http.StatusOK, gin.H{
 		"message": "查询成功",
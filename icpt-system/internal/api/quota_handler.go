@@ -0,0 +1,135 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"icpt-system/internal/models"
+	"icpt-system/internal/services"
+	"icpt-system/internal/store"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// adminUserID 解析路径中的用户ID，失败时直接写入错误响应并返回 false
+func adminUserID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的用户ID",
+			"code":  "INVALID_USER_ID",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondUserQuota 返回用户当前的配额和用量
+func respondUserQuota(c *gin.Context, userID uint, message string) {
+	quota, err := services.GetQuota(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "用户未找到",
+				"code":  "USER_NOT_FOUND",
+			})
+			return
+		}
+		log.Printf("查询用户 %d 配额错误: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "DATABASE_ERROR",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"data":    quota,
+	})
+}
+
+// GetUserQuotaHandler 查看用户的配额和用量
+func GetUserQuotaHandler(c *gin.Context) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+	respondUserQuota(c, userID, "查询成功")
+}
+
+// UpdateUserQuotaHandler 修改用户的配额上限
+// 0表示不限制，-1表示恢复为配置中的默认值；已超出新上限的用户只是无法继续上传
+func UpdateUserQuotaHandler(c *gin.Context) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.QuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求数据格式错误",
+			"code":    "INVALID_REQUEST",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	for column, value := range map[string]*int64{
+		"max_storage_bytes": req.MaxStorageBytes,
+		"max_images":        req.MaxImages,
+	} {
+		switch {
+		case value == nil:
+		case *value == -1:
+			updates[column] = gorm.Expr("NULL")
+		case *value >= 0:
+			updates[column] = *value
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": column + " 必须大于等于0，或为-1（使用默认值）",
+				"code":  "INVALID_QUOTA",
+			})
+			return
+		}
+	}
+
+	if len(updates) > 0 {
+		result := store.DB.Model(&models.User{}).Where("id = ?", userID).Updates(updates)
+		if result.Error != nil {
+			log.Printf("更新用户 %d 配额错误: %v", userID, result.Error)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "服务器内部错误",
+				"code":  "DATABASE_ERROR",
+			})
+			return
+		}
+		log.Printf("管理员 %s 修改了用户 %d 的配额: %v", c.GetString("username"), userID, updates)
+	}
+
+	respondUserQuota(c, userID, "配额已更新")
+}
+
+// RecalculateUserQuotaHandler 根据图片记录重新统计用户的用量，用于修正计数偏差
+func RecalculateUserQuotaHandler(c *gin.Context) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := store.RecalculateUsage(store.DB, userID); err != nil {
+		log.Printf("重新统计用户 %d 用量错误: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "DATABASE_ERROR",
+		})
+		return
+	}
+
+	respondUserQuota(c, userID, "用量已重新统计")
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"icpt-system/internal/config"
+	"icpt-system/internal/models"
+	"icpt-system/internal/services"
+	"icpt-system/internal/storage"
+	"icpt-system/internal/store"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// originalRendition 表示原图（优化后的原图）的尺寸名称
+	originalRendition = "original"
+
+	// rawRendition 表示优化时保留的未压缩原图
+	rawRendition = "raw"
+)
+
+// RenditionResponse 衍生图信息
+type RenditionResponse struct {
+	Name     string `json:"name"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Format   string `json:"format"`
+	FileSize int64  `json:"file_size"`
+	URL      string `json:"url"`
+}
+
+// renditionURL 构建衍生图的访问URL
+func renditionURL(imageID uint, name string) string {
+	baseURL := strings.TrimSuffix(config.Cfg.Server.PublicHost, "/")
+	return fmt.Sprintf("%s/api/v1/images/%d/renditions/%s", baseURL, imageID, name)
+}
+
+// loadRenditionResponses 查询图片的衍生图列表
+func loadRenditionResponses(imageID uint) ([]RenditionResponse, error) {
+	var renditions []models.ImageRendition
+	if err := store.DB.Where("image_id = ?", imageID).Order("width ASC").Find(&renditions).Error; err != nil {
+		return nil, err
+	}
+
+	response := make([]RenditionResponse, len(renditions))
+	for i, r := range renditions {
+		response[i] = RenditionResponse{
+			Name:     r.Name,
+			Width:    r.Width,
+			Height:   r.Height,
+			Format:   r.Format,
+			FileSize: r.FileSize,
+			URL:      renditionURL(imageID, r.Name),
+		}
+	}
+	return response, nil
+}
+
+// GetImageRenditionsHandler 列出图片的全部衍生图
+func GetImageRenditionsHandler(c *gin.Context) {
+	image, ok := loadOwnedImage(c)
+	if !ok {
+		return
+	}
+
+	renditions, err := loadRenditionResponses(image.ID)
+	if err != nil {
+		log.Printf("查询衍生图错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "查询失败",
+			"code":  "DATABASE_ERROR",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "查询成功",
+		"data":    renditions,
+	})
+}
+
+// ServeImageRenditionHandler 返回图片指定尺寸的文件
+// size为original时返回原图，为raw时返回优化前保留的未压缩原图
+func ServeImageRenditionHandler(c *gin.Context) {
+	image, ok := loadOwnedImage(c)
+	if !ok {
+		return
+	}
+
+	size := c.Param("size")
+	if size == originalRendition {
+		serveOriginalFile(c, image.StoragePath)
+		return
+	}
+	if size == rawRendition {
+		if image.RawOriginalPath == "" {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "未保留未压缩的原图",
+				"code":  "RENDITION_NOT_FOUND",
+			})
+			return
+		}
+		serveOriginalFile(c, image.RawOriginalPath)
+		return
+	}
+
+	if _, ok := services.FindRenditionSpec(size); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "不支持的尺寸: " + size,
+			"code":  "INVALID_SIZE",
+		})
+		return
+	}
+
+	var rendition models.ImageRendition
+	if err := store.DB.Where("image_id = ? AND name = ?", image.ID, size).First(&rendition).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "该尺寸尚未生成",
+				"code":  "RENDITION_NOT_FOUND",
+			})
+			return
+		}
+		log.Printf("查询衍生图错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "DATABASE_ERROR",
+		})
+		return
+	}
+
+	serveStoredFile(c, rendition.StoragePath, services.FormatContentType(rendition.Format))
+}
+
+// RenderImageHandler 按请求参数返回缩放后的图片
+// 结果按参数缓存在磁盘上，只有第一次请求会真正缩放；支持ETag/If-None-Match条件请求
+func RenderImageHandler(c *gin.Context) {
+	params, err := services.ParseRenderParams(
+		c.Query("w"), c.Query("h"), c.Query("fit"), c.Query("format"), c.Query("q"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+			"code":  "INVALID_RENDER_PARAMS",
+		})
+		return
+	}
+
+	image, ok := loadOwnedImage(c)
+	if !ok {
+		return
+	}
+
+	cachePath, key, err := services.RenderCached(image.StoragePath, image.ID, params)
+	if err != nil {
+		log.Printf("按需渲染图像 %d 失败: %v", image.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "图像渲染失败",
+			"code":  "RENDER_FAILED",
+		})
+		return
+	}
+
+	file, err := os.Open(cachePath)
+	if err != nil {
+		log.Printf("打开渲染缓存 %s 失败: %v", cachePath, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "图像渲染失败",
+			"code":  "RENDER_FAILED",
+		})
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "图像渲染失败",
+			"code":  "RENDER_FAILED",
+		})
+		return
+	}
+
+	// 缓存键由图片和参数唯一确定，可直接作为强ETag；ServeContent负责处理条件请求和304
+	c.Header("ETag", `"`+key+`"`)
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.Header("Content-Type", services.FormatContentType(params.Format))
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), file)
+}
+
+// deleteImageRenditions 删除图片的衍生图文件、渲染缓存和记录，返回删除的文件数和错误描述
+func deleteImageRenditions(imageIDs []uint) (int, []string) {
+	var renditions []models.ImageRendition
+	if err := store.DB.Where("image_id IN ?", imageIDs).Find(&renditions).Error; err != nil {
+		log.Printf("查询衍生图错误: %v", err)
+		return 0, []string{fmt.Sprintf("衍生图: %v", err)}
+	}
+
+	filesDeleted := 0
+	var deletionErrors []string
+	for _, r := range renditions {
+		if err := storage.Backend.Delete(context.Background(), r.StoragePath); err != nil {
+			log.Printf("删除衍生图文件失败 %s: %v", r.StoragePath, err)
+			deletionErrors = append(deletionErrors, fmt.Sprintf("图像%d衍生图%s: %v", r.ImageID, r.Name, err))
+		} else {
+			filesDeleted++
+		}
+	}
+
+	for _, id := range imageIDs {
+		if err := services.PurgeRenderCache(id); err != nil {
+			log.Printf("删除图像 %d 的渲染缓存失败: %v", id, err)
+			deletionErrors = append(deletionErrors, fmt.Sprintf("图像%d渲染缓存: %v", id, err))
+		}
+	}
+
+	if err := store.DB.Where("image_id IN ?", imageIDs).Delete(&models.ImageRendition{}).Error; err != nil {
+		log.Printf("删除衍生图记录错误: %v", err)
+		deletionErrors = append(deletionErrors, fmt.Sprintf("衍生图记录: %v", err))
+	}
+	return filesDeleted, deletionErrors
+}
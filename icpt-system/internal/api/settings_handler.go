@@ -0,0 +1,81 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"icpt-system/internal/models"
+	"icpt-system/internal/store"
+	"icpt-system/pkg/imageprocessor"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpdateUploadSettingsHandler 更新用户的上传设置（是否优化原图、压缩预设、是否保留未压缩原图）
+func UpdateUploadSettingsHandler(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "未认证",
+			"code":  "UNAUTHENTICATED",
+		})
+		return
+	}
+
+	var req models.UploadSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求数据格式错误",
+			"code":    "INVALID_REQUEST",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.OptimizeOriginals != nil {
+		updates["optimize_originals"] = *req.OptimizeOriginals
+	}
+	if req.OptimizePreset != nil {
+		if _, ok := imageprocessor.PresetConfig(*req.OptimizePreset); !ok || *req.OptimizePreset == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "不支持的压缩预设: " + *req.OptimizePreset,
+				"code":  "INVALID_PRESET",
+			})
+			return
+		}
+		updates["optimize_preset"] = *req.OptimizePreset
+	}
+	if req.KeepRawOriginal != nil {
+		updates["keep_raw_original"] = *req.KeepRawOriginal
+	}
+
+	var user models.User
+	if len(updates) > 0 {
+		if err := store.DB.Model(&models.User{}).Where("id = ?", userID).Updates(updates).Error; err != nil {
+			log.Printf("更新上传设置错误: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "服务器内部错误",
+				"code":  "DATABASE_ERROR",
+			})
+			return
+		}
+	}
+	if err := store.DB.First(&user, userID).Error; err != nil {
+		log.Printf("数据库查询错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "DATABASE_ERROR",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "上传设置已更新",
+		"data": gin.H{
+			"optimize_originals": user.OptimizeOriginals,
+			"optimize_preset":    user.OptimizePreset,
+			"keep_raw_original":  user.KeepRawOriginal,
+		},
+	})
+}
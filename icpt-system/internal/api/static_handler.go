@@ -0,0 +1,74 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"icpt-system/internal/storage"
+	"icpt-system/internal/store"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ServeStaticFileHandler 返回存储中的图片文件 /static/*filepath
+// 两种访问方式：图片列表等接口签发的带签名、有时效的URL（<img>标签无法携带认证头），
+// 或携带认证令牌访问自己的图片；其他请求一律拒绝，避免猜测文件名读取他人的私密照片
+func ServeStaticFileHandler(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("filepath"), "/")
+	if key == "" {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "文件不存在",
+			"code":  "FILE_NOT_FOUND",
+		})
+		return
+	}
+
+	var ownerID uint
+	if signature := c.Query("signature"); signature != "" {
+		if !storage.Signer.VerifySignature(key, c.Query("expires"), signature) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "访问链接无效或已过期",
+				"code":  "INVALID_SIGNATURE",
+			})
+			return
+		}
+	} else {
+		ownerID = c.GetUint("user_id")
+		if ownerID == 0 {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "缺少认证令牌",
+				"code":  "MISSING_TOKEN",
+			})
+			return
+		}
+	}
+
+	image, err := store.Images().FindByStorageKey(key, ownerID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "文件不存在",
+				"code":  "FILE_NOT_FOUND",
+			})
+			return
+		}
+		log.Printf("查询文件 %s 所属图片错误: %v", key, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "DATABASE_ERROR",
+		})
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=3600")
+
+	// 原图按隐私配置去除元数据，缩略图和衍生图本身不含元数据
+	if key == image.StoragePath || key == image.RawOriginalPath {
+		serveOriginalFile(c, key)
+		return
+	}
+	serveStoredFile(c, key, "")
+}
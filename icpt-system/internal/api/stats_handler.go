@@ -1,6 +1,7 @@
 package api
 
 import (
+	"log"
 	"net/http"
 	"time"
 
@@ -8,14 +9,18 @@ import (
 	"gorm.io/gorm"
 
 	"icpt-system/internal/models"
+	"icpt-system/internal/services"
+	"icpt-system/internal/store"
+	"icpt-system/internal/worker"
 )
 
 // DashboardStats 仪表盘统计数据结构
 type DashboardStats struct {
-	TotalImages    int64   `json:"total_images"`
-	TodayProcessed int64   `json:"today_processed"`
-	SuccessRate    float64 `json:"success_rate"`
-	AvgTime        float64 `json:"avg_time"` // 平均处理时间(毫秒)
+	TotalImages    int64                `json:"total_images"`
+	TodayProcessed int64                `json:"today_processed"`
+	SuccessRate    float64              `json:"success_rate"`
+	AvgTime        float64              `json:"avg_time"`        // 平均处理时间(毫秒)
+	Quota          *services.QuotaUsage `json:"quota,omitempty"` // 存储空间和图片数量配额
 }
 
 // RecentActivity 最近活动数据结构
@@ -81,6 +86,13 @@ func GetDashboardStats(db *gorm.DB) gin.HandlerFunc {
 			stats.AvgTime = 0
 		}
 
+		// 5. 配额用量
+		if quota, err := services.GetQuota(userID); err == nil {
+			stats.Quota = quota
+		} else {
+			log.Printf("查询用户 %d 配额错误: %v", userID, err)
+		}
+
 		c.JSON(http.StatusOK, gin.H{
 			"data":    stats,
 			"message": "获取统计信息成功",
@@ -152,4 +164,29 @@ func GetImageStatusCount(db *gorm.DB) gin.HandlerFunc {
 		})
 	}
 }
- 
\ No newline at end of file
+ 
+// GetWorkerStats 获取各Worker进程上报的状态（图像处理器实现、处理统计）
+func GetWorkerStats(c *gin.Context) {
+	statuses, err := worker.ListStatuses(store.Ctx, store.Rdb)
+	if err != nil {
+		log.Printf("查询Worker状态错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "查询失败",
+			"code":  "REDIS_ERROR",
+		})
+		return
+	}
+
+	online := 0
+	for _, status := range statuses {
+		if status.Online {
+			online++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":         statuses,
+		"online_count": online,
+		"message":      "获取Worker状态成功",
+	})
+}
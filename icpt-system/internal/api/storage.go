@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path"
+
+	"icpt-system/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openStoredFile 读取存储中的文件，失败时直接写入错误响应并返回 false
+func openStoredFile(c *gin.Context, key string) (io.ReadCloser, *storage.ObjectInfo, bool) {
+	info, err := storage.Backend.Stat(c.Request.Context(), key)
+	if err == nil {
+		var r io.ReadCloser
+		if r, err = storage.Backend.Get(c.Request.Context(), key); err == nil {
+			return r, info, true
+		}
+	}
+
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "文件不存在",
+			"code":  "FILE_NOT_FOUND",
+		})
+		return nil, nil, false
+	}
+	log.Printf("读取存储文件 %s 失败: %v", key, err)
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": "读取文件失败",
+		"code":  "STORAGE_ERROR",
+	})
+	return nil, nil, false
+}
+
+// serveStoredFile 返回存储中的文件；contentType 为空时使用存储记录的类型
+func serveStoredFile(c *gin.Context, key, contentType string) {
+	r, info, ok := openStoredFile(c, key)
+	if !ok {
+		return
+	}
+	defer r.Close()
+
+	if contentType == "" {
+		contentType = info.ContentType
+	}
+	if contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+
+	// 本地文件和S3对象都支持Seek，可以交给ServeContent处理Range和条件请求
+	if rs, ok := r.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, path.Base(key), info.ModTime, rs)
+		return
+	}
+	c.DataFromReader(http.StatusOK, info.Size, contentType, r, nil)
+}
+
+// originalURL 返回原图的签名访问URL，key 为空时返回空字符串
+// 任何存储后端下都指向API服务器的 /static，由 serveOriginalFile 按隐私配置去除元数据后返回
+func originalURL(key string) string {
+	if key == "" {
+		return ""
+	}
+	return storage.Signer.SignedURL(key, storage.URLExpiry())
+}
+
+// signedURL 返回存储文件（缩略图、衍生图）的签名访问URL，key 为空或签名失败时返回空字符串
+func signedURL(ctx context.Context, key string) string {
+	if key == "" {
+		return ""
+	}
+	url, err := storage.Backend.SignedURL(ctx, key, storage.URLExpiry())
+	if err != nil {
+		log.Printf("生成文件 %s 的访问URL失败: %v", key, err)
+		return ""
+	}
+	return url
+}
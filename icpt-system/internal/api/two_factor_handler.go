@@ -0,0 +1,338 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"icpt-system/internal/models"
+	"icpt-system/internal/services"
+	"icpt-system/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadCurrentUser 查询当前登录用户，失败时已写入响应并返回false
+func loadCurrentUser(c *gin.Context) (*models.User, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+	var user models.User
+	if err := store.DB.First(&user, userID).Error; err != nil {
+		log.Printf("数据库查询错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "DATABASE_ERROR",
+		})
+		return nil, false
+	}
+	return &user, true
+}
+
+// bindTwoFactorRequest 解析请求体，失败时已写入响应并返回false
+func bindTwoFactorRequest(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求数据格式错误",
+			"code":    "INVALID_REQUEST",
+			"details": err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// respondTwoFactorError 将两步验证相关的错误转换为响应
+func respondTwoFactorError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidOTP):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_OTP"})
+	case errors.Is(err, services.ErrWrongPassword):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "WRONG_PASSWORD"})
+	case errors.Is(err, services.ErrTwoFactorEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "TWO_FACTOR_ALREADY_ENABLED"})
+	case errors.Is(err, services.ErrTwoFactorNotEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "TWO_FACTOR_NOT_ENABLED"})
+	case errors.Is(err, services.ErrTwoFactorNotSetup):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "TWO_FACTOR_NOT_SETUP"})
+	default:
+		log.Printf("两步验证操作错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "TWO_FACTOR_ERROR",
+		})
+	}
+}
+
+// VerifyTwoFactorHandler 两步登录的第二步：提交验证码或恢复码，换取访问令牌
+// @Summary 两步验证登录
+// @Description 用登录接口返回的挑战令牌和验证器中的验证码（或恢复码）完成登录
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.TwoFactorVerifyRequest true "挑战令牌和验证码"
+// @Success 200 {object} models.AuthResponse "登录成功"
+// @Failure 400 {object} map[string]interface{} "请求数据错误"
+// @Failure 401 {object} map[string]interface{} "挑战令牌无效或验证码错误"
+// @Failure 429 {object} map[string]interface{} "尝试过于频繁或账户被锁定"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /api/v1/auth/2fa/verify [post]
+func VerifyTwoFactorHandler(c *gin.Context) {
+	var req models.TwoFactorVerifyRequest
+	if !bindTwoFactorRequest(c, &req) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := services.LoginChallengeUser(ctx, req.ChallengeToken)
+	if errors.Is(err, services.ErrChallengeInvalid) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": err.Error(),
+			"code":  "INVALID_CHALLENGE",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("查询两步验证挑战错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "TWO_FACTOR_ERROR",
+		})
+		return
+	}
+
+	// 验证码错误与密码错误共用登录失败计数
+	ip := c.ClientIP()
+	subject := services.LoginSubject(user, user.Username)
+	audit := func(result string) {
+		services.RecordLoginAttempt(user, user.Username, result, ip, c.Request.UserAgent())
+	}
+	if err := services.CheckLogin(ctx, subject, ip); err != nil {
+		blocked := err.(*services.LoginBlockedError)
+		audit(blocked.Result)
+		respondLoginBlocked(c, blocked)
+		return
+	}
+
+	err = services.CompleteLoginChallenge(ctx, req.ChallengeToken, user, req.Code)
+	switch {
+	case errors.Is(err, services.ErrInvalidOTP):
+		services.RecordLoginFailure(ctx, subject, ip)
+		audit(models.LoginInvalidOTP)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": err.Error(),
+			"code":  "INVALID_OTP",
+		})
+		return
+	case errors.Is(err, services.ErrChallengeInvalid):
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": err.Error(),
+			"code":  "INVALID_CHALLENGE",
+		})
+		return
+	case err != nil:
+		log.Printf("两步验证登录错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "TWO_FACTOR_ERROR",
+		})
+		return
+	}
+
+	response, err := services.IssueTokens(user)
+	if err != nil {
+		log.Printf("生成令牌错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "生成认证令牌失败",
+			"code":  "TOKEN_GENERATION_ERROR",
+		})
+		return
+	}
+
+	services.ResetLoginFailures(ctx, subject)
+	audit(models.LoginSucceeded)
+	log.Printf("用户两步验证登录成功: %s (ID: %d)", user.Username, user.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "登录成功",
+		"data":    response,
+	})
+}
+
+// SetupTwoFactorHandler 开始绑定两步验证，返回密钥和用于生成二维码的 otpauth:// 地址
+// @Summary 获取两步验证密钥
+// @Description 生成新的TOTP密钥，确认验证码之前两步验证不生效
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "secret 和 provisioning_uri"
+// @Failure 401 {object} map[string]interface{} "未认证"
+// @Failure 409 {object} map[string]interface{} "已开启两步验证"
+// @Router /api/v1/auth/2fa/setup [post]
+func SetupTwoFactorHandler(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	secret, uri, err := services.BeginTwoFactorSetup(user)
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "请用验证器应用扫描二维码或手动输入密钥，然后提交验证码完成绑定",
+		"data": gin.H{
+			"secret":           secret,
+			"provisioning_uri": uri,
+		},
+	})
+}
+
+// EnableTwoFactorHandler 提交验证码确认绑定，返回恢复码
+// @Summary 开启两步验证
+// @Description 校验验证码后开启两步验证，返回只显示一次的恢复码；其他设备上的会话全部失效，返回当前客户端使用的新令牌
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.TwoFactorCodeRequest true "验证码"
+// @Success 200 {object} map[string]interface{} "recovery_codes 和新令牌"
+// @Failure 400 {object} map[string]interface{} "验证码错误或未获取密钥"
+// @Failure 401 {object} map[string]interface{} "未认证"
+// @Failure 409 {object} map[string]interface{} "已开启两步验证"
+// @Router /api/v1/auth/2fa/enable [post]
+func EnableTwoFactorHandler(c *gin.Context) {
+	var req models.TwoFactorCodeRequest
+	if !bindTwoFactorRequest(c, &req) {
+		return
+	}
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	codes, err := services.EnableTwoFactor(c.Request.Context(), user, req.Code)
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	// 原有会话已全部作废，为当前客户端签发新令牌
+	response, err := services.IssueTokens(user)
+	if err != nil {
+		log.Printf("生成令牌错误: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "生成认证令牌失败",
+			"code":  "TOKEN_GENERATION_ERROR",
+		})
+		return
+	}
+
+	log.Printf("用户开启两步验证: %s (ID: %d)", user.Username, user.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "两步验证已开启，请妥善保存恢复码，之后无法再次查看",
+		"data": gin.H{
+			"recovery_codes": codes,
+			"auth":           response,
+		},
+	})
+}
+
+// DisableTwoFactorHandler 关闭两步验证
+// @Summary 关闭两步验证
+// @Description 校验密码和验证码（或恢复码）后关闭两步验证，删除密钥和恢复码
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.DisableTwoFactorRequest true "密码和验证码"
+// @Success 200 {object} map[string]interface{} "关闭成功"
+// @Failure 400 {object} map[string]interface{} "密码或验证码错误"
+// @Failure 401 {object} map[string]interface{} "未认证"
+// @Failure 409 {object} map[string]interface{} "未开启两步验证"
+// @Router /api/v1/auth/2fa/disable [post]
+func DisableTwoFactorHandler(c *gin.Context) {
+	var req models.DisableTwoFactorRequest
+	if !bindTwoFactorRequest(c, &req) {
+		return
+	}
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if err := services.DisableTwoFactor(user, req.Password, req.Code); err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	log.Printf("用户关闭两步验证: %s (ID: %d)", user.Username, user.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "两步验证已关闭",
+	})
+}
+
+// RegenerateRecoveryCodesHandler 重新生成恢复码
+// @Summary 重新生成恢复码
+// @Description 校验验证码后生成新的恢复码，原有的恢复码全部失效
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.TwoFactorCodeRequest true "验证码"
+// @Success 200 {object} map[string]interface{} "recovery_codes"
+// @Failure 400 {object} map[string]interface{} "验证码错误"
+// @Failure 401 {object} map[string]interface{} "未认证"
+// @Failure 409 {object} map[string]interface{} "未开启两步验证"
+// @Router /api/v1/auth/2fa/recovery-codes [post]
+func RegenerateRecoveryCodesHandler(c *gin.Context) {
+	var req models.TwoFactorCodeRequest
+	if !bindTwoFactorRequest(c, &req) {
+		return
+	}
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	codes, err := services.RegenerateRecoveryCodes(user, req.Code)
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "恢复码已重新生成，原有的恢复码已失效",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// ResetUserTwoFactorHandler 管理员关闭用户的两步验证，用于用户丢失验证器和恢复码的情况
+func ResetUserTwoFactorHandler(c *gin.Context) {
+	user, ok := loadAdminTargetUser(c)
+	if !ok || rejectSelfModification(c, user) {
+		return
+	}
+
+	if err := services.ResetTwoFactor(user.ID); err != nil {
+		log.Printf("重置用户 %d 两步验证错误: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "服务器内部错误",
+			"code":  "DATABASE_ERROR",
+		})
+		return
+	}
+
+	log.Printf("管理员 %s 关闭了用户 %s (ID: %d) 的两步验证", c.GetString("username"), user.Username, user.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "已关闭该用户的两步验证",
+	})
+}
@@ -1,94 +1,297 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"icpt-system/internal/models"
+	"icpt-system/internal/queue"
 	"icpt-system/internal/services"
 	"icpt-system/internal/store"
-	"io"
+	"icpt-system/internal/tasks"
+	"icpt-system/pkg/imageprocessor"
 	"log"
 	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
-	"time"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-// saveUploadedFile 负责保存原始文件并返回路径
-func saveUploadedFile(file *multipart.FileHeader) (string, error) {
+// stageUploadedFile 将上传文件写入临时文件并计算内容哈希
+func stageUploadedFile(file *multipart.FileHeader) (*services.StagedUpload, error) {
 	src, err := file.Open()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer src.Close()
 
-	// 沿用之前的唯一文件名逻辑
-	uniqueFilename := fmt.Sprintf("%s-%s", time.Now().Format("20060102150405"), file.Filename)
-	originalFilePath := filepath.Join("uploads/originals", uniqueFilename)
+	return services.StageUpload(src, file.Filename)
+}
 
-	dst, err := os.Create(originalFilePath)
-	if err != nil {
-		return "", err
-	}
-	defer dst.Close()
+// multipartOverhead 限制请求体大小时为multipart表单的边界和其他字段预留的字节数
+const multipartOverhead = 1 << 20
 
-	_, err = io.Copy(dst, src)
-	return originalFilePath, err
+// writeUploadValidationError 将上传校验和配额错误转换为响应
+func writeUploadValidationError(c *gin.Context, err error) {
+	var uploadErr *services.UploadError
+	if errors.As(err, &uploadErr) {
+		c.JSON(uploadErr.Status, gin.H{
+			"error": uploadErr.Message,
+			"code":  uploadErr.Code,
+		})
+		return
+	}
+	if quotaErr, ok := services.IsQuotaExceeded(err); ok {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": quotaErr.Error(),
+			"code":  "QUOTA_EXCEEDED",
+			"quota": quotaErr.Usage,
+		})
+		return
+	}
+	log.Printf("错误: 校验上传文件失败: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "服务器内部错误"})
 }
 
-func UploadImageHandler(c *gin.Context) {
+// formFile 读取上传表单中的图片文件，请求体超过大小限制时直接拒绝，不会先写入磁盘
+func formFile(c *gin.Context) (*multipart.FileHeader, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, services.MaxUploadSize()+multipartOverhead)
 	file, err := c.FormFile("image")
 	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeUploadValidationError(c, services.CheckUploadSize(services.MaxUploadSize()+1))
+			return nil, false
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": "获取文件失败: " + err.Error()})
+		return nil, false
+	}
+	if err := services.CheckUploadSize(file.Size); err != nil {
+		writeUploadValidationError(c, err)
+		return nil, false
+	}
+	return file, true
+}
+
+// OptimizeRequest 上传请求中的原图优化选项，未填写的字段使用用户的上传设置
+type OptimizeRequest struct {
+	Optimize       *bool  `json:"optimize"`
+	OptimizePreset string `json:"optimize_preset"`
+	KeepOriginal   *bool  `json:"keep_original"`
+}
+
+// optimizeRequestFromForm 从上传表单的 optimize、optimize_preset、keep_original 字段读取优化选项
+func optimizeRequestFromForm(c *gin.Context) (OptimizeRequest, error) {
+	req := OptimizeRequest{OptimizePreset: c.PostForm("optimize_preset")}
+	if value := c.PostForm("optimize"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return req, fmt.Errorf("optimize 参数无效: %s", value)
+		}
+		req.Optimize = &parsed
+	}
+	if value := c.PostForm("keep_original"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return req, fmt.Errorf("keep_original 参数无效: %s", value)
+		}
+		req.KeepOriginal = &parsed
+	}
+	return req, nil
+}
+
+// resolveOptimizeOptions 根据上传请求和用户的上传设置决定是否优化原图，返回nil表示不优化
+// 请求中的选项优先于用户设置
+func resolveOptimizeOptions(req OptimizeRequest, user *models.User) (*tasks.OptimizeOptions, error) {
+	optimize := user.OptimizeOriginals
+	if req.Optimize != nil {
+		optimize = *req.Optimize
+	}
+	if !optimize {
+		return nil, nil
+	}
+
+	options := &tasks.OptimizeOptions{
+		Preset:       user.OptimizePreset,
+		KeepOriginal: user.KeepRawOriginal,
+	}
+	if req.OptimizePreset != "" {
+		options.Preset = req.OptimizePreset
+	}
+	if _, ok := imageprocessor.PresetConfig(options.Preset); !ok {
+		return nil, fmt.Errorf("不支持的压缩预设: %s", options.Preset)
+	}
+	if req.KeepOriginal != nil {
+		options.KeepOriginal = *req.KeepOriginal
+	}
+	return options, nil
+}
+
+// loadUploadSettings 查询用户的上传设置，失败时直接写入错误响应并返回 false
+func loadUploadSettings(c *gin.Context, userID uint, user *models.User) bool {
+	if err := store.DB.Select("id", "optimize_originals", "optimize_preset", "keep_raw_original").
+		First(user, userID).Error; err != nil {
+		log.Printf("错误: 查询用户上传设置失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "服务器内部错误"})
+		return false
+	}
+	return true
+}
+
+func UploadImageHandler(c *gin.Context) {
+	file, ok := formFile(c)
+	if !ok {
 		return
 	}
+	filename := services.SanitizeFilename(file.Filename)
 
-	log.Printf("收到文件: %s, 大小: %d bytes", file.Filename, file.Size)
+	log.Printf("收到文件: %q, 大小: %d bytes", filename, file.Size)
 
-	// ---- 1. 只保存原始文件 ----
-	originalPath, err := saveUploadedFile(file)
+	// ---- 1. 获取当前用户ID ----
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
+		return
+	}
+
+	// ---- 2. 确定原图优化选项 ----
+	var user models.User
+	if !loadUploadSettings(c, userID.(uint), &user) {
+		return
+	}
+	var optimize *tasks.OptimizeOptions
+	optimizeReq, err := optimizeRequestFromForm(c)
+	if err == nil {
+		optimize, err = resolveOptimizeOptions(optimizeReq, &user)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+			"code":  "INVALID_OPTIMIZE_OPTIONS",
+		})
+		return
+	}
+
+	// ---- 3. 保存到临时文件并计算内容哈希 ----
+	staged, err := stageUploadedFile(file)
 	if err != nil {
 		log.Printf("错误: 保存原始文件失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "无法保存文件"})
 		return
 	}
 
-	// ---- 2. 获取当前用户ID ----
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
+	// ---- 4. 按文件内容校验格式和尺寸，通过后才写入存储和入队 ----
+	if _, err := services.ValidateStagedUpload(staged); err != nil {
+		staged.Discard()
+		writeUploadValidationError(c, err)
 		return
 	}
 
-	// ---- 3. 在数据库中创建初始记录 ----
+	submitStagedUpload(c, userID.(uint), filename, staged, optimize)
+}
+
+// submitStagedUpload 保存已暂存的上传、创建图片记录并推送处理任务，响应由本函数写入
+// 普通上传和分片上传合并后都走这里；返回图片ID（重复上传时为已有图片）和是否成功
+func submitStagedUpload(c *gin.Context, userID uint, filename string, staged *services.StagedUpload, optimize *tasks.OptimizeOptions) (uint, bool) {
+	// ---- 1. 同一用户重复上传相同内容时直接返回已有图片 ----
+	existing, err := store.Images().FindOwnedByHash(userID, staged.Hash)
+	if err == nil {
+		staged.Discard()
+		log.Printf("用户 %v 重复上传了图片 (ID: %d)", userID, existing.ID)
+		c.JSON(http.StatusOK, gin.H{
+			"message": "图片已存在",
+			"data": gin.H{
+				"imageId":   existing.ID,
+				"status":    existing.Status,
+				"duplicate": true,
+			},
+		})
+		return existing.ID, true
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		staged.Discard()
+		log.Printf("错误: 查询重复图片失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "服务器内部错误"})
+		return 0, false
+	}
+
+	// ---- 2. 占用配额，之后的步骤失败时归还 ----
+	if err := services.ReserveQuota(userID, staged.Size); err != nil {
+		staged.Discard()
+		writeUploadValidationError(c, err)
+		return 0, false
+	}
+	releaseQuota := func() {
+		if err := services.AdjustUsage(store.DB, userID, -staged.Size, -1); err != nil {
+			log.Printf("错误: 归还用户 %d 的配额失败: %v", userID, err)
+		}
+	}
+
+	// ---- 3. 按内容哈希存储原图（其他用户上传过相同内容时共享文件） ----
+	blob, err := services.CommitBlob(staged)
+	if err != nil {
+		log.Printf("错误: %v", err)
+		releaseQuota()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "无法保存文件"})
+		return 0, false
+	}
+
+	// ---- 4. 在数据库中创建初始记录 ----
 	imageRecord := models.Image{
-		UserID:           userID.(uint),
-		OriginalFilename: file.Filename,
-		StoragePath:      originalPath,
-		FileSize:         file.Size,    // 设置文件大小
+		UserID:           userID,
+		OriginalFilename: filename,
+		StoragePath:      blob.StoragePath,
+		ContentHash:      blob.Hash,
+		FileSize:         staged.Size,  // 设置文件大小
+		OriginalSize:     staged.Size,  // 优化前的大小
 		Status:           "processing", // 初始状态为 "处理中"
 	}
 	result := store.DB.Create(&imageRecord)
 	if result.Error != nil {
 		log.Printf("错误: 数据库创建初始记录失败: %v", result.Error)
+		if err := services.ReleaseBlob(blob.Hash); err != nil {
+			log.Printf("错误: 释放原图引用失败: %v", err)
+		}
+		releaseQuota()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "无法创建任务"})
-		return
+		return 0, false
 	}
 
-	// ---- 4. 将任务推入 Redis 队列 ----
-	err = store.Rdb.LPush(store.Ctx, store.TaskQueueName, imageRecord.ID).Err()
+	// ---- 5. 将任务推入 Redis 队列 ----
+	task := tasks.New(tasks.TypeProcessImage, imageRecord.ID, imageRecord.UserID, tasks.OpThumbnail, tasks.OpRenditions)
+	if optimize != nil {
+		task.Operations = append(task.Operations, tasks.OpOptimize)
+		task.Optimize = optimize
+	}
+	payload, err := tasks.Encode(task)
+	if err == nil {
+		err = queue.TaskQueue.Enqueue(store.Ctx, payload)
+	}
 	if err != nil {
 		log.Printf("错误: 推送任务到 Redis 失败: %v", err)
-		// 注意：这里可以加入补偿逻辑，比如将任务标记为失败
+		// 补偿：任务无法调度时撤销这次上传，删除记录并归还原图引用和配额，
+		// 否则之后上传相同内容会命中秒传，直接返回这张无法处理的图片
+		if err := store.DB.Delete(&imageRecord).Error; err != nil {
+			log.Printf("错误: 删除未调度的图片记录 (ID: %d) 失败: %v", imageRecord.ID, err)
+			// 至少将记录标记为失败，避免图片永远停留在 "processing" 状态
+			store.DB.Model(&imageRecord).Updates(models.Image{
+				Status:    "failed",
+				ErrorInfo: "任务调度失败",
+			})
+		} else {
+			if err := services.ReleaseBlob(blob.Hash); err != nil {
+				log.Printf("错误: 释放原图引用失败: %v", err)
+			}
+			releaseQuota()
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "无法调度任务"})
-		return
+		return 0, false
 	}
 
-	log.Printf("图片记录 (ID: %d) 创建成功, 任务已推送到队列", imageRecord.ID)
+	log.Printf("图片记录 (ID: %d) 创建成功, 任务已推送到队列 (trace=%s)", imageRecord.ID, task.TraceID)
 
-	// ---- 5. 立即返回响应 ----
+	// ---- 6. 立即返回响应 ----
 	c.JSON(http.StatusAccepted, gin.H{ // 返回 202 Accepted 表示请求已被接受，正在处理
 		"message": "文件上传成功，正在后台处理中...",
 		"data": gin.H{
@@ -96,27 +299,40 @@ func UploadImageHandler(c *gin.Context) {
 			"status":  imageRecord.Status,
 		},
 	})
+	return imageRecord.ID, true
 }
 
 // UploadImageSyncHandlerForTest 是我们原始 MVP 处理器的副本，用于基准测试
 func UploadImageSyncHandlerForTest(c *gin.Context) {
-	file, err := c.FormFile("image")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "获取文件失败: " + err.Error()})
+	file, ok := formFile(c)
+	if !ok {
 		return
 	}
+	filename := services.SanitizeFilename(file.Filename)
 
 	// --- 这部分是整个同步工作负载 ---
 	// 1. 保存原始文件
-	originalPath, err := saveUploadedFile(file) // 我们可以复用我们的辅助函数
+	staged, err := stageUploadedFile(file) // 我们可以复用我们的辅助函数
 	if err != nil {
 		log.Printf("同步测试错误：保存原始文件失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "处理文件失败: " + err.Error()})
 		return
 	}
+	if _, err := services.ValidateStagedUpload(staged); err != nil {
+		staged.Discard()
+		writeUploadValidationError(c, err)
+		return
+	}
+	blob, err := services.CommitBlob(staged)
+	if err != nil {
+		log.Printf("同步测试错误：保存原始文件失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "处理文件失败: " + err.Error()})
+		return
+	}
+	originalPath := blob.StoragePath
 
 	// 2. 生成缩略图（慢部分）
-	thumbPath, err := services.GenerateThumbnail(originalPath, file.Filename)
+	thumbPath, err := services.GenerateThumbnail(originalPath, filename)
 	if err != nil {
 		log.Printf("同步测试错误：生成缩略图失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "处理文件失败: " + err.Error()})
@@ -126,9 +342,11 @@ func UploadImageSyncHandlerForTest(c *gin.Context) {
 
 	imageRecord := models.Image{
 		UserID:           1, // 硬编码的测试用户
-		OriginalFilename: file.Filename,
+		OriginalFilename: filename,
 		StoragePath:      originalPath,
+		ContentHash:      blob.Hash,
 		ThumbnailPath:    thumbPath,
+		FileSize:         staged.Size,
 		Status:           "completed_sync", // 使用不同的状态来标识这些记录
 	}
 	result := store.DB.Create(&imageRecord)
@@ -137,6 +355,9 @@ func UploadImageSyncHandlerForTest(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "无法保存文件信息到数据库"})
 		return
 	}
+	if err := services.AdjustUsage(store.DB, imageRecord.UserID, imageRecord.FileSize, 1); err != nil {
+		log.Printf("同步测试错误：更新用户 %d 的配额用量失败: %v", imageRecord.UserID, err)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "文件上传并处理成功！(同步)",
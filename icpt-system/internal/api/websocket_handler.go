@@ -45,8 +45,8 @@ func NotifyTestHandler(c *gin.Context) {
 		return
 	}
 
-	// 发送测试通知
-	websocket.GlobalHub.NotifyUser(uint(userID), websocket.SystemNotice, map[string]interface{}{
+	// 发送测试通知（经Redis转发，用户连接在任一服务器实例上都能收到）
+	websocket.GlobalPublisher.NotifyUser(uint(userID), websocket.SystemNotice, map[string]interface{}{
 		"title":   "测试通知",
 		"message": "这是一条测试消息",
 		"type":    "info",
@@ -3,6 +3,7 @@ package config
 import (
 	"log"
 	"os"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -32,17 +33,120 @@ type Config struct {
 		DB       int    `yaml:"db"`
 	} `yaml:"redis"`
 	JWT struct {
-		SecretKey   string `yaml:"secret_key"`
-		ExpireHours int    `yaml:"expire_hours"`
+		SecretKey     string `yaml:"secret_key"`
+		ExpireHours   int    `yaml:"expire_hours"`   // 旧配置，未设置 access_minutes 时作为访问令牌有效期
+		AccessMinutes int    `yaml:"access_minutes"` // 访问令牌有效期（分钟）
+		RefreshDays   int    `yaml:"refresh_days"`   // 刷新令牌有效期（天），每次刷新都会轮换
 	} `yaml:"jwt"`
 	Performance struct {
-		WorkerCount          int  `yaml:"worker_count"`           // Worker进程数量
-		MaxRequestSize       int  `yaml:"max_request_size"`       // 最大请求大小（MB）
-		EnableGzip           bool `yaml:"enable_gzip"`            // 启用Gzip压缩
-		EnableFileCache      bool `yaml:"enable_file_cache"`      // 启用文件缓存
-		EnableConcurrency    bool `yaml:"enable_concurrency"`     // 启用并发处理
-		MaxConcurrentUploads int  `yaml:"max_concurrent_uploads"` // 最大并发上传数
+		WorkerCount          int    `yaml:"worker_count"`           // Worker进程数量
+		MaxRequestSize       int    `yaml:"max_request_size"`       // 最大请求大小（MB）
+		EnableGzip           bool   `yaml:"enable_gzip"`            // 启用Gzip压缩
+		EnableFileCache      bool   `yaml:"enable_file_cache"`      // 启用文件缓存
+		EnableConcurrency    bool   `yaml:"enable_concurrency"`     // 启用并发处理
+		MaxConcurrentUploads int    `yaml:"max_concurrent_uploads"` // 最大并发上传数
+		ImageProcessor       string `yaml:"image_processor"`        // 图像处理器: auto / opencv / go
 	} `yaml:"performance"`
+	Queue struct {
+		VisibilityTimeout int `yaml:"visibility_timeout"` // 任务租约时长（秒），超时未确认的任务会被重新投递
+		ReapInterval      int `yaml:"reap_interval"`      // 回收过期租约的间隔（秒）
+		MaxAttempts       int `yaml:"max_attempts"`       // 最多尝试次数，超过后任务进入死信队列
+		RetryBaseDelay    int `yaml:"retry_base_delay"`   // 第一次重试前的等待时间（秒），之后指数增长
+		RetryMaxDelay     int `yaml:"retry_max_delay"`    // 重试等待时间上限（秒）
+	} `yaml:"queue"`
+	Upload struct {
+		ChunkSize  int `yaml:"chunk_size"`  // 分片上传每个分片的最大大小（MB）
+		SessionTTL int `yaml:"session_ttl"` // 分片上传会话在没有新分片时的有效期（小时）
+
+		MaxFileSize    int      `yaml:"max_file_size"`   // 单个文件最大大小（MB）
+		MaxPixels      int      `yaml:"max_pixels"`      // 图片最大像素数（百万像素），防止解压炸弹
+		AllowedFormats []string `yaml:"allowed_formats"` // 允许上传的格式（按文件内容识别）: jpeg / png / gif
+	} `yaml:"upload"`
+	Quota struct {
+		MaxStorage int `yaml:"max_storage"` // 每个用户默认的存储空间上限（MB），0表示不限制
+		MaxImages  int `yaml:"max_images"`  // 每个用户默认的图片数量上限，0表示不限制
+	} `yaml:"quota"`
+	Privacy struct {
+		StoreGPS      bool `yaml:"store_gps"`      // 是否在 image_metadata 中保存GPS位置
+		StripMetadata bool `yaml:"strip_metadata"` // 返回原图时去除EXIF/XMP/IPTC等元数据（保留方向标记）
+	} `yaml:"privacy"`
+	Mail struct {
+		Driver  string `yaml:"driver"`   // 邮件后端: log(写入日志) / file(写入目录) / smtp
+		From    string `yaml:"from"`     // 发件人
+		FileDir string `yaml:"file_dir"` // file 后端保存邮件的目录
+		SMTP    struct {
+			Host     string `yaml:"host"`
+			Port     int    `yaml:"port"`
+			Username string `yaml:"username"` // 留空时不进行认证
+			Password string `yaml:"password"`
+		} `yaml:"smtp"`
+	} `yaml:"mail"`
+	PasswordReset struct {
+		Expiry int    `yaml:"expiry"` // 重置链接有效期（分钟）
+		URL    string `yaml:"url"`    // 前端重置密码页面地址，令牌作为 token 参数附加，留空时为 public_host + /reset-password
+	} `yaml:"password_reset"`
+	RateLimit struct {
+		Availability RateLimitRule `yaml:"availability"` // 用户名/邮箱可用性检查，按客户端IP限制
+		Auth         RateLimitRule `yaml:"auth"`         // 注册、登录、刷新令牌、找回密码等认证接口
+		Upload       RateLimitRule `yaml:"upload"`       // 上传图片和创建分片上传会话
+		List         RateLimitRule `yaml:"list"`         // 图像列表、详情和统计等查询接口
+	} `yaml:"rate_limit"`
+	LoginProtection struct {
+		FailureWindow  int `yaml:"failure_window"`  // 失败次数的统计窗口（分钟）
+		DelayAfter     int `yaml:"delay_after"`     // 同一账户连续失败达到该次数后，每次重试前需要等待
+		MaxDelay       int `yaml:"max_delay"`       // 重试等待时间的上限（秒），从2秒开始逐次翻倍
+		MaxFailures    int `yaml:"max_failures"`    // 同一账户失败达到该次数后锁定，0表示不锁定
+		MaxIPFailures  int `yaml:"max_ip_failures"` // 同一IP失败达到该次数后禁止其登录，0表示不限制
+		LockoutMinutes int `yaml:"lockout_minutes"` // 锁定时长（分钟）
+	} `yaml:"login_protection"`
+	TwoFactor struct {
+		Issuer           string `yaml:"issuer"`            // 验证器应用中显示的服务名称
+		ChallengeMinutes int    `yaml:"challenge_minutes"` // 两步登录挑战令牌的有效期（分钟）
+	} `yaml:"two_factor"`
+	Admin struct {
+		Usernames []string `yaml:"usernames"` // 启动时设为管理员的用户名，用于创建第一个管理员
+	} `yaml:"admin"`
+	Storage struct {
+		Driver          string `yaml:"driver"`            // 存储后端: local / s3
+		SignedURLExpiry int    `yaml:"signed_url_expiry"` // 签名URL有效期（秒）
+		SigningKey      string `yaml:"signing_key"`       // 本地存储签名URL的HMAC密钥，留空时使用JWT密钥
+		Local           struct {
+			Root    string `yaml:"root"`     // 文件根目录
+			BaseURL string `yaml:"base_url"` // 文件访问地址，留空时为 public_host + /static
+		} `yaml:"local"`
+		S3 struct {
+			Endpoint  string `yaml:"endpoint"`   // 如 s3.amazonaws.com、localhost:9000 (MinIO)
+			Region    string `yaml:"region"`     // 区域
+			Bucket    string `yaml:"bucket"`     // 存储桶
+			AccessKey string `yaml:"access_key"` // 访问密钥ID
+			SecretKey string `yaml:"secret_key"` // 访问密钥
+			UseSSL    bool   `yaml:"use_ssl"`    // 是否使用HTTPS
+			PathStyle bool   `yaml:"path_style"` // 使用路径风格URL（MinIO通常需要）
+		} `yaml:"s3"`
+	} `yaml:"storage"`
+	Renditions []Rendition `yaml:"renditions"` // 每张图片预生成的衍生图规格
+	Render     struct {
+		CacheDir       string   `yaml:"cache_dir"`       // 按需渲染结果的缓存目录
+		Sizes          []string `yaml:"sizes"`           // 允许的尺寸（宽x高，0表示按另一边等比缩放）
+		Qualities      []int    `yaml:"qualities"`       // 允许的JPEG质量
+		DefaultQuality int      `yaml:"default_quality"` // 未指定q时使用的JPEG质量
+	} `yaml:"render"`
+}
+
+// Rendition 一种衍生图（缩略图、中图、大图等）的规格
+type Rendition struct {
+	Name    string `yaml:"name"`    // 名称，如 thumbnail、medium、large
+	Width   int    `yaml:"width"`   // 目标宽度，0表示按高度等比缩放
+	Height  int    `yaml:"height"`  // 目标高度，0表示按宽度等比缩放
+	Fit     string `yaml:"fit"`     // 缩放方式: contain(完整放入框内) / cover(填满并裁剪)
+	Format  string `yaml:"format"`  // 输出格式: jpeg / png / webp
+	Quality int    `yaml:"quality"` // JPEG质量 (1-100)，webp为无损编码时忽略
+}
+
+// RateLimitRule 限流规则：每个调用方每 Window 秒最多 Limit 次请求，额度随时间均匀恢复，Limit 为0表示不限制
+type RateLimitRule struct {
+	Limit  int `yaml:"limit"`  // 窗口内允许的请求数，也是允许的最大突发请求数
+	Window int `yaml:"window"` // 窗口长度（秒）
 }
 
 var Cfg *Config
@@ -64,6 +168,13 @@ func LoadConfig(configPath string) {
 		log.Fatalf("错误: 解析配置文件失败: %v", err)
 	}
 
+	// WebP编码器是无损的，配置的质量不会生效
+	for _, r := range config.Renditions {
+		if strings.EqualFold(r.Format, "webp") && r.Quality != 0 {
+			log.Printf("警告: 衍生图 %s 为WebP格式（无损编码），quality: %d 将被忽略", r.Name, r.Quality)
+		}
+	}
+
 	// 将解析后的配置赋值给全局变量 Cfg，方便项目其他地方使用
 	Cfg = &config
 	log.Println("配置文件加载成功！")
@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LogMailer 把邮件内容写入日志，用于本地开发
+type LogMailer struct{}
+
+// Send 实现 Mailer 接口
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("📧 邮件 To: %s Subject: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer 把每封邮件保存为目录下的 .eml 文件，用于本地测试
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// Send 实现 Mailer 接口
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102150405.000000"), sanitizeAddress(msg.To))
+	return os.WriteFile(filepath.Join(m.Dir, name), buildMessage(m.From, msg), 0o600)
+}
+
+// sanitizeAddress 把邮件地址转换为可以用作文件名的字符串
+func sanitizeAddress(addr string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_', r == '@':
+			return r
+		}
+		return '_'
+	}, addr)
+}
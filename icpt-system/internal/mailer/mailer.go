@@ -0,0 +1,55 @@
+// Package mailer 定义邮件发送后端
+// 本地开发使用 log 或 file 后端，邮件内容写入日志或文件，不需要真实的邮件服务器
+package mailer
+
+import (
+	"context"
+	"log"
+
+	"icpt-system/internal/config"
+)
+
+// Message 一封纯文本邮件
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer 邮件发送后端
+type Mailer interface {
+	// Send 发送邮件，返回前邮件已交给发送后端
+	Send(ctx context.Context, msg Message) error
+}
+
+// Default 全局邮件后端，由 InitMailer 按配置创建
+var Default Mailer
+
+// InitMailer 按配置初始化邮件后端
+func InitMailer() {
+	c := config.Cfg.Mail
+
+	switch c.Driver {
+	case "", "log":
+		Default = &LogMailer{}
+		log.Println("邮件发送: 写入日志")
+	case "file":
+		dir := c.FileDir
+		if dir == "" {
+			dir = "logs/mail"
+		}
+		Default = &FileMailer{Dir: dir, From: c.From}
+		log.Printf("邮件发送: 写入目录 %s", dir)
+	case "smtp":
+		Default = &SMTPMailer{
+			Host:     c.SMTP.Host,
+			Port:     c.SMTP.Port,
+			Username: c.SMTP.Username,
+			Password: c.SMTP.Password,
+			From:     c.From,
+		}
+		log.Printf("邮件发送: SMTP %s:%d", c.SMTP.Host, c.SMTP.Port)
+	default:
+		log.Fatalf("错误: 未知的邮件后端: %s", c.Driver)
+	}
+}
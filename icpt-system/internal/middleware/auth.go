@@ -1,28 +1,75 @@
 package middleware
 
 import (
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"icpt-system/internal/models"
 	"icpt-system/internal/services"
 )
 
-// AuthMiddleware JWT认证中间件
+// bearerToken 返回 Authorization 头部中的 Bearer 令牌
+func bearerToken(c *gin.Context) string {
+	parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+	if len(parts) == 2 && parts[0] == "Bearer" {
+		return parts[1]
+	}
+	return ""
+}
+
+// apiKeyFromRequest 返回请求携带的API密钥：X-API-Key 头部，或带 icpt_ 前缀的 Bearer 令牌
+// API密钥长期有效，不接受通过查询参数传递，避免写入访问日志
+func apiKeyFromRequest(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	if token := bearerToken(c); services.IsAPIKey(token) {
+		return token
+	}
+	return ""
+}
+
+// setAPIKeyIdentity 将通过API密钥认证的用户信息存储到上下文中
+func setAPIKeyIdentity(c *gin.Context, identity *services.APIKeyIdentity) {
+	c.Set("user_id", identity.User.ID)
+	c.Set("username", identity.User.Username)
+	c.Set("role", identity.User.Role)
+	c.Set("api_key", identity.Key)
+}
+
+// AuthMiddleware 认证中间件，接受JWT访问令牌或API密钥
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var token string
-
-		// 首先尝试从Authorization头部获取token
-		authHeader := c.GetHeader("Authorization")
-		if authHeader != "" {
-			// Bearer token 格式验证
-			parts := strings.SplitN(authHeader, " ", 2)
-			if len(parts) == 2 && parts[0] == "Bearer" {
-				token = parts[1]
+		// API密钥认证
+		if key := apiKeyFromRequest(c); key != "" {
+			identity, err := services.AuthenticateAPIKey(key)
+			if err == services.ErrAPIKeyInvalid {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error": "API密钥无效或已过期",
+					"code":  "INVALID_API_KEY",
+				})
+				c.Abort()
+				return
+			}
+			if err != nil {
+				log.Printf("校验API密钥失败: %v", err)
+				c.JSON(http.StatusServiceUnavailable, gin.H{
+					"error": "认证服务暂时不可用",
+					"code":  "AUTH_UNAVAILABLE",
+				})
+				c.Abort()
+				return
 			}
+			setAPIKeyIdentity(c, identity)
+			c.Next()
+			return
 		}
 
+		// 首先尝试从Authorization头部获取token
+		token := bearerToken(c)
+
 		// 如果Authorization头部没有token，尝试从查询参数获取（用于WebSocket）
 		if token == "" {
 			token = c.Query("token")
@@ -49,28 +96,62 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// 检查令牌是否已登出
+		revoked, err := services.IsAccessTokenRevoked(c.Request.Context(), claims)
+		if err != nil {
+			log.Printf("查询令牌黑名单失败: %v", err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "认证服务暂时不可用",
+				"code":  "AUTH_UNAVAILABLE",
+			})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "认证令牌已失效",
+				"code":  "TOKEN_REVOKED",
+			})
+			c.Abort()
+			return
+		}
+
 		// 将用户信息存储到上下文中
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
+		c.Set("role", roleOf(claims))
+		c.Set("token_claims", claims)
 		c.Next()
 	}
 }
 
 // OptionalAuthMiddleware 可选认证中间件
 // 如果有token则验证，没有则继续，主要用于一些可选认证的接口
+// API密钥只有具备 read 权限时才视为已认证
 func OptionalAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader != "" {
-			parts := strings.SplitN(authHeader, " ", 2)
-			if len(parts) == 2 && parts[0] == "Bearer" {
-				claims, err := services.ValidateToken(parts[1])
-				if err == nil {
-					c.Set("user_id", claims.UserID)
-					c.Set("username", claims.Username)
+		if key := apiKeyFromRequest(c); key != "" {
+			identity, err := services.AuthenticateAPIKey(key)
+			if err == nil && identity.Key.HasScope(models.ScopeRead) {
+				setAPIKeyIdentity(c, identity)
+			}
+			c.Next()
+			return
+		}
+
+		if token := bearerToken(c); token != "" {
+			claims, err := services.ValidateToken(token)
+			if err == nil {
+				// 已登出的令牌按未认证处理
+				if revoked, err := services.IsAccessTokenRevoked(c.Request.Context(), claims); err != nil || revoked {
+					c.Next()
+					return
 				}
+				c.Set("user_id", claims.UserID)
+				c.Set("username", claims.Username)
+				c.Set("role", roleOf(claims))
 			}
 		}
 		c.Next()
 	}
-} 
\ No newline at end of file
+}
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"icpt-system/internal/config"
+	"icpt-system/internal/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// useRedis 让 store.Rdb 使用指定的Redis
+func useRedis(t *testing.T, addr string) {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1})
+	previous := store.Rdb
+	store.Rdb = client
+	t.Cleanup(func() {
+		store.Rdb = previous
+		client.Close()
+	})
+}
+
+// newRateLimitRouter 返回只有一个限流接口的路由
+func newRateLimitRouter(name string, rule config.RateLimitRule) *gin.Engine {
+	r := gin.New()
+	r.GET("/", RateLimitMiddleware(name, rule), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return r
+}
+
+// doRequest 以固定的客户端IP发送一次请求
+func doRequest(r *gin.Engine) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCeilSeconds(t *testing.T) {
+	for _, tt := range []struct{ us, want int64 }{
+		{0, 0},
+		{1, 1},
+		{999999, 1},
+		{1000000, 1},
+		{1000001, 2},
+		{20000000, 20},
+	} {
+		if got := ceilSeconds(tt.us); got != tt.want {
+			t.Errorf("ceilSeconds(%d) = %d, want %d", tt.us, got, tt.want)
+		}
+	}
+}
+
+// TestRateLimitDisabled limit 为0时不限流，也不访问Redis
+func TestRateLimitDisabled(t *testing.T) {
+	useRedis(t, "127.0.0.1:1")
+	r := newRateLimitRouter("test", config.RateLimitRule{Limit: 0, Window: 60})
+	for i := 0; i < 3; i++ {
+		w := doRequest(r)
+		if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+			t.Fatalf("第 %d 次请求: code = %d, RateLimit-Limit = %q", i+1, w.Code, w.Header().Get("RateLimit-Limit"))
+		}
+	}
+}
+
+// TestRateLimitFailOpen Redis不可用时放行请求
+func TestRateLimitFailOpen(t *testing.T) {
+	useRedis(t, "127.0.0.1:1")
+	r := newRateLimitRouter("test", config.RateLimitRule{Limit: 1, Window: 60})
+	for i := 0; i < 3; i++ {
+		if w := doRequest(r); w.Code != http.StatusOK {
+			t.Fatalf("第 %d 次请求: code = %d, want 200", i+1, w.Code)
+		}
+	}
+}
+
+// TestRateLimitGCRA 在真实Redis上运行限流脚本，检查突发额度、剩余次数和等待时间
+// 需要设置 ICPT_TEST_REDIS_ADDR（如 localhost:6379），否则跳过
+func TestRateLimitGCRA(t *testing.T) {
+	addr := os.Getenv("ICPT_TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("未设置 ICPT_TEST_REDIS_ADDR，跳过需要Redis的测试")
+	}
+	useRedis(t, addr)
+
+	// 每60秒3次：请求间隔20秒，可以一次性用完3次
+	name := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	t.Cleanup(func() { store.Rdb.Del(store.Ctx, rateLimitPrefix+name+":ip:192.0.2.1") })
+	r := newRateLimitRouter(name, config.RateLimitRule{Limit: 3, Window: 60})
+
+	for i := 1; i <= 3; i++ {
+		w := doRequest(r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("突发额度内第 %d 次请求: code = %d, want 200", i, w.Code)
+		}
+		if got := w.Header().Get("RateLimit-Remaining"); got != strconv.Itoa(3-i) {
+			t.Errorf("第 %d 次请求: RateLimit-Remaining = %s, want %d", i, got, 3-i)
+		}
+		if got := w.Header().Get("RateLimit-Reset"); got != strconv.Itoa(20*i) {
+			t.Errorf("第 %d 次请求: RateLimit-Reset = %s, want %d", i, got, 20*i)
+		}
+		if got := w.Header().Get("RateLimit-Policy"); got != "3;w=60" {
+			t.Errorf("RateLimit-Policy = %s, want 3;w=60", got)
+		}
+	}
+
+	w := doRequest(r)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("超出额度: code = %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "20" {
+		t.Errorf("Retry-After = %s, want 20", got)
+	}
+	if got := w.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("超出额度: RateLimit-Remaining = %s, want 0", got)
+	}
+	if got := w.Header().Get("RateLimit-Reset"); got != "60" {
+		t.Errorf("超出额度: RateLimit-Reset = %s, want 60", got)
+	}
+}
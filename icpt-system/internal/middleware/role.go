@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"icpt-system/internal/models"
+	"icpt-system/internal/services"
+)
+
+// roleOf 返回令牌中的角色，引入角色之前签发的令牌按普通用户处理
+func roleOf(claims *services.JWTClaims) string {
+	if claims.Role == "" {
+		return models.RoleUser
+	}
+	return claims.Role
+}
+
+// RequireRole 角色权限中间件
+// 必须放在 AuthMiddleware 之后使用，只允许令牌中的角色属于 roles 的用户访问
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+
+		for _, allowed := range roles {
+			if role != "" && role == allowed {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "权限不足",
+			"code":  "FORBIDDEN",
+		})
+		c.Abort()
+	}
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"icpt-system/internal/models"
+)
+
+// apiKeyOf 返回当前请求使用的API密钥，通过JWT登录时返回 nil
+func apiKeyOf(c *gin.Context) *models.APIKey {
+	if v, ok := c.Get("api_key"); ok {
+		return v.(*models.APIKey)
+	}
+	return nil
+}
+
+// RequireScope API密钥权限中间件
+// 必须放在 AuthMiddleware 之后使用；通过JWT登录的会话拥有全部权限，API密钥必须包含 scope
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key := apiKeyOf(c); key != nil && !key.HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "API密钥没有此操作的权限",
+				"code":  "INSUFFICIENT_SCOPE",
+				"scope": scope,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSession 只允许通过JWT登录的会话访问，用于账户设置、密钥管理和管理接口
+// 防止泄露的API密钥被用来创建新密钥或修改密码
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if apiKeyOf(c) != nil {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "此操作需要登录，不能使用API密钥",
+				"code":  "SESSION_REQUIRED",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
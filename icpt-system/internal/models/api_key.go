@@ -0,0 +1,68 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// API密钥的权限范围
+const (
+	ScopeUpload = "upload" // 上传图片
+	ScopeRead   = "read"   // 查询图片、下载衍生图
+	ScopeDelete = "delete" // 删除图片
+)
+
+// APIKeyPrefix 所有API密钥的固定前缀，AuthMiddleware 据此区分API密钥和JWT
+const APIKeyPrefix = "icpt_"
+
+// APIKey 结构体对应 'api_keys' 表，供脚本和命令行客户端长期使用
+// 数据库中只保存密钥的SHA-256，原文只在创建时返回一次
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"-"`
+	Name       string     `gorm:"type:varchar(100);not null" json:"name"`
+	Prefix     string     `gorm:"type:varchar(16);not null" json:"prefix"`     // 密钥开头几位，便于用户在列表中辨认
+	KeyHash    string     `gorm:"type:char(64);not null;uniqueIndex" json:"-"` // 密钥SHA-256（十六进制）
+	Scopes     string     `gorm:"type:varchar(100);not null" json:"-"`         // 逗号分隔的权限范围
+	ExpiresAt  *time.Time `json:"expires_at"`                                  // 为空表示永不过期
+	LastUsedAt *time.Time `json:"last_used_at"`                                // 最近一次通过认证的时间
+	RevokedAt  *time.Time `gorm:"index" json:"revoked_at,omitempty"`           // 撤销后设置
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName 指定了此模型对应的数据库表名
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// ScopeList 返回密钥的权限范围列表
+func (k *APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+// HasScope 判断密钥是否拥有指定权限
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAPIKeyRequest 创建API密钥请求
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1,dive,oneof=upload read delete"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"omitempty,min=1,max=3650"` // 0 表示永不过期
+}
+
+// APIKeyResponse API密钥信息，Key 只在创建时返回
+type APIKeyResponse struct {
+	*APIKey
+	Scopes []string `json:"scopes"`
+	Key    string   `json:"key,omitempty"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Blob 结构体对应 'blobs' 表，按内容SHA-256存储的原图文件
+// 多个 Image 记录可以引用同一个 Blob，RefCount 为0时删除文件
+type Blob struct {
+	ID          uint      `gorm:"primaryKey"`
+	Hash        string    `gorm:"type:char(64);not null;uniqueIndex"` // 内容SHA-256（十六进制）
+	StoragePath string    `gorm:"type:varchar(1024);not null"`
+	Size        int64     `gorm:"type:bigint;not null"`
+	RefCount    int       `gorm:"not null;default:0"` // 引用该文件的图片数
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+}
+
+// TableName 指定了此模型对应的数据库表名
+func (Blob) TableName() string {
+	return "blobs"
+}
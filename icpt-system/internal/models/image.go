@@ -5,13 +5,17 @@ import "time"
 // Image 结构体对应 'images' 表
 type Image struct {
 	ID               uint       `gorm:"primaryKey"`
-	UserID           uint       `gorm:"index"`
+	UserID           uint       `gorm:"index;index:idx_user_content,priority:1"`
 	OriginalFilename string     `gorm:"type:varchar(255);not null"`
-	StoragePath      string     `gorm:"type:varchar(1024);not null"`
-	ThumbnailPath    string     `gorm:"type:varchar(1024)"`
+	StoragePath      string     `gorm:"type:varchar(1024);not null" json:"-"`            // 存储键不返回给客户端，访问使用签名URL
+	ContentHash      string     `gorm:"type:char(64);index:idx_user_content,priority:2"` // 上传内容的SHA-256，对应 Blob.Hash
+	ThumbnailPath    string     `gorm:"type:varchar(1024)" json:"-"`
 	Status           string     `gorm:"type:varchar(50);not null;default:'processing'"` // <-- 新增
 	ErrorInfo        string     `gorm:"type:text"`                                      // <-- 新增
 	FileSize         int64      `gorm:"type:bigint;default:0"`                          // <-- 新增文件大小字段
+	OriginalSize     int64      `gorm:"type:bigint;default:0"`                          // 上传时的原始大小
+	OptimizedSize    int64      `gorm:"type:bigint;default:0"`                          // 优化后的大小，0表示未优化
+	RawOriginalPath  string     `gorm:"type:varchar(1024)" json:"-"`                    // 优化时保留的未压缩原图
 	ProcessedAt      *time.Time `gorm:"index"`                                          // <-- 新增处理完成时间字段
 	CreatedAt        time.Time  `gorm:"autoCreateTime"`
 }
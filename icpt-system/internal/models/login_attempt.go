@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// 登录尝试的结果
+const (
+	LoginSucceeded          = "success"
+	LoginInvalidCredentials = "invalid_credentials"
+	LoginAccountDisabled    = "account_disabled"
+	LoginThrottled          = "throttled"    // 重试过快，被要求等待
+	LoginLocked             = "locked"       // 账户或IP被临时锁定
+	LoginTwoFactorRequired  = "2fa_required" // 密码正确，等待提交两步验证码
+	LoginInvalidOTP         = "invalid_otp"  // 两步验证码或恢复码错误
+)
+
+// LoginAttempt 结构体对应 'login_attempts' 表，记录每次登录尝试用于安全审计
+// 用户名不存在的尝试 UserID 为空，只保存提交的登录名
+type LoginAttempt struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    *uint     `gorm:"index:idx_login_user_time,priority:1" json:"-"`
+	Login     string    `gorm:"type:varchar(255);not null" json:"-"` // 提交的用户名或邮箱
+	Success   bool      `gorm:"not null" json:"success"`
+	Result    string    `gorm:"type:varchar(30);not null" json:"result"`
+	IP        string    `gorm:"type:varchar(45);index" json:"ip"`
+	UserAgent string    `gorm:"type:varchar(255)" json:"user_agent"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index:idx_login_user_time,priority:2" json:"created_at"`
+}
+
+// TableName 指定了此模型对应的数据库表名
+func (LoginAttempt) TableName() string {
+	return "login_attempts"
+}
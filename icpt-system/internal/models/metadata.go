@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// ImageMetadata 结构体对应 'image_metadata' 表，记录从EXIF中提取的图片信息
+type ImageMetadata struct {
+	ID          uint       `gorm:"primaryKey"`
+	ImageID     uint       `gorm:"not null;uniqueIndex"`
+	CameraMake  string     `gorm:"type:varchar(100)"` // 相机厂商
+	CameraModel string     `gorm:"type:varchar(100)"` // 相机型号
+	LensModel   string     `gorm:"type:varchar(100)"` // 镜头型号
+	TakenAt     *time.Time `gorm:"index"`             // 拍摄时间
+	Width       int        `gorm:"not null"`          // 转正后的宽度
+	Height      int        `gorm:"not null"`          // 转正后的高度
+	Orientation int        `gorm:"not null;default:1"`
+	Latitude    *float64   // GPS纬度，未记录或已按隐私配置丢弃时为空
+	Longitude   *float64   // GPS经度
+	CreatedAt   time.Time  `gorm:"autoCreateTime"`
+	UpdatedAt   time.Time  `gorm:"autoUpdateTime"`
+}
+
+// TableName 指定了此模型对应的数据库表名
+func (ImageMetadata) TableName() string {
+	return "image_metadata"
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// PasswordResetToken 结构体对应 'password_reset_tokens' 表，数据库中只保存令牌的SHA-256
+// 令牌只能使用一次，使用后设置 UsedAt
+type PasswordResetToken struct {
+	ID        uint       `gorm:"primaryKey"`
+	UserID    uint       `gorm:"not null;index"`
+	TokenHash string     `gorm:"type:char(64);not null;uniqueIndex"` // 令牌SHA-256（十六进制）
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time // 重置成功或被新的重置请求取代时设置
+	CreatedAt time.Time  `gorm:"autoCreateTime"`
+}
+
+// TableName 指定了此模型对应的数据库表名
+func (PasswordResetToken) TableName() string {
+	return "password_reset_tokens"
+}
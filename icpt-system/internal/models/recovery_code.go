@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// RecoveryCode 结构体对应 'recovery_codes' 表，两步验证的一次性恢复码，只保存SHA-256
+// 丢失验证器时可用恢复码代替验证码登录，使用后设置 UsedAt
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey"`
+	UserID    uint       `gorm:"not null;index"`
+	CodeHash  string     `gorm:"type:char(64);not null;uniqueIndex"` // 规范化后的恢复码SHA-256（十六进制）
+	UsedAt    *time.Time // 使用后设置
+	CreatedAt time.Time  `gorm:"autoCreateTime"`
+}
+
+// TableName 指定了此模型对应的数据库表名
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
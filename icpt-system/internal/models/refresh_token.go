@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// RefreshToken 结构体对应 'refresh_tokens' 表，数据库中只保存令牌的SHA-256
+// 每次刷新都会作废当前令牌并签发同一 FamilyID 下的新令牌；
+// 已作废的令牌再次出现说明可能被盗用，此时整组令牌都会被作废
+type RefreshToken struct {
+	ID         uint       `gorm:"primaryKey"`
+	UserID     uint       `gorm:"not null;index"`
+	TokenHash  string     `gorm:"type:char(64);not null;uniqueIndex"` // 令牌SHA-256（十六进制）
+	FamilyID   string     `gorm:"type:char(32);not null;index"`       // 同一次登录轮换出的令牌共用
+	ExpiresAt  time.Time  `gorm:"not null"`
+	RevokedAt  *time.Time // 轮换、登出或检测到重复使用时设置
+	ReplacedBy *uint      // 轮换后签发的新令牌ID
+	CreatedAt  time.Time  `gorm:"autoCreateTime"`
+}
+
+// TableName 指定了此模型对应的数据库表名
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// ImageRendition 结构体对应 'image_renditions' 表，记录图片的各尺寸衍生图
+type ImageRendition struct {
+	ID          uint      `gorm:"primaryKey"`
+	ImageID     uint      `gorm:"not null;uniqueIndex:idx_image_rendition"`
+	Name        string    `gorm:"type:varchar(50);not null;uniqueIndex:idx_image_rendition"` // thumbnail, medium, large ...
+	Width       int       `gorm:"not null"`
+	Height      int       `gorm:"not null"`
+	Format      string    `gorm:"type:varchar(20);not null"` // jpeg, png, webp
+	StoragePath string    `gorm:"type:varchar(1024);not null"`
+	FileSize    int64     `gorm:"type:bigint;default:0"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+}
+
+// TableName 指定了此模型对应的数据库表名
+func (ImageRendition) TableName() string {
+	return "image_renditions"
+}
@@ -12,10 +12,43 @@ type User struct {
 	Email        string    `gorm:"type:varchar(255);not null;unique" json:"email"`
 	PasswordHash string    `gorm:"type:varchar(255);not null" json:"-"` // 不在JSON中显示密码
 	Status       string    `gorm:"type:varchar(50);not null;default:'active'" json:"status"` // active, inactive, banned
+	Role         string    `gorm:"type:varchar(20);not null;default:'user'" json:"role"`     // user, admin
+
+	// 上传设置：上传时未指定则使用这里的默认值
+	OptimizeOriginals bool   `gorm:"not null;default:false" json:"optimize_originals"`                   // 是否优化（缩小并重新编码）原图
+	OptimizePreset    string `gorm:"type:varchar(20);not null;default:'default'" json:"optimize_preset"` // 压缩预设: default, high_quality, thumbnail
+	KeepRawOriginal   bool   `gorm:"not null;default:false" json:"keep_raw_original"`                    // 优化后是否保留未压缩的原图
+
+	// 两步验证（TOTP）：TOTPSecret 在开始绑定时生成，确认验证码后 TwoFactorEnabled 才为 true
+	TOTPSecret       string `gorm:"type:varchar(64)" json:"-"`               // Base32编码的TOTP密钥
+	TOTPLastStep     int64  `gorm:"type:bigint;not null;default:0" json:"-"` // 最近一次使用的时间步，防止验证码重放
+	TwoFactorEnabled bool   `gorm:"not null;default:false" json:"two_factor_enabled"`
+
+	// 配额：为空时使用配置中的默认值，0表示不限制
+	MaxStorageBytes *int64 `gorm:"type:bigint" json:"-"`
+	MaxImages       *int64 `gorm:"type:bigint" json:"-"`
+
+	// 用量计数：上传、删除图片和生成衍生图时更新，通过 quota 字段返回
+	StorageUsed int64 `gorm:"type:bigint;not null;default:0" json:"-"` // 原图和衍生图占用的字节数
+	ImageCount  int64 `gorm:"type:bigint;not null;default:0" json:"-"`
+
 	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt    time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
+// 用户角色
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// 用户状态，只有 active 状态的用户可以登录
+const (
+	StatusActive   = "active"
+	StatusInactive = "inactive"
+	StatusBanned   = "banned"
+)
+
 // TableName 指定了此模型对应的数据库表名
 func (User) TableName() string {
 	return "users"
@@ -44,14 +77,96 @@ type RegisterRequest struct {
 	Password string `json:"password" binding:"required,min=6"`
 }
 
+// CheckUsernameRequest 用户名可用性检查请求，校验规则与 RegisterRequest 相同
+type CheckUsernameRequest struct {
+	Username string `form:"username" binding:"required,min=3,max=20"`
+}
+
+// CheckEmailRequest 邮箱可用性检查请求，校验规则与 RegisterRequest 相同
+type CheckEmailRequest struct {
+	Email string `form:"email" binding:"required,email"`
+}
+
 // LoginRequest 用户登录请求结构
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
 
+// UploadSettingsRequest 更新上传设置请求结构，未提供的字段保持不变
+type UploadSettingsRequest struct {
+	OptimizeOriginals *bool   `json:"optimize_originals"`
+	OptimizePreset    *string `json:"optimize_preset"`
+	KeepRawOriginal   *bool   `json:"keep_raw_original"`
+}
+
+// QuotaRequest 管理员修改用户配额的请求结构，未提供的字段保持不变
+// 0表示不限制，-1表示恢复为配置中的默认值
+type QuotaRequest struct {
+	MaxStorageBytes *int64 `json:"max_storage_bytes"`
+	MaxImages       *int64 `json:"max_images"`
+}
+
+// ChangePasswordRequest 修改密码请求结构
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=6"`
+}
+
+// ForgotPasswordRequest 找回密码请求结构
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest 重置密码请求结构
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+// RefreshRequest 刷新令牌和登出请求结构
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TwoFactorCodeRequest 确认绑定两步验证、重新生成恢复码的请求结构
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"` // 验证器应用中的6位验证码
+}
+
+// DisableTwoFactorRequest 关闭两步验证的请求结构
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"` // 验证码或恢复码
+}
+
+// TwoFactorVerifyRequest 两步登录第二步的请求结构
+type TwoFactorVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"` // 验证码或恢复码
+}
+
+// TwoFactorChallenge 开启两步验证的用户密码验证通过后返回，用于提交验证码
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int64  `json:"expires_in"` // 挑战令牌有效期（秒）
+}
+
+// UserStatusRequest 管理员修改用户状态的请求结构
+type UserStatusRequest struct {
+	Status string `json:"status" binding:"required,oneof=active inactive banned"`
+}
+
+// UserRoleRequest 管理员修改用户角色的请求结构
+type UserRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=user admin"`
+}
+
 // AuthResponse 认证响应结构
 type AuthResponse struct {
-	User  *User  `json:"user"`
-	Token string `json:"token"`
+	User         *User  `json:"user"`
+	Token        string `json:"token"`         // 访问令牌
+	RefreshToken string `json:"refresh_token"` // 刷新令牌，用于 /auth/refresh 换取新令牌
+	ExpiresIn    int64  `json:"expires_in"`    // 访问令牌有效期（秒）
 }
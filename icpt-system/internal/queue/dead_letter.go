@@ -0,0 +1,194 @@
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrDeadLetterNotFound 死信不存在
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// requeueDeadLetterScript 删除死信并将任务放回主队列，死信已被其他请求处理时返回0
+var requeueDeadLetterScript = redis.NewScript(`
+if redis.call('HDEL', KEYS[1], ARGV[1]) == 1 then
+	redis.call('ZREM', KEYS[2], ARGV[1])
+	redis.call('RPUSH', KEYS[3], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// DeadLetter 多次重试仍失败、不再自动处理的任务
+type DeadLetter struct {
+	ID       string    `json:"id"`
+	Payload  string    `json:"payload"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// deadKey 返回保存死信内容的哈希表名称 (id -> JSON)
+func (q *Queue) deadKey() string {
+	return q.name + ":dead"
+}
+
+// deadIndexKey 返回按失败时间排序的死信索引名称
+func (q *Queue) deadIndexKey() string {
+	return q.name + ":dead:index"
+}
+
+// newDeadLetterID 生成随机死信ID
+func newDeadLetterID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// newDeadLetter 创建死信及其JSON内容
+func newDeadLetter(payload, reason string) (*DeadLetter, []byte, error) {
+	id, err := newDeadLetterID()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entry := &DeadLetter{
+		ID:       id,
+		Payload:  payload,
+		Error:    reason,
+		FailedAt: time.Now(),
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, nil, err
+	}
+	return entry, data, nil
+}
+
+// DeadLetter 确认当前投递，并将任务连同失败原因移入死信队列
+func (q *Queue) DeadLetter(ctx context.Context, d *Delivery, payload, reason string) (*DeadLetter, error) {
+	entry, data, err := newDeadLetter(payload, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, q.processingKey(d.consumer), 1, d.Payload)
+		pipe.ZRem(ctx, q.leasesKey(), leaseMember(d.consumer, d.Payload))
+		pipe.HSet(ctx, q.deadKey(), entry.ID, data)
+		pipe.ZAdd(ctx, q.deadIndexKey(), &redis.Z{
+			Score:  float64(entry.FailedAt.Unix()),
+			Member: entry.ID,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// ListDeadLetters 按失败时间倒序分页列出死信，同时返回死信总数
+func (q *Queue) ListDeadLetters(ctx context.Context, offset, limit int64) ([]DeadLetter, int64, error) {
+	total, err := q.rdb.ZCard(ctx, q.deadIndexKey()).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ids, err := q.rdb.ZRevRange(ctx, q.deadIndexKey(), offset, offset+limit-1).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(ids) == 0 {
+		return []DeadLetter{}, total, nil
+	}
+
+	values, err := q.rdb.HMGet(ctx, q.deadKey(), ids...).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	letters := make([]DeadLetter, 0, len(values))
+	for _, v := range values {
+		raw, ok := v.(string)
+		if !ok {
+			continue // 已被并发删除
+		}
+		var entry DeadLetter
+		if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+			continue
+		}
+		letters = append(letters, entry)
+	}
+	return letters, total, nil
+}
+
+// GetDeadLetter 查询单条死信
+func (q *Queue) GetDeadLetter(ctx context.Context, id string) (*DeadLetter, error) {
+	raw, err := q.rdb.HGet(ctx, q.deadKey(), id).Result()
+	if err == redis.Nil {
+		return nil, ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entry DeadLetter
+	if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// RequeueDeadLetter 删除死信并将payload放回主队列优先处理
+// payload通常是重置了重试次数后的任务内容
+func (q *Queue) RequeueDeadLetter(ctx context.Context, id, payload string) error {
+	n, err := requeueDeadLetterScript.Run(ctx, q.rdb,
+		[]string{q.deadKey(), q.deadIndexKey(), q.name},
+		id, payload,
+	).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+// PurgeDeadLetter 删除单条死信
+func (q *Queue) PurgeDeadLetter(ctx context.Context, id string) error {
+	var del *redis.IntCmd
+	_, err := q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		del = pipe.HDel(ctx, q.deadKey(), id)
+		pipe.ZRem(ctx, q.deadIndexKey(), id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if del.Val() == 0 {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+// PurgeDeadLetters 清空死信队列，返回删除的死信数
+func (q *Queue) PurgeDeadLetters(ctx context.Context) (int64, error) {
+	var count *redis.IntCmd
+	_, err := q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		count = pipe.HLen(ctx, q.deadKey())
+		pipe.Del(ctx, q.deadKey(), q.deadIndexKey())
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count.Val(), nil
+}
@@ -0,0 +1,350 @@
+// Package queue 提供基于Redis列表的可靠任务队列
+// 出队时任务通过Lua脚本原子地移入消费者私有的处理中列表并登记租约，
+// 处理完成后需显式确认(Ack)，处理期间由KeepAlive续期租约；租约过期仍未确认的任务会被回收，
+// 由 Redeliverer 决定重新投递还是移入死信队列，因此Worker在处理中途崩溃也不会丢失任务。
+package queue
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"icpt-system/internal/config"
+	"icpt-system/internal/store"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// 默认租约时长：超过该时间未确认的任务视为处理失败，重新投递
+	defaultVisibilityTimeout = 5 * time.Minute
+
+	// 默认回收过期租约的间隔
+	defaultReapInterval = 30 * time.Second
+
+	// 租约成员中消费者名称与任务内容之间的分隔符
+	leaseSeparator = "|"
+
+	// 队列为空时再次尝试取任务的等待时间，从最小值开始每次加倍，不超过最大值
+	minPollInterval = 50 * time.Millisecond
+	maxPollInterval = time.Second
+)
+
+// dequeueScript 取出一个任务放入消费者的处理中列表，并在同一个原子操作中登记租约，
+// 不会出现进程在两步之间崩溃、任务留在处理中列表却没有租约而无法回收的情况
+// 脚本中不能使用BLMOVE等阻塞命令，队列为空时返回nil，由调用方等待后重试
+var dequeueScript = redis.NewScript(`
+local item = redis.call('LMOVE', KEYS[1], KEYS[2], 'RIGHT', 'LEFT')
+if not item then
+	return false
+end
+redis.call('ZADD', KEYS[3], ARGV[2], ARGV[1] .. item)
+return item
+`)
+
+// redeliverScript 把一个未确认的任务重新投递或移入死信队列
+// 回收过期租约时(ARGV[3]=1)只有成功删除租约的一方才继续，避免多个Worker同时回收时重复投递；
+// 任务已不在处理中列表里（已被确认或回收）时返回0，重新投递返回1，移入死信队列返回2
+var redeliverScript = redis.NewScript(`
+if ARGV[3] == '1' then
+	if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+		return 0
+	end
+else
+	redis.call('ZREM', KEYS[1], ARGV[1])
+end
+if redis.call('LREM', KEYS[2], 1, ARGV[2]) == 0 then
+	return 0
+end
+if ARGV[5] ~= '' then
+	redis.call('HSET', KEYS[4], ARGV[5], ARGV[6])
+	redis.call('ZADD', KEYS[5], ARGV[7], ARGV[5])
+	return 2
+end
+redis.call('RPUSH', KEYS[3], ARGV[4])
+return 1
+`)
+
+// extendLeaseScript 租约仍存在时更新到期时间，租约已被回收时返回0
+var extendLeaseScript = redis.NewScript(`
+if redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+	redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+	return 1
+end
+return 0
+`)
+
+// Redeliverer 决定租约过期或消费者崩溃后未确认的任务如何处理，由使用队列的一方实现
+type Redeliverer interface {
+	// Redeliver 返回重新投递的任务内容；dead 为 true 时任务连同 reason 移入死信队列
+	Redeliver(payload string) (next string, dead bool, reason string)
+
+	// DeadLettered 在任务因此移入死信队列后调用
+	DeadLettered(entry *DeadLetter)
+}
+
+// Queue 可靠任务队列
+type Queue struct {
+	rdb               *redis.Client
+	name              string
+	visibilityTimeout time.Duration
+}
+
+// Delivery 一次出队得到的任务，处理完成后必须调用Ack确认
+type Delivery struct {
+	Payload  string
+	consumer string
+}
+
+// New 创建可靠任务队列
+func New(rdb *redis.Client, name string, visibilityTimeout time.Duration) *Queue {
+	if visibilityTimeout <= 0 {
+		visibilityTimeout = defaultVisibilityTimeout
+	}
+	return &Queue{
+		rdb:               rdb,
+		name:              name,
+		visibilityTimeout: visibilityTimeout,
+	}
+}
+
+// processingKey 返回消费者私有的处理中列表名称
+func (q *Queue) processingKey(consumer string) string {
+	return q.name + ":processing:" + consumer
+}
+
+// leasesKey 返回记录租约到期时间的有序集合名称
+func (q *Queue) leasesKey() string {
+	return q.name + ":leases"
+}
+
+// leaseMember 租约成员格式为 "消费者|任务内容"
+func leaseMember(consumer, payload string) string {
+	return consumer + leaseSeparator + payload
+}
+
+// Enqueue 将任务推入队列
+func (q *Queue) Enqueue(ctx context.Context, payload string) error {
+	return q.rdb.LPush(ctx, q.name, payload).Err()
+}
+
+// Dequeue 等待并取出一个任务，同时将其移入消费者的处理中列表并登记租约
+// 超时没有任务时返回 nil, nil
+func (q *Queue) Dequeue(ctx context.Context, consumer string, timeout time.Duration) (*Delivery, error) {
+	deadline := time.Now().Add(timeout)
+	wait := minPollInterval
+	for {
+		payload, err := dequeueScript.Run(ctx, q.rdb,
+			[]string{q.name, q.processingKey(consumer), q.leasesKey()},
+			consumer+leaseSeparator, time.Now().Add(q.visibilityTimeout).Unix(),
+		).Text()
+		if err == nil {
+			return &Delivery{Payload: payload, consumer: consumer}, nil
+		}
+		if err != redis.Nil {
+			return nil, err
+		}
+
+		// 队列为空：等待后重试，空闲时逐渐拉长间隔以减少对Redis的请求
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, nil
+		}
+		if wait > remaining {
+			wait = remaining
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		if wait *= 2; wait > maxPollInterval {
+			wait = maxPollInterval
+		}
+	}
+}
+
+// Ack 确认任务处理完成，将其从处理中列表和租约中移除
+func (q *Queue) Ack(ctx context.Context, d *Delivery) error {
+	_, err := q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, q.processingKey(d.consumer), 1, d.Payload)
+		pipe.ZRem(ctx, q.leasesKey(), leaseMember(d.consumer, d.Payload))
+		return nil
+	})
+	return err
+}
+
+// KeepAlive 在任务处理期间定期续期租约，避免处理时间超过租约时长的任务被重复投递
+// 处理完成后调用返回的函数停止续期
+func (q *Queue) KeepAlive(d *Delivery) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(q.visibilityTimeout / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				deadline := time.Now().Add(q.visibilityTimeout)
+				n, err := extendLeaseScript.Run(context.Background(), q.rdb,
+					[]string{q.leasesKey()},
+					leaseMember(d.consumer, d.Payload), deadline.Unix(),
+				).Int()
+				if err != nil {
+					log.Printf("警告: 续期任务租约失败: %v", err)
+				} else if n == 0 {
+					log.Printf("警告: 任务租约已被回收，任务可能被重复处理: %s", d.Payload)
+					return
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// redeliver 把处理中列表里的一个任务按 r 的决定重新投递或移入死信队列
+// requireLease 为 true 时只有租约仍存在（尚未被其他Worker回收）才处理；返回值同 redeliverScript
+func (q *Queue) redeliver(ctx context.Context, consumer, payload string, requireLease bool, r Redeliverer) (int, *DeadLetter, error) {
+	next, dead, reason := payload, false, ""
+	if r != nil {
+		next, dead, reason = r.Redeliver(payload)
+	}
+
+	var entry *DeadLetter
+	var deadID, deadData, failedAt string
+	if dead {
+		var data []byte
+		var err error
+		if entry, data, err = newDeadLetter(next, reason); err != nil {
+			return 0, nil, err
+		}
+		deadID, deadData, failedAt = entry.ID, string(data), strconv.FormatInt(entry.FailedAt.Unix(), 10)
+	}
+
+	lease := "0"
+	if requireLease {
+		lease = "1"
+	}
+	n, err := redeliverScript.Run(ctx, q.rdb,
+		[]string{q.leasesKey(), q.processingKey(consumer), q.name, q.deadKey(), q.deadIndexKey()},
+		leaseMember(consumer, payload), payload, lease, next, deadID, deadData, failedAt,
+	).Int()
+	if err != nil {
+		return 0, nil, err
+	}
+	if n == 2 && r != nil {
+		r.DeadLettered(entry)
+	}
+	return n, entry, nil
+}
+
+// Reap 处理租约已过期的任务：按 r 的决定重新投递或移入死信队列，返回处理的任务数
+func (q *Queue) Reap(ctx context.Context, r Redeliverer) (int, error) {
+	expired, err := q.rdb.ZRangeByScore(ctx, q.leasesKey(), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().Unix(), 10),
+	}).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	reaped := 0
+	for _, member := range expired {
+		parts := strings.SplitN(member, leaseSeparator, 2)
+		if len(parts) != 2 {
+			q.rdb.ZRem(ctx, q.leasesKey(), member)
+			continue
+		}
+		consumer, payload := parts[0], parts[1]
+
+		n, entry, err := q.redeliver(ctx, consumer, payload, true, r)
+		if err != nil {
+			return reaped, err
+		}
+		switch n {
+		case 1:
+			log.Printf("♻️ 任务租约过期，已重新投递: 消费者=%s, 任务=%s", consumer, payload)
+			reaped++
+		case 2:
+			log.Printf("☠️ 任务租约过期且重试次数已用尽，已移入死信队列: ID=%s, 消费者=%s", entry.ID, consumer)
+			reaped++
+		}
+	}
+
+	return reaped, nil
+}
+
+// Recover 处理某个消费者处理中列表里的全部任务：按 r 的决定重新投递或移入死信队列
+// 消费者启动时调用，用于接管自己上次崩溃前未确认的任务
+func (q *Queue) Recover(ctx context.Context, consumer string, r Redeliverer) (int, error) {
+	// 列表左端为最新取出的任务，按此顺序推入队列出队端，最早的任务最先被重新处理
+	payloads, err := q.rdb.LRange(ctx, q.processingKey(consumer), 0, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	recovered := 0
+	for _, payload := range payloads {
+		n, _, err := q.redeliver(ctx, consumer, payload, false, r)
+		if err != nil {
+			return recovered, err
+		}
+		if n != 0 {
+			recovered++
+		}
+	}
+	return recovered, nil
+}
+
+// RunReaper 按固定间隔回收过期租约，并每秒把到期的延迟重试任务转回主队列，直到ctx被取消
+func (q *Queue) RunReaper(ctx context.Context, interval time.Duration, r Redeliverer) {
+	if interval <= 0 {
+		interval = defaultReapInterval
+	}
+
+	reapTicker := time.NewTicker(interval)
+	defer reapTicker.Stop()
+	promoteTicker := time.NewTicker(time.Second)
+	defer promoteTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-reapTicker.C:
+			if _, err := q.Reap(ctx, r); err != nil && ctx.Err() == nil {
+				log.Printf("错误: 回收过期任务租约失败: %v", err)
+			}
+		case <-promoteTicker.C:
+			if _, err := q.PromoteDelayed(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("错误: 转移延迟重试任务失败: %v", err)
+			}
+		}
+	}
+}
+
+// Len 返回队列中等待处理的任务数
+func (q *Queue) Len(ctx context.Context) (int64, error) {
+	return q.rdb.LLen(ctx, q.name).Result()
+}
+
+// 全局图像处理任务队列
+var TaskQueue *Queue
+
+// InitTaskQueue 初始化全局图像处理任务队列
+func InitTaskQueue(rdb *redis.Client) {
+	c := config.Cfg.Queue
+	TaskQueue = New(rdb, store.TaskQueueName, time.Duration(c.VisibilityTimeout)*time.Second)
+	log.Printf("任务队列已就绪: %s (租约 %v)", store.TaskQueueName, TaskQueue.visibilityTimeout)
+}
+
+// ReapInterval 返回配置的租约回收间隔
+func ReapInterval() time.Duration {
+	return time.Duration(config.Cfg.Queue.ReapInterval) * time.Second
+}
@@ -0,0 +1,110 @@
+package queue
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"icpt-system/internal/config"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	defaultMaxAttempts    = 5
+	defaultRetryBaseDelay = 2 * time.Second
+	defaultRetryMaxDelay  = 5 * time.Minute
+
+	// 每次从延迟队列中转移的最大任务数
+	promoteBatchSize = 100
+)
+
+// promoteScript 把到期的延迟任务原子地转移回主队列
+var promoteScript = redis.NewScript(`
+local items = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, item in ipairs(items) do
+	redis.call('ZREM', KEYS[1], item)
+	redis.call('LPUSH', KEYS[2], item)
+end
+return #items
+`)
+
+// RetryPolicy 任务失败后的重试策略
+type RetryPolicy struct {
+	MaxAttempts int           // 最多尝试次数，达到后任务进入死信队列
+	BaseDelay   time.Duration // 第一次重试前的等待时间
+	MaxDelay    time.Duration // 重试等待时间上限
+}
+
+// RetryPolicyFromConfig 根据配置文件生成重试策略，未配置的项使用默认值
+func RetryPolicyFromConfig() RetryPolicy {
+	c := config.Cfg.Queue
+	policy := RetryPolicy{
+		MaxAttempts: c.MaxAttempts,
+		BaseDelay:   time.Duration(c.RetryBaseDelay) * time.Second,
+		MaxDelay:    time.Duration(c.RetryMaxDelay) * time.Second,
+	}
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = defaultMaxAttempts
+	}
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = defaultRetryBaseDelay
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = defaultRetryMaxDelay
+	}
+	return policy
+}
+
+// Backoff 计算第attempt次失败后的重试等待时间（指数退避）
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	if delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
+
+// Exhausted 判断失败attempt次后是否应放弃重试
+func (p RetryPolicy) Exhausted(attempt int) bool {
+	return attempt >= p.MaxAttempts
+}
+
+// delayedKey 返回延迟队列（有序集合，分数为可执行时间的毫秒时间戳）名称
+func (q *Queue) delayedKey() string {
+	return q.name + ":delayed"
+}
+
+// Retry 确认当前投递，并把新的任务内容放入延迟队列，delay之后重新进入主队列
+func (q *Queue) Retry(ctx context.Context, d *Delivery, payload string, delay time.Duration) error {
+	readyAt := time.Now().Add(delay)
+	_, err := q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, q.processingKey(d.consumer), 1, d.Payload)
+		pipe.ZRem(ctx, q.leasesKey(), leaseMember(d.consumer, d.Payload))
+		pipe.ZAdd(ctx, q.delayedKey(), &redis.Z{
+			Score:  float64(readyAt.UnixMilli()),
+			Member: payload,
+		})
+		return nil
+	})
+	return err
+}
+
+// PromoteDelayed 把已到期的延迟任务转移回主队列，返回转移的任务数
+func (q *Queue) PromoteDelayed(ctx context.Context) (int, error) {
+	return promoteScript.Run(ctx, q.rdb,
+		[]string{q.delayedKey(), q.name},
+		strconv.FormatInt(time.Now().UnixMilli(), 10), promoteBatchSize,
+	).Int()
+}
+
+// DelayedLen 返回延迟队列中等待重试的任务数
+func (q *Queue) DelayedLen(ctx context.Context) (int64, error) {
+	return q.rdb.ZCard(ctx, q.delayedKey()).Result()
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"icpt-system/internal/models"
+	"icpt-system/internal/store"
+
+	"gorm.io/gorm"
+)
+
+// apiKeyLastUsedInterval 最近使用时间的更新间隔，避免每个请求都写数据库
+const apiKeyLastUsedInterval = time.Minute
+
+// maxAPIKeysPerUser 每个用户可同时持有的有效密钥数
+const maxAPIKeysPerUser = 20
+
+var (
+	// ErrAPIKeyInvalid API密钥不存在、已撤销、已过期或用户已被禁用
+	ErrAPIKeyInvalid = errors.New("API密钥无效或已过期")
+
+	// ErrAPIKeyNotFound 要撤销的密钥不存在或不属于当前用户
+	ErrAPIKeyNotFound = errors.New("API密钥不存在")
+
+	// ErrAPIKeyLimitExceeded 有效密钥数量达到上限
+	ErrAPIKeyLimitExceeded = errors.New("API密钥数量已达上限")
+)
+
+// APIKeyIdentity 通过API密钥认证的调用方
+type APIKeyIdentity struct {
+	User *models.User
+	Key  *models.APIKey
+}
+
+// IsAPIKey 判断凭据是否为API密钥（而非JWT）
+func IsAPIKey(raw string) bool {
+	return strings.HasPrefix(raw, models.APIKeyPrefix)
+}
+
+// normalizeScopes 去重并按固定顺序排列权限范围
+func normalizeScopes(scopes []string) string {
+	var result []string
+	for _, scope := range []string{models.ScopeUpload, models.ScopeRead, models.ScopeDelete} {
+		for _, s := range scopes {
+			if s == scope {
+				result = append(result, scope)
+				break
+			}
+		}
+	}
+	return strings.Join(result, ",")
+}
+
+// CreateAPIKey 为用户创建API密钥，返回密钥原文和记录；原文不会保存，只能在此时获取
+func CreateAPIKey(userID uint, req *models.CreateAPIKeyRequest) (string, *models.APIKey, error) {
+	var active int64
+	err := store.DB.Model(&models.APIKey{}).
+		Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, time.Now()).
+		Count(&active).Error
+	if err != nil {
+		return "", nil, err
+	}
+	if active >= maxAPIKeysPerUser {
+		return "", nil, ErrAPIKeyLimitExceeded
+	}
+
+	token, err := newOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+	raw := models.APIKeyPrefix + token
+
+	key := &models.APIKey{
+		UserID:  userID,
+		Name:    strings.TrimSpace(req.Name),
+		Prefix:  raw[:len(models.APIKeyPrefix)+6],
+		KeyHash: hashToken(raw),
+		Scopes:  normalizeScopes(req.Scopes),
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour)
+		key.ExpiresAt = &expiresAt
+	}
+	if err := store.DB.Create(key).Error; err != nil {
+		return "", nil, err
+	}
+	return raw, key, nil
+}
+
+// ListAPIKeys 列出用户未撤销的API密钥（包括已过期的），按创建时间倒序
+func ListAPIKeys(userID uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := store.DB.Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+// RevokeAPIKey 撤销用户的API密钥，立即生效
+func RevokeAPIKey(userID, keyID uint) error {
+	result := store.DB.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// AuthenticateAPIKey 校验API密钥并记录最近使用时间
+func AuthenticateAPIKey(raw string) (*APIKeyIdentity, error) {
+	var key models.APIKey
+	err := store.DB.Where("key_hash = ?", hashToken(raw)).First(&key).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrAPIKeyInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	var user models.User
+	if err := store.DB.First(&user, key.UserID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrAPIKeyInvalid
+		}
+		return nil, err
+	}
+	if user.Status != models.StatusActive {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	// 条件更新：间隔内的并发请求只有一个会写数据库
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyLastUsedInterval {
+		err := store.DB.Model(&models.APIKey{}).
+			Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", key.ID, now.Add(-apiKeyLastUsedInterval)).
+			Update("last_used_at", now).Error
+		if err != nil {
+			log.Printf("更新API密钥 %d 最近使用时间失败: %v", key.ID, err)
+		} else {
+			key.LastUsedAt = &now
+		}
+	}
+
+	return &APIKeyIdentity{User: &user, Key: &key}, nil
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"icpt-system/internal/models"
+	"icpt-system/internal/storage"
+	"icpt-system/internal/store"
+
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// blobPath 原图按内容哈希存放的存储键前缀：originals/{哈希前两位}/{哈希}{扩展名}
+	blobPath = "originals"
+
+	// stagingPath 上传过程中计算哈希时使用的本地临时目录，与存储后端无关
+	stagingPath = "uploads/tmp"
+)
+
+// safeExtension 只保留由字母数字组成的扩展名，避免用户文件名影响存储路径
+var safeExtension = regexp.MustCompile(`^\.[a-z0-9]{1,10}$`)
+
+// StagedUpload 已写入临时文件并计算出哈希、尚未存入原图目录的上传
+type StagedUpload struct {
+	TmpPath string
+	Hash    string
+	Size    int64
+	Ext     string
+}
+
+// StageUpload 将上传内容写入临时文件，同时计算SHA-256
+func StageUpload(src io.Reader, filename string) (*StagedUpload, error) {
+	if err := os.MkdirAll(stagingPath, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("无法创建临时目录: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(stagingPath, "upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("无法创建临时文件: %w", err)
+	}
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("无法写入临时文件: %w", err)
+	}
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	if !safeExtension.MatchString(ext) {
+		ext = ""
+	}
+
+	return &StagedUpload{
+		TmpPath: tmp.Name(),
+		Hash:    hex.EncodeToString(hasher.Sum(nil)),
+		Size:    size,
+		Ext:     ext,
+	}, nil
+}
+
+// Discard 删除临时文件（重复上传或出错时调用）
+func (s *StagedUpload) Discard() {
+	if err := os.Remove(s.TmpPath); err != nil && !os.IsNotExist(err) {
+		log.Printf("删除临时文件 %s 失败: %v", s.TmpPath, err)
+	}
+}
+
+// BlobStoragePath 返回内容哈希对应的原图存储键
+func BlobStoragePath(hash, ext string) string {
+	return path.Join(blobPath, hash[:2], hash+ext)
+}
+
+// CommitBlob 将暂存的上传存为Blob并增加一次引用
+// 相同内容已经存在时丢弃临时文件，只增加引用计数
+func CommitBlob(staged *StagedUpload) (*models.Blob, error) {
+	var blob models.Blob
+	var placed string // 本次写入存储的新文件，最终失败时删除
+
+	commit := func() error {
+		return store.DB.Transaction(func(tx *gorm.DB) error {
+			// 锁定已有的Blob记录，避免与释放最后一个引用的删除操作交错
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("hash = ?", staged.Hash).First(&blob).Error
+			if err == nil {
+				if _, err := placeBlobFile(staged, blob.StoragePath); err != nil {
+					return err
+				}
+				blob.RefCount++
+				return tx.Model(&blob).Update("ref_count", blob.RefCount).Error
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+
+			blob = models.Blob{
+				Hash:        staged.Hash,
+				StoragePath: BlobStoragePath(staged.Hash, staged.Ext),
+				Size:        staged.Size,
+				RefCount:    1,
+			}
+			written, err := placeBlobFile(staged, blob.StoragePath)
+			if err != nil {
+				return err
+			}
+			if written {
+				placed = blob.StoragePath
+			}
+			return tx.Create(&blob).Error
+		})
+	}
+
+	err := commit()
+	if isDuplicateKey(err) {
+		// 并发上传相同内容时可能同时插入，唯一索引冲突后重试一次即可走到增加引用的分支
+		blob = models.Blob{}
+		err = commit()
+	}
+	if err != nil {
+		staged.Discard()
+		if placed != "" {
+			removeOrphanBlobFile(placed)
+		}
+		return nil, fmt.Errorf("保存原图失败: %w", err)
+	}
+	return &blob, nil
+}
+
+// isDuplicateKey 判断是否为MySQL唯一索引冲突（错误码1062）
+func isDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+// removeOrphanBlobFile 删除没有Blob记录引用的原图文件
+// 同时进行的相同内容上传可能已经为这个文件创建了记录，此时保留文件
+func removeOrphanBlobFile(key string) {
+	var count int64
+	if err := store.DB.Model(&models.Blob{}).Where("storage_path = ?", key).Count(&count).Error; err != nil {
+		log.Printf("检查原图 %s 的引用失败，保留文件: %v", key, err)
+		return
+	}
+	if count > 0 {
+		return
+	}
+	if err := storage.Backend.Delete(context.Background(), key); err != nil {
+		log.Printf("删除未使用的原图 %s 失败: %v", key, err)
+	}
+}
+
+// placeBlobFile 确保Blob文件存在：不存在时将临时文件写入存储，最后删除临时文件
+// written 表示文件是本次写入的
+func placeBlobFile(staged *StagedUpload, key string) (written bool, err error) {
+	ctx := context.Background()
+	if _, err := storage.Backend.Stat(ctx, key); err == nil {
+		staged.Discard()
+		return false, nil
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return false, err
+	}
+
+	contentType := mime.TypeByExtension(staged.Ext)
+	if err := storage.PutFile(ctx, storage.Backend, key, staged.TmpPath, contentType); err != nil {
+		// 临时文件已在上一次尝试中写入存储并删除
+		if os.IsNotExist(err) {
+			if _, statErr := storage.Backend.Stat(ctx, key); statErr == nil {
+				return false, nil
+			}
+		}
+		return false, err
+	}
+	staged.Discard()
+	return true, nil
+}
+
+// ReleaseBlob 释放一次对Blob的引用，最后一个引用释放时删除文件和记录
+func ReleaseBlob(hash string) error {
+	return store.DB.Transaction(func(tx *gorm.DB) error {
+		var blob models.Blob
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("hash = ?", hash).First(&blob).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if blob.RefCount > 1 {
+			return tx.Model(&blob).Update("ref_count", blob.RefCount-1).Error
+		}
+
+		if err := tx.Delete(&blob).Error; err != nil {
+			return err
+		}
+		// 在持有行锁时删除文件，同时进行的相同内容上传会等待并重新创建文件
+		if err := storage.Backend.Delete(context.Background(), blob.StoragePath); err != nil {
+			return err
+		}
+		log.Printf("已删除最后一个引用的原图: %s", blob.StoragePath)
+		return nil
+	})
+}
+
+// RemoveImageFile 删除图片的原图文件
+// 文件是内容寻址的Blob时只释放引用，其他文件（如优化后的原图、历史上传）直接删除
+func RemoveImageFile(contentHash, key string) error {
+	if key == "" {
+		return nil
+	}
+	if contentHash != "" {
+		var blob models.Blob
+		if err := store.DB.Where("hash = ?", contentHash).First(&blob).Error; err == nil && blob.StoragePath == key {
+			return ReleaseBlob(contentHash)
+		}
+	}
+	return storage.Backend.Delete(context.Background(), key)
+}
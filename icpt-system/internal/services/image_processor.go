@@ -1,38 +1,40 @@
 package services
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"image"
 	"image/jpeg"
 	_ "image/png"
 	"log"
-	"os"
-	"path/filepath"
+	"path"
 	"time"
 
+	"icpt-system/internal/storage"
+
 	"github.com/nfnt/resize"
 )
 
 const (
-	thumbnailPath = "uploads/thumbnails"
+	thumbnailPath = "thumbnails"
 	thumbWidth    = 400
 )
 
-// GenerateThumbnail 接收一个原始文件路径，为其生成缩略图
-// 返回: 缩略图存储路径, 错误
-func GenerateThumbnail(originalFilePath string, originalFilename string) (string, error) {
-	// 打开原始文件
-	file, err := os.Open(originalFilePath)
+// GenerateThumbnail 接收一个原始文件的存储键，为其生成缩略图
+// 返回: 缩略图存储键, 错误
+func GenerateThumbnail(originalKey string, originalFilename string) (string, error) {
+	// 读取原始文件
+	data, err := storage.ReadAll(context.Background(), storage.Backend, originalKey)
 	if err != nil {
-		log.Printf("错误: 打开原始文件 %s 失败: %v", originalFilePath, err)
+		log.Printf("错误: 读取原始文件 %s 失败: %v", originalKey, err)
 		return "", fmt.Errorf("无法打开原始文件")
 	}
-	defer file.Close()
 	
 	// 解码图像
-	img, _, err := image.Decode(file)
+	img, _, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
-		log.Printf("错误: 解码图像 %s 失败: %v", originalFilePath, err)
+		log.Printf("错误: 解码图像 %s 失败: %v", originalKey, err)
 		return "", fmt.Errorf("无法解码图像，可能是不支持的格式")
 	}
 
@@ -41,22 +43,22 @@ func GenerateThumbnail(originalFilePath string, originalFilename string) (string
 	
 	// 构造缩略图文件名和路径
 	uniqueThumbFilename := fmt.Sprintf("thumb-%s-%s", time.Now().Format("20060102150405"), originalFilename)
-	thumbnailFilePath := filepath.Join(thumbnailPath, uniqueThumbFilename)
+	thumbnailKey := path.Join(thumbnailPath, uniqueThumbFilename)
 
-	// 创建缩略图文件
-	out, err := os.Create(thumbnailFilePath)
+	// 将缩略图以 JPEG 格式编码
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, thumbnail, nil)
 	if err != nil {
-		log.Printf("错误: 创建缩略图文件 %s 失败: %v", thumbnailFilePath, err)
+		log.Printf("错误: 编码缩略图 %s 失败: %v", thumbnailKey, err)
 		return "", fmt.Errorf("无法保存缩略图")
 	}
-	defer out.Close()
 
-	// 将缩略图以 JPEG 格式写入文件
-	err = jpeg.Encode(out, thumbnail, nil)
+	// 写入存储
+	err = storage.Backend.Put(context.Background(), thumbnailKey, &buf, int64(buf.Len()), "image/jpeg")
 	if err != nil {
-		log.Printf("错误: 编码缩略图 %s 失败: %v", thumbnailFilePath, err)
+		log.Printf("错误: 写入缩略图 %s 失败: %v", thumbnailKey, err)
 		return "", fmt.Errorf("无法保存缩略图")
 	}
 	
-	return thumbnailFilePath, nil
+	return thumbnailKey, nil
 }
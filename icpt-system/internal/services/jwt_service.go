@@ -1,29 +1,81 @@
 package services
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"icpt-system/internal/config"
+	"icpt-system/internal/store"
 )
 
+const (
+	// defaultAccessTokenTTL 未配置时访问令牌的有效期
+	defaultAccessTokenTTL = 15 * time.Minute
+
+	// revokedTokenPrefix 已登出访问令牌的Redis键前缀，后接jti，键在令牌过期时一并过期
+	revokedTokenPrefix = "icpt:jwt:revoked:"
+
+	// revokedUserPrefix 用户全部会话被作废的时间（Unix毫秒），后接用户ID
+	// 此前签发的访问令牌都视为已登出，键在最长的访问令牌过期后一并过期
+	revokedUserPrefix = "icpt:jwt:revoked-user:"
+)
+
+// 令牌中的时间精确到毫秒：作废会话后同一秒内签发的旧令牌也必须能被识别出来
+// （例如重置密码时持有刷新令牌的攻击者同时换取的访问令牌）
+func init() {
+	jwt.TimePrecision = time.Millisecond
+}
+
 // JWTClaims JWT声明结构
 type JWTClaims struct {
 	UserID   uint   `json:"user_id"`
 	Username string `json:"username"`
+	Role     string `json:"role"` // 签发时的用户角色，角色变更时作废已有会话
 	jwt.RegisteredClaims
 }
 
-// GenerateToken 生成JWT令牌
-func GenerateToken(userID uint, username string) (string, error) {
+// AccessTokenTTL 返回访问令牌的有效期
+func AccessTokenTTL() time.Duration {
+	if minutes := config.Cfg.JWT.AccessMinutes; minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	if hours := config.Cfg.JWT.ExpireHours; hours > 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return defaultAccessTokenTTL
+}
+
+// newTokenID 生成随机令牌ID（jti）
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GenerateToken 生成JWT访问令牌
+func GenerateToken(userID uint, username, role string) (string, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
 	claims := JWTClaims{
 		UserID:   userID,
 		Username: username,
+		Role:     role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // 24小时有效期
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL())),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 			Issuer:    "icpt-system",
 			Subject:   username,
 		},
@@ -51,4 +103,53 @@ func ValidateToken(tokenString string) (*JWTClaims, error) {
 	}
 
 	return nil, errors.New("invalid token")
-} 
\ No newline at end of file
+}
+
+// RevokeAccessToken 将访问令牌的jti加入Redis黑名单，直到令牌自然过期
+func RevokeAccessToken(ctx context.Context, claims *JWTClaims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+	ttl := time.Until(claims.ExpiresAt.Time)
+	if ttl <= 0 {
+		return nil
+	}
+	return store.Rdb.Set(ctx, revokedTokenPrefix+claims.ID, 1, ttl).Err()
+}
+
+// RevokeUserAccessTokens 作废用户此前签发的所有访问令牌，用于重置密码等需要强制下线的场景
+// 签发时间不晚于作废时间的令牌都视为已登出；iat 以浮点数秒解析时可能少1毫秒，
+// 因此返回前等待2毫秒，保证调用方随后签发的新令牌不受影响
+func RevokeUserAccessTokens(ctx context.Context, userID uint) error {
+	key := revokedUserPrefix + strconv.FormatUint(uint64(userID), 10)
+	if err := store.Rdb.Set(ctx, key, time.Now().UnixMilli(), AccessTokenTTL()).Err(); err != nil {
+		return err
+	}
+	time.Sleep(2 * time.Millisecond)
+	return nil
+}
+
+// IsAccessTokenRevoked 检查访问令牌是否已登出，或签发后用户的全部会话被作废
+// 升级前签发的令牌没有jti，无法单独作废，只能等待过期
+func IsAccessTokenRevoked(ctx context.Context, claims *JWTClaims) (bool, error) {
+	userKey := revokedUserPrefix + strconv.FormatUint(uint64(claims.UserID), 10)
+	tokenKey := revokedTokenPrefix + claims.ID
+	values, err := store.Rdb.MGet(ctx, tokenKey, userKey).Result()
+	if err != nil {
+		return false, err
+	}
+
+	if claims.ID != "" && values[0] != nil {
+		return true, nil
+	}
+	if revokedAt, ok := values[1].(string); ok && claims.IssuedAt != nil {
+		ts, err := strconv.ParseInt(revokedAt, 10, 64)
+		if err == nil && ts < 1e12 {
+			ts *= 1000 // 升级前以秒记录的作废时间
+		}
+		if err == nil && claims.IssuedAt.UnixMilli() <= ts {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"icpt-system/internal/config"
+	"icpt-system/internal/models"
+	"icpt-system/internal/store"
+)
+
+// 登录防暴力破解的Redis键前缀
+// 账户维度的键以登录主体区分：已注册用户为 uid:{用户ID}，用户名不存在时为 name:{小写登录名}
+const (
+	loginFailPrefix  = "icpt:login:fail:"  // 失败次数，统计窗口结束后过期
+	loginDelayPrefix = "icpt:login:delay:" // 存在期间不允许重试
+	loginLockPrefix  = "icpt:login:lock:"  // 存在期间账户或IP被锁定
+)
+
+// minLoginDelay 达到 delay_after 次失败后的首次等待时间，之后逐次翻倍
+const minLoginDelay = 2 * time.Second
+
+// LoginBlockedError 登录被限制，Code 和 RetryAfter 直接用于API响应
+type LoginBlockedError struct {
+	Code       string        // ACCOUNT_LOCKED / IP_LOCKED / LOGIN_THROTTLED
+	Result     string        // 审计记录中的结果
+	RetryAfter time.Duration // 距离允许再次尝试的时间
+}
+
+func (e *LoginBlockedError) Error() string {
+	switch e.Code {
+	case "ACCOUNT_LOCKED":
+		return "登录失败次数过多，账户已被临时锁定"
+	case "IP_LOCKED":
+		return "该IP登录失败次数过多，已被临时禁止登录"
+	default:
+		return "登录尝试过于频繁，请稍后重试"
+	}
+}
+
+// LoginSubject 返回登录主体：用户存在时按用户ID，避免用户名和邮箱分别计数；否则按登录名
+func LoginSubject(user *models.User, login string) string {
+	if user != nil {
+		return fmt.Sprintf("uid:%d", user.ID)
+	}
+	return "name:" + strings.ToLower(strings.TrimSpace(login))
+}
+
+// CheckLogin 检查账户和IP是否允许登录，被限制时返回 *LoginBlockedError
+// Redis不可用时放行，只记录日志
+func CheckLogin(ctx context.Context, subject, ip string) error {
+	pipe := store.Rdb.Pipeline()
+	ipLock := pipe.PTTL(ctx, loginLockPrefix+"ip:"+ip)
+	userLock := pipe.PTTL(ctx, loginLockPrefix+subject)
+	delay := pipe.PTTL(ctx, loginDelayPrefix+subject)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("查询登录限制失败: %v", err)
+		return nil
+	}
+
+	if ttl := ipLock.Val(); ttl > 0 {
+		return &LoginBlockedError{Code: "IP_LOCKED", Result: models.LoginLocked, RetryAfter: ttl}
+	}
+	if ttl := userLock.Val(); ttl > 0 {
+		return &LoginBlockedError{Code: "ACCOUNT_LOCKED", Result: models.LoginLocked, RetryAfter: ttl}
+	}
+	if ttl := delay.Val(); ttl > 0 {
+		return &LoginBlockedError{Code: "LOGIN_THROTTLED", Result: models.LoginThrottled, RetryAfter: ttl}
+	}
+	return nil
+}
+
+// RecordLoginFailure 记录一次失败的登录，按失败次数设置重试等待或锁定
+func RecordLoginFailure(ctx context.Context, subject, ip string) {
+	cfg := config.Cfg.LoginProtection
+	window := time.Duration(cfg.FailureWindow) * time.Minute
+	if window <= 0 {
+		window = 15 * time.Minute
+	}
+	lockout := time.Duration(cfg.LockoutMinutes) * time.Minute
+	if lockout <= 0 {
+		lockout = 15 * time.Minute
+	}
+
+	userKey := loginFailPrefix + subject
+	ipKey := loginFailPrefix + "ip:" + ip
+
+	pipe := store.Rdb.TxPipeline()
+	userFails := pipe.Incr(ctx, userKey)
+	ipFails := pipe.Incr(ctx, ipKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("记录登录失败次数失败: %v", err)
+		return
+	}
+
+	// 窗口从第一次失败开始计算，后续失败不延长
+	pipe = store.Rdb.TxPipeline()
+	if userFails.Val() == 1 {
+		pipe.Expire(ctx, userKey, window)
+	}
+	if ipFails.Val() == 1 {
+		pipe.Expire(ctx, ipKey, window)
+	}
+	if cfg.MaxIPFailures > 0 && ipFails.Val() >= int64(cfg.MaxIPFailures) {
+		log.Printf("⚠️ IP %s 登录失败 %d 次，禁止登录 %v", ip, ipFails.Val(), lockout)
+		pipe.Set(ctx, loginLockPrefix+"ip:"+ip, 1, lockout)
+		pipe.Del(ctx, ipKey)
+	}
+	switch n := userFails.Val(); {
+	case cfg.MaxFailures > 0 && n >= int64(cfg.MaxFailures):
+		log.Printf("⚠️ 登录主体 %s 失败 %d 次，锁定 %v", subject, n, lockout)
+		pipe.Set(ctx, loginLockPrefix+subject, 1, lockout)
+		pipe.Del(ctx, userKey, loginDelayPrefix+subject)
+	case cfg.DelayAfter > 0 && n >= int64(cfg.DelayAfter):
+		pipe.Set(ctx, loginDelayPrefix+subject, 1, loginDelay(n-int64(cfg.DelayAfter), cfg.MaxDelay))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("设置登录限制失败: %v", err)
+	}
+}
+
+// loginDelay 返回第 extra+1 次超出 delay_after 的失败之后的等待时间
+func loginDelay(extra int64, maxSeconds int) time.Duration {
+	maxDelay := time.Duration(maxSeconds) * time.Second
+	if maxDelay <= 0 {
+		maxDelay = time.Minute
+	}
+	delay := minLoginDelay
+	for i := int64(0); i < extra && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// ResetLoginFailures 登录成功后清除账户的失败计数；IP的计数保留到窗口结束，
+// 防止攻击者用自己的账户登录来重置IP计数
+func ResetLoginFailures(ctx context.Context, subject string) {
+	if err := store.Rdb.Del(ctx, loginFailPrefix+subject, loginDelayPrefix+subject).Err(); err != nil {
+		log.Printf("清除登录失败次数失败: %v", err)
+	}
+}
+
+// RecordLoginAttempt 写入登录审计记录，失败时只记录日志，不影响登录结果
+func RecordLoginAttempt(user *models.User, login, result, ip, userAgent string) {
+	attempt := models.LoginAttempt{
+		Login:     truncate(login, 255),
+		Success:   result == models.LoginSucceeded,
+		Result:    result,
+		IP:        ip,
+		UserAgent: truncate(userAgent, 255),
+	}
+	if user != nil {
+		attempt.UserID = &user.ID
+	}
+	if err := store.DB.Create(&attempt).Error; err != nil {
+		log.Printf("写入登录审计记录失败: %v", err)
+	}
+}
+
+// RecentLoginAttempts 返回用户最近的登录记录
+func RecentLoginAttempts(userID uint, limit int) ([]models.LoginAttempt, error) {
+	var attempts []models.LoginAttempt
+	err := store.DB.Where("user_id = ?", userID).
+		Order("created_at DESC").Limit(limit).Find(&attempts).Error
+	return attempts, err
+}
+
+// truncate 按字节截断字符串，不截断多字节字符
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
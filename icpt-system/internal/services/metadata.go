@@ -0,0 +1,209 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+	"time"
+
+	"icpt-system/internal/storage"
+	"icpt-system/pkg/imageprocessor"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/mknote"
+)
+
+func init() {
+	// 解析佳能、尼康等厂商的私有标签，镜头型号有时只存在于其中
+	exif.RegisterParsers(mknote.All...)
+}
+
+// ImageMetadata 从图像中提取的元数据
+type ImageMetadata struct {
+	CameraMake  string
+	CameraModel string
+	LensModel   string
+	TakenAt     *time.Time
+	Width       int // 按方向标记转正后的宽度
+	Height      int // 按方向标记转正后的高度
+	Orientation int
+	Latitude    *float64
+	Longitude   *float64
+}
+
+// ExtractMetadata 从存储读取图像尺寸和JPEG的EXIF信息
+// 没有EXIF不算错误，只返回尺寸；只有文件无法读取或不是图像时才返回错误
+func ExtractMetadata(key string) (*ImageMetadata, error) {
+	data, err := storage.ReadAll(context.Background(), storage.Backend, key)
+	if err != nil {
+		return nil, fmt.Errorf("无法打开原始文件")
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("无法解析图像尺寸: %w", err)
+	}
+
+	meta := &ImageMetadata{
+		Width:       cfg.Width,
+		Height:      cfg.Height,
+		Orientation: 1,
+	}
+	if format != "jpeg" {
+		return meta, nil
+	}
+
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return meta, nil
+	}
+
+	meta.CameraMake = exifString(x, exif.Make)
+	meta.CameraModel = exifString(x, exif.Model)
+	meta.LensModel = exifString(x, exif.LensModel)
+
+	if taken, err := x.DateTime(); err == nil && !taken.IsZero() {
+		meta.TakenAt = &taken
+	}
+
+	if tag, err := x.Get(exif.Orientation); err == nil {
+		if o, err := tag.Int(0); err == nil && o >= 1 && o <= 8 {
+			meta.Orientation = o
+		}
+	}
+	if meta.Orientation >= 5 {
+		meta.Width, meta.Height = meta.Height, meta.Width
+	}
+
+	if lat, long, err := x.LatLong(); err == nil {
+		meta.Latitude = &lat
+		meta.Longitude = &long
+	}
+
+	return meta, nil
+}
+
+// exifString 读取字符串类型的EXIF标签，去掉结尾的空字符和空白
+func exifString(x *exif.Exif, name exif.FieldName) string {
+	tag, err := x.Get(name)
+	if err != nil {
+		return ""
+	}
+	value, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(value, "\x00"))
+}
+
+// JPEG标记
+const (
+	markerSOI  = 0xD8
+	markerSOS  = 0xDA
+	markerAPP1 = 0xE1 // EXIF、XMP
+	markerAPPD = 0xED // IPTC (Photoshop)
+	markerCOM  = 0xFE // 注释
+)
+
+// errNotJPEG 输入不是JPEG
+var errNotJPEG = errors.New("not a jpeg")
+
+// StripJPEGMetadata 复制JPEG并去掉EXIF、XMP、IPTC和注释段（其中可能含有GPS位置、设备序列号、作者等信息）
+// 像素数据原样复制不重新编码；原图带方向标记时写入只含方向标记的最小EXIF，保证显示方向不变
+func StripJPEGMetadata(w io.Writer, r io.Reader) error {
+	br := bufio.NewReader(r)
+	bw := bufio.NewWriter(w)
+
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil || soi[0] != 0xFF || soi[1] != markerSOI {
+		return errNotJPEG
+	}
+	if _, err := bw.Write(soi[:]); err != nil {
+		return err
+	}
+
+	orientationWritten := false
+	for {
+		var marker [2]byte
+		if _, err := io.ReadFull(br, marker[:]); err != nil {
+			return err
+		}
+		if marker[0] != 0xFF {
+			return fmt.Errorf("无效的JPEG段标记")
+		}
+
+		// 扫描数据开始后不再有元数据段，剩余内容原样复制
+		if marker[1] == markerSOS {
+			if _, err := bw.Write(marker[:]); err != nil {
+				return err
+			}
+			if _, err := io.Copy(bw, br); err != nil {
+				return err
+			}
+			return bw.Flush()
+		}
+
+		var lengthBytes [2]byte
+		if _, err := io.ReadFull(br, lengthBytes[:]); err != nil {
+			return err
+		}
+		length := int(binary.BigEndian.Uint16(lengthBytes[:]))
+		if length < 2 {
+			return fmt.Errorf("无效的JPEG段长度")
+		}
+		payload := make([]byte, length-2)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return err
+		}
+
+		switch marker[1] {
+		case markerAPP1:
+			if !orientationWritten && bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+				orientationWritten = true
+				if o := imageprocessor.ReadOrientation(bytes.NewReader(payload)); o > 1 {
+					if _, err := bw.Write(orientationSegment(o)); err != nil {
+						return err
+					}
+				}
+			}
+			continue
+		case markerAPPD, markerCOM:
+			continue
+		}
+
+		if _, err := bw.Write(marker[:]); err != nil {
+			return err
+		}
+		if _, err := bw.Write(lengthBytes[:]); err != nil {
+			return err
+		}
+		if _, err := bw.Write(payload); err != nil {
+			return err
+		}
+	}
+}
+
+// orientationSegment 构造只包含方向标记的APP1 EXIF段
+func orientationSegment(orientation int) []byte {
+	tiff := []byte{
+		'M', 'M', 0x00, 0x2A, // 大端TIFF头
+		0x00, 0x00, 0x00, 0x08, // IFD0偏移
+		0x00, 0x01, // 1个条目
+		0x01, 0x12, // Orientation
+		0x00, 0x03, // SHORT
+		0x00, 0x00, 0x00, 0x01, // 数量1
+		0x00, byte(orientation), 0x00, 0x00, // 值
+		0x00, 0x00, 0x00, 0x00, // 没有下一个IFD
+	}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+
+	segment := []byte{0xFF, markerAPP1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
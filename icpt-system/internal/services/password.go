@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"icpt-system/internal/config"
+	"icpt-system/internal/mailer"
+	"icpt-system/internal/models"
+	"icpt-system/internal/store"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultPasswordResetExpiry 未配置时重置链接的有效期
+const defaultPasswordResetExpiry = 30 * time.Minute
+
+var (
+	// ErrWrongPassword 当前密码不正确
+	ErrWrongPassword = errors.New("当前密码不正确")
+
+	// ErrResetTokenInvalid 重置令牌不存在、已使用或已过期
+	ErrResetTokenInvalid = errors.New("重置链接无效或已过期")
+)
+
+// passwordResetExpiry 返回配置的重置链接有效期
+func passwordResetExpiry() time.Duration {
+	if minutes := config.Cfg.PasswordReset.Expiry; minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return defaultPasswordResetExpiry
+}
+
+// passwordResetLink 返回带令牌的前端重置密码页面地址
+func passwordResetLink(token string) string {
+	base := config.Cfg.PasswordReset.URL
+	if base == "" {
+		base = strings.TrimSuffix(config.Cfg.Server.PublicHost, "/") + "/reset-password"
+	}
+	sep := "?"
+	if strings.Contains(base, "?") {
+		sep = "&"
+	}
+	return base + sep + "token=" + url.QueryEscape(token)
+}
+
+// ChangePassword 校验当前密码后修改密码，并作废用户的全部会话
+// 调用方需要为当前客户端重新签发令牌
+func ChangePassword(ctx context.Context, user *models.User, currentPassword, newPassword string) error {
+	if !user.CheckPassword(currentPassword) {
+		return ErrWrongPassword
+	}
+	if err := user.HashPassword(newPassword); err != nil {
+		return err
+	}
+	if err := store.DB.Model(user).Update("password_hash", user.PasswordHash).Error; err != nil {
+		return err
+	}
+	return RevokeUserSessions(ctx, user.ID)
+}
+
+// RequestPasswordReset 为邮箱对应的用户生成一次性重置令牌并发送邮件
+// 邮箱不存在或账户不可用时同样返回nil，避免通过该接口探测注册邮箱；
+// 邮件在后台发送，避免发送耗时暴露邮箱是否存在
+func RequestPasswordReset(email string) error {
+	var user models.User
+	err := store.DB.Where("email = ?", email).First(&user).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.Status != models.StatusActive {
+		return nil
+	}
+
+	raw, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	expiry := passwordResetExpiry()
+
+	err = store.DB.Transaction(func(tx *gorm.DB) error {
+		// 新的重置请求使之前未使用的链接失效
+		err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: hashToken(raw),
+			ExpiresAt: time.Now().Add(expiry),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "ICPT 重置密码",
+		Body: fmt.Sprintf("%s，您好：\n\n我们收到了重置您账户密码的请求。请在 %d 分钟内打开以下链接设置新密码：\n\n%s\n\n链接只能使用一次。如果这不是您本人的操作，请忽略此邮件，您的密码不会改变。\n",
+			user.Username, int(expiry/time.Minute), passwordResetLink(raw)),
+	}
+	go func() {
+		if err := mailer.Default.Send(context.Background(), msg); err != nil {
+			log.Printf("发送重置密码邮件失败 (用户ID: %d): %v", user.ID, err)
+		}
+	}()
+
+	log.Printf("用户申请重置密码: %s (ID: %d)", user.Username, user.ID)
+	return nil
+}
+
+// ResetPassword 使用重置令牌设置新密码，令牌随即失效，并作废用户的全部会话
+func ResetPassword(ctx context.Context, raw, newPassword string) error {
+	var user models.User
+	err := store.DB.Transaction(func(tx *gorm.DB) error {
+		var token models.PasswordResetToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashToken(raw)).First(&token).Error
+		if err == gorm.ErrRecordNotFound {
+			return ErrResetTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+		if token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+			return ErrResetTokenInvalid
+		}
+
+		if err := tx.First(&user, token.UserID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrResetTokenInvalid
+			}
+			return err
+		}
+		if err := user.HashPassword(newPassword); err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Update("password_hash", user.PasswordHash).Error; err != nil {
+			return err
+		}
+
+		// 条件更新：同一令牌只能成功使用一次
+		result := tx.Model(&models.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", token.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrResetTokenInvalid
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("用户重置密码成功: %s (ID: %d)", user.Username, user.ID)
+	return RevokeUserSessions(ctx, user.ID)
+}
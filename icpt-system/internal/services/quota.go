@@ -0,0 +1,158 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"icpt-system/internal/config"
+	"icpt-system/internal/models"
+	"icpt-system/internal/store"
+
+	"gorm.io/gorm"
+)
+
+// QuotaUsage 用户的配额和当前用量，上限为0表示不限制
+type QuotaUsage struct {
+	StorageUsed     int64 `json:"storage_used"`
+	MaxStorageBytes int64 `json:"max_storage_bytes"`
+	ImageCount      int64 `json:"image_count"`
+	MaxImages       int64 `json:"max_images"`
+}
+
+// QuotaExceededError 上传会超出配额
+type QuotaExceededError struct {
+	Usage QuotaUsage
+}
+
+func (e *QuotaExceededError) Error() string {
+	u := e.Usage
+	if u.MaxImages > 0 && u.ImageCount >= u.MaxImages {
+		return fmt.Sprintf("图片数量已达上限 (%d 张)", u.MaxImages)
+	}
+	return fmt.Sprintf("存储空间不足，已使用 %.1f MB / %.1f MB",
+		float64(u.StorageUsed)/(1<<20), float64(u.MaxStorageBytes)/(1<<20))
+}
+
+// defaultQuota 返回配置中的默认配额
+func defaultQuota() (maxBytes, maxImages int64) {
+	return int64(config.Cfg.Quota.MaxStorage) << 20, int64(config.Cfg.Quota.MaxImages)
+}
+
+// Quota 返回用户的有效配额和用量，未单独设置的上限使用配置中的默认值
+func Quota(user *models.User) QuotaUsage {
+	maxBytes, maxImages := defaultQuota()
+	if user.MaxStorageBytes != nil {
+		maxBytes = *user.MaxStorageBytes
+	}
+	if user.MaxImages != nil {
+		maxImages = *user.MaxImages
+	}
+	return QuotaUsage{
+		StorageUsed:     user.StorageUsed,
+		MaxStorageBytes: maxBytes,
+		ImageCount:      user.ImageCount,
+		MaxImages:       maxImages,
+	}
+}
+
+// GetQuota 查询用户的有效配额和用量
+func GetQuota(userID uint) (*QuotaUsage, error) {
+	var user models.User
+	if err := store.DB.Select("id", "max_storage_bytes", "max_images", "storage_used", "image_count").
+		First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	usage := Quota(&user)
+	return &usage, nil
+}
+
+// CheckQuota 检查用户是否还能上传 size 字节的图片，不占用配额
+// 用于分片上传开始前提前拒绝，最终以 ReserveQuota 为准
+func CheckQuota(userID uint, size int64) error {
+	usage, err := GetQuota(userID)
+	if err != nil {
+		return err
+	}
+	if exceeds(usage, size) {
+		return &QuotaExceededError{Usage: *usage}
+	}
+	return nil
+}
+
+// exceeds 判断再增加一张 size 字节的图片是否超出配额
+func exceeds(u *QuotaUsage, size int64) bool {
+	return (u.MaxStorageBytes > 0 && u.StorageUsed+size > u.MaxStorageBytes) ||
+		(u.MaxImages > 0 && u.ImageCount+1 > u.MaxImages)
+}
+
+// ReserveQuota 为一张新图片占用配额，超出时返回 *QuotaExceededError
+// 检查和增加用量在同一条UPDATE中完成，并发上传不会同时通过检查而超出配额
+func ReserveQuota(userID uint, size int64) error {
+	maxBytes, maxImages := defaultQuota()
+	result := store.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Where("(COALESCE(max_storage_bytes, ?) = 0 OR storage_used + ? <= COALESCE(max_storage_bytes, ?))", maxBytes, size, maxBytes).
+		Where("(COALESCE(max_images, ?) = 0 OR image_count + 1 <= COALESCE(max_images, ?))", maxImages, maxImages).
+		UpdateColumns(map[string]interface{}{
+			"storage_used": gorm.Expr("storage_used + ?", size),
+			"image_count":  gorm.Expr("image_count + 1"),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	usage, err := GetQuota(userID)
+	if err != nil {
+		return err
+	}
+	return &QuotaExceededError{Usage: *usage}
+}
+
+// AdjustUsage 增减用户的存储用量和图片数量，结果不会小于0
+// tx 可以是事务，使用量与图片记录的修改一起提交
+func AdjustUsage(tx *gorm.DB, userID uint, bytes, images int64) error {
+	if bytes == 0 && images == 0 {
+		return nil
+	}
+	return tx.Model(&models.User{}).Where("id = ?", userID).UpdateColumns(map[string]interface{}{
+		"storage_used": gorm.Expr("CASE WHEN storage_used + ? < 0 THEN 0 ELSE storage_used + ? END", bytes, bytes),
+		"image_count":  gorm.Expr("CASE WHEN image_count + ? < 0 THEN 0 ELSE image_count + ? END", images, images),
+	}).Error
+}
+
+// ImageUsage 返回图片计入配额的字节数：当前原图、保留的未压缩原图和全部衍生图
+// 必须在删除衍生图记录之前调用
+func ImageUsage(images []models.Image) (int64, error) {
+	if len(images) == 0 {
+		return 0, nil
+	}
+
+	var total int64
+	ids := make([]uint, len(images))
+	for i, image := range images {
+		ids[i] = image.ID
+		total += image.FileSize
+		if image.RawOriginalPath != "" {
+			total += image.OriginalSize
+		}
+	}
+
+	var renditions int64
+	if err := store.DB.Model(&models.ImageRendition{}).
+		Where("image_id IN ?", ids).
+		Select("COALESCE(SUM(file_size), 0)").
+		Scan(&renditions).Error; err != nil {
+		return 0, err
+	}
+	return total + renditions, nil
+}
+
+// IsQuotaExceeded 判断错误是否为超出配额
+func IsQuotaExceeded(err error) (*QuotaExceededError, bool) {
+	var quotaErr *QuotaExceededError
+	ok := errors.As(err, &quotaErr)
+	return quotaErr, ok
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"icpt-system/internal/config"
+	"icpt-system/internal/models"
+	"icpt-system/internal/store"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultRefreshTokenTTL 未配置时刷新令牌的有效期
+const defaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+var (
+	// ErrRefreshTokenInvalid 刷新令牌不存在、已过期或用户已被禁用
+	ErrRefreshTokenInvalid = errors.New("刷新令牌无效或已过期")
+
+	// ErrRefreshTokenReused 已轮换的刷新令牌被再次使用，同一登录下的所有令牌都已作废
+	ErrRefreshTokenReused = errors.New("刷新令牌已被使用，请重新登录")
+)
+
+// refreshTokenTTL 返回配置的刷新令牌有效期
+func refreshTokenTTL() time.Duration {
+	if days := config.Cfg.JWT.RefreshDays; days > 0 {
+		return time.Duration(days) * 24 * time.Hour
+	}
+	return defaultRefreshTokenTTL
+}
+
+// newOpaqueToken 生成发给客户端的随机令牌（刷新令牌、重置密码令牌）
+func newOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken 返回令牌的SHA-256（十六进制），数据库中只保存哈希
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// createRefreshToken 在 familyID 下签发一个新的刷新令牌，返回令牌原文和记录
+func createRefreshToken(tx *gorm.DB, userID uint, familyID string) (string, *models.RefreshToken, error) {
+	raw, err := newOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	record := &models.RefreshToken{
+		UserID:    userID,
+		TokenHash: hashToken(raw),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(refreshTokenTTL()),
+	}
+	if err := tx.Create(record).Error; err != nil {
+		return "", nil, err
+	}
+	return raw, record, nil
+}
+
+// authResponse 为用户签发访问令牌，并与刷新令牌一起组成响应
+func authResponse(user *models.User, refreshToken string) (*models.AuthResponse, error) {
+	token, err := GenerateToken(user.ID, user.Username, user.Role)
+	if err != nil {
+		return nil, err
+	}
+	return &models.AuthResponse{
+		User:         user,
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(AccessTokenTTL() / time.Second),
+	}, nil
+}
+
+// IssueTokens 登录或注册成功后签发访问令牌和新一组刷新令牌
+func IssueTokens(user *models.User) (*models.AuthResponse, error) {
+	familyID, err := newTokenID()
+	if err != nil {
+		return nil, err
+	}
+	raw, _, err := createRefreshToken(store.DB, user.ID, familyID)
+	if err != nil {
+		return nil, err
+	}
+	return authResponse(user, raw)
+}
+
+// RefreshTokens 用刷新令牌换取新的访问令牌，并轮换刷新令牌
+// 已轮换或已登出的令牌再次出现时，作废同一登录下的全部令牌
+func RefreshTokens(raw string) (*models.AuthResponse, error) {
+	if raw == "" {
+		return nil, ErrRefreshTokenInvalid
+	}
+
+	var (
+		user         models.User
+		newRaw       string
+		reusedFamily string
+	)
+	err := store.DB.Transaction(func(tx *gorm.DB) error {
+		var current models.RefreshToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashToken(raw)).First(&current).Error
+		if err == gorm.ErrRecordNotFound {
+			return ErrRefreshTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+
+		if current.RevokedAt != nil {
+			reusedFamily = current.FamilyID
+			return ErrRefreshTokenReused
+		}
+		if time.Now().After(current.ExpiresAt) {
+			return ErrRefreshTokenInvalid
+		}
+
+		if err := tx.First(&user, current.UserID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrRefreshTokenInvalid
+			}
+			return err
+		}
+		if user.Status != models.StatusActive {
+			return ErrRefreshTokenInvalid
+		}
+
+		var next *models.RefreshToken
+		newRaw, next, err = createRefreshToken(tx, user.ID, current.FamilyID)
+		if err != nil {
+			return err
+		}
+
+		// 条件更新：并发请求使用同一令牌时只有一个能成功，另一个按重复使用处理
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", current.ID).
+			Updates(map[string]interface{}{"revoked_at": time.Now(), "replaced_by": next.ID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			reusedFamily = current.FamilyID
+			return ErrRefreshTokenReused
+		}
+		return nil
+	})
+
+	if err == ErrRefreshTokenReused {
+		log.Printf("⚠️ 检测到刷新令牌被重复使用，作废令牌组 %s", reusedFamily)
+		if revokeErr := revokeRefreshFamily(store.DB, reusedFamily); revokeErr != nil {
+			log.Printf("作废刷新令牌组失败: %v", revokeErr)
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return authResponse(&user, newRaw)
+}
+
+// RevokeRefreshToken 登出时作废刷新令牌所在的整组令牌，只允许令牌所属用户操作
+// 令牌不存在或已作废时不返回错误，登出可以重复调用
+func RevokeRefreshToken(raw string, userID uint) error {
+	if raw == "" {
+		return nil
+	}
+	var record models.RefreshToken
+	err := store.DB.Where("token_hash = ? AND user_id = ?", hashToken(raw), userID).First(&record).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return revokeRefreshFamily(store.DB, record.FamilyID)
+}
+
+// revokeRefreshFamily 作废同一组中尚未作废的刷新令牌
+func revokeRefreshFamily(db *gorm.DB, familyID string) error {
+	return db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeUserSessions 作废用户的全部刷新令牌和已签发的访问令牌，所有设备都需要重新登录
+func RevokeUserSessions(ctx context.Context, userID uint) error {
+	err := store.DB.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return err
+	}
+	return RevokeUserAccessTokens(ctx, userID)
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"icpt-system/internal/config"
+)
+
+const (
+	defaultRenderCacheDir = "uploads/cache"
+	defaultRenderQuality  = 85
+
+	// renderCacheVersion 渲染逻辑变化时递增，使旧的缓存文件失效
+	renderCacheVersion = 2
+)
+
+// defaultRenderSizes 未配置时允许的按需渲染尺寸（宽x高，0表示按另一边等比缩放）
+var defaultRenderSizes = []string{"200x200", "400x0", "800x0", "800x600", "1024x0", "1920x1080"}
+
+// defaultRenderQualities 未配置时允许的JPEG质量
+var defaultRenderQualities = []int{60, 75, 85, 95}
+
+// RenderParams 按需渲染参数
+type RenderParams struct {
+	Width   int
+	Height  int
+	Fit     string
+	Format  string
+	Quality int
+}
+
+// ParseRenderParams 解析并校验按需渲染参数
+// 尺寸和质量必须在允许列表中，避免任意参数组合被用来耗尽CPU和磁盘
+func ParseRenderParams(w, h, fit, format, q string) (RenderParams, error) {
+	params := RenderParams{
+		Fit:     FitContain,
+		Format:  FormatJPEG,
+		Quality: renderDefaultQuality(),
+	}
+
+	var err error
+	if w != "" {
+		if params.Width, err = strconv.Atoi(w); err != nil || params.Width < 0 {
+			return params, fmt.Errorf("无效的宽度: %s", w)
+		}
+	}
+	if h != "" {
+		if params.Height, err = strconv.Atoi(h); err != nil || params.Height < 0 {
+			return params, fmt.Errorf("无效的高度: %s", h)
+		}
+	}
+	if params.Width == 0 && params.Height == 0 {
+		return params, fmt.Errorf("必须指定宽度或高度")
+	}
+	if !renderSizeAllowed(params.Width, params.Height) {
+		return params, fmt.Errorf("不允许的尺寸: %dx%d，可用尺寸: %s",
+			params.Width, params.Height, strings.Join(renderSizes(), ", "))
+	}
+
+	switch fit {
+	case "":
+	case FitContain, FitCover:
+		params.Fit = fit
+	default:
+		return params, fmt.Errorf("不支持的缩放方式: %s", fit)
+	}
+
+	switch format {
+	case "":
+	case "jpg":
+		params.Format = FormatJPEG
+	case FormatJPEG, FormatPNG, FormatWebP:
+		params.Format = format
+	default:
+		return params, fmt.Errorf("不支持的输出格式: %s", format)
+	}
+
+	if q != "" {
+		if params.Quality, err = strconv.Atoi(q); err != nil || !renderQualityAllowed(params.Quality) {
+			return params, fmt.Errorf("不允许的质量参数: %s", q)
+		}
+	}
+	// 只有JPEG使用质量参数，其他格式统一缓存键
+	if params.Format != FormatJPEG {
+		params.Quality = 0
+	}
+
+	return params, nil
+}
+
+// renderSizes 返回允许的按需渲染尺寸
+func renderSizes() []string {
+	if len(config.Cfg.Render.Sizes) > 0 {
+		return config.Cfg.Render.Sizes
+	}
+	return defaultRenderSizes
+}
+
+// renderSizeAllowed 判断尺寸是否在允许列表中
+func renderSizeAllowed(width, height int) bool {
+	size := fmt.Sprintf("%dx%d", width, height)
+	for _, allowed := range renderSizes() {
+		if allowed == size {
+			return true
+		}
+	}
+	return false
+}
+
+// renderQualityAllowed 判断质量参数是否在允许列表中
+func renderQualityAllowed(quality int) bool {
+	qualities := config.Cfg.Render.Qualities
+	if len(qualities) == 0 {
+		qualities = defaultRenderQualities
+	}
+	for _, allowed := range qualities {
+		if allowed == quality {
+			return true
+		}
+	}
+	return false
+}
+
+// renderDefaultQuality 返回未指定q时使用的质量
+func renderDefaultQuality() int {
+	if q := config.Cfg.Render.DefaultQuality; q > 0 && q <= 100 {
+		return q
+	}
+	return defaultRenderQuality
+}
+
+// renderCacheDir 返回按需渲染结果的缓存目录
+func renderCacheDir() string {
+	if config.Cfg.Render.CacheDir != "" {
+		return config.Cfg.Render.CacheDir
+	}
+	return defaultRenderCacheDir
+}
+
+// CacheKey 计算缓存键；source标识原图的版本（路径变化时缓存自动失效）
+func (p RenderParams) CacheKey(imageID uint, source string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("v%d|%d|%s|%d|%d|%s|%s|%d",
+		renderCacheVersion, imageID, source, p.Width, p.Height, p.Fit, p.Format, p.Quality)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// RenderCached 返回按需渲染结果的缓存文件路径和缓存键，缓存不存在时从存储中的原图生成
+// 渲染缓存可以随时重建，始终保存在本地磁盘上
+func RenderCached(originalKey string, imageID uint, params RenderParams) (string, string, error) {
+	key := params.CacheKey(imageID, originalKey)
+	dir := filepath.Join(renderCacheDir(), strconv.FormatUint(uint64(imageID), 10))
+	cachePath := filepath.Join(dir, key+FormatExtension(params.Format))
+
+	if _, err := os.Stat(cachePath); err == nil {
+		return cachePath, key, nil
+	}
+
+	img, _, err := DecodeImageFile(originalKey)
+	if err != nil {
+		return "", "", err
+	}
+	resized := ResizeImage(img, params.Width, params.Height, params.Fit)
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", "", fmt.Errorf("无法创建缓存目录")
+	}
+
+	// 先写临时文件再重命名，并发请求同一参数时不会读到写了一半的文件
+	tmp, err := os.CreateTemp(dir, key+"-*.tmp")
+	if err != nil {
+		return "", "", fmt.Errorf("无法写入缓存文件")
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := EncodeImage(tmp, resized, params.Format, params.Quality); err != nil {
+		tmp.Close()
+		return "", "", fmt.Errorf("无法编码图像: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", "", fmt.Errorf("无法写入缓存文件")
+	}
+	if err := os.Rename(tmp.Name(), cachePath); err != nil {
+		return "", "", fmt.Errorf("无法写入缓存文件")
+	}
+
+	return cachePath, key, nil
+}
+
+// PurgeRenderCache 删除图片的全部按需渲染缓存
+func PurgeRenderCache(imageID uint) error {
+	return os.RemoveAll(filepath.Join(renderCacheDir(), strconv.FormatUint(uint64(imageID), 10)))
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"path"
+
+	"icpt-system/internal/config"
+	"icpt-system/internal/storage"
+	"icpt-system/pkg/imageprocessor"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/nfnt/resize"
+)
+
+const (
+	renditionPath = "renditions"
+
+	// ThumbnailRendition 缩略图衍生图名称，其路径同时写入 Image.ThumbnailPath
+	ThumbnailRendition = "thumbnail"
+
+	// 缩放方式
+	FitContain = "contain" // 等比缩放到完整放入目标框内
+	FitCover   = "cover"   // 等比缩放到填满目标框，居中裁剪多余部分
+
+	// 输出格式
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatWebP = "webp"
+
+	defaultQuality = 85
+)
+
+// defaultThumbnailSpec 未配置缩略图时使用的默认规格，与历史的400px宽JPEG缩略图一致
+var defaultThumbnailSpec = config.Rendition{
+	Name:    ThumbnailRendition,
+	Width:   thumbWidth,
+	Fit:     FitContain,
+	Format:  FormatJPEG,
+	Quality: 75,
+}
+
+// RenditionResult 生成的一个衍生图
+type RenditionResult struct {
+	Name     string
+	Path     string
+	Width    int
+	Height   int
+	Format   string
+	FileSize int64
+}
+
+// RenditionSpecs 返回配置的衍生图规格，始终包含缩略图
+func RenditionSpecs() []config.Rendition {
+	specs := make([]config.Rendition, 0, len(config.Cfg.Renditions)+1)
+	hasThumbnail := false
+	for _, spec := range config.Cfg.Renditions {
+		if spec.Name == ThumbnailRendition {
+			hasThumbnail = true
+		}
+		specs = append(specs, normalizeSpec(spec))
+	}
+	if !hasThumbnail {
+		specs = append([]config.Rendition{defaultThumbnailSpec}, specs...)
+	}
+	return specs
+}
+
+// FindRenditionSpec 按名称查找衍生图规格
+func FindRenditionSpec(name string) (config.Rendition, bool) {
+	for _, spec := range RenditionSpecs() {
+		if spec.Name == name {
+			return spec, true
+		}
+	}
+	return config.Rendition{}, false
+}
+
+// normalizeSpec 为未填写的规格项补充默认值
+func normalizeSpec(spec config.Rendition) config.Rendition {
+	if spec.Fit == "" {
+		spec.Fit = FitContain
+	}
+	if spec.Format == "" {
+		spec.Format = FormatJPEG
+	}
+	if spec.Quality < 1 || spec.Quality > 100 {
+		spec.Quality = defaultQuality
+	}
+	return spec
+}
+
+// DecodeImageFile 从存储读取并解码图像，返回图像和格式名称
+// JPEG会按EXIF方向标记转正，手机拍摄的竖拍照片生成的衍生图方向才正确
+func DecodeImageFile(key string) (image.Image, string, error) {
+	data, err := storage.ReadAll(context.Background(), storage.Backend, key)
+	if err != nil {
+		log.Printf("错误: 读取原始文件 %s 失败: %v", key, err)
+		return nil, "", fmt.Errorf("无法打开原始文件")
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		log.Printf("错误: 解码图像 %s 失败: %v", key, err)
+		return nil, "", fmt.Errorf("无法解码图像，可能是不支持的格式")
+	}
+
+	if format == "jpeg" {
+		img = imageprocessor.ApplyOrientation(img, imageprocessor.ReadOrientation(bytes.NewReader(data)))
+	}
+	return img, format, nil
+}
+
+// ResizeImage 按目标尺寸和缩放方式调整图像，不会放大小于目标尺寸的图像
+func ResizeImage(img image.Image, width, height int, fit string) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	// 只指定了一条边：按该边等比缩放
+	if width <= 0 || height <= 0 {
+		if (width > 0 && srcW <= width) || (height > 0 && srcH <= height) || (width <= 0 && height <= 0) {
+			return img
+		}
+		return resize.Resize(uint(max(width, 0)), uint(max(height, 0)), img, resize.Lanczos3)
+	}
+
+	if fit != FitCover {
+		return resize.Thumbnail(uint(width), uint(height), img, resize.Lanczos3)
+	}
+
+	// cover：先等比缩放到刚好覆盖目标框，再居中裁剪
+	scale := max(float64(width)/float64(srcW), float64(height)/float64(srcH))
+	if scale > 1 {
+		scale = 1 // 不放大，原图不足时裁剪出尽可能大的区域
+	}
+	scaledW := int(float64(srcW)*scale + 0.5)
+	scaledH := int(float64(srcH)*scale + 0.5)
+	scaled := img
+	if scale < 1 {
+		scaled = resize.Resize(uint(scaledW), uint(scaledH), img, resize.Lanczos3)
+	}
+
+	cropW, cropH := min(width, scaledW), min(height, scaledH)
+	sb := scaled.Bounds()
+	x0 := sb.Min.X + (sb.Dx()-cropW)/2
+	y0 := sb.Min.Y + (sb.Dy()-cropH)/2
+
+	if sub, ok := scaled.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(image.Rect(x0, y0, x0+cropW, y0+cropH))
+	}
+	return scaled
+}
+
+// EncodeImage 按指定格式编码图像
+func EncodeImage(w io.Writer, img image.Image, format string, quality int) error {
+	switch format {
+	case FormatJPEG, "jpg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	case FormatPNG:
+		return png.Encode(w, img)
+	case FormatWebP:
+		// 纯Go WebP编码器只支持无损(VP8L)模式，quality参数不生效
+		return nativewebp.Encode(w, img, nil)
+	default:
+		return fmt.Errorf("不支持的输出格式: %s", format)
+	}
+}
+
+// FormatExtension 返回输出格式对应的文件扩展名
+func FormatExtension(format string) string {
+	switch format {
+	case FormatPNG:
+		return ".png"
+	case FormatWebP:
+		return ".webp"
+	default:
+		return ".jpg"
+	}
+}
+
+// FormatContentType 返回输出格式对应的MIME类型
+func FormatContentType(format string) string {
+	switch format {
+	case FormatPNG:
+		return "image/png"
+	case FormatWebP:
+		return "image/webp"
+	default:
+		return "image/jpeg"
+	}
+}
+
+// GenerateRenditions 为图片生成一组衍生图
+// 文件名由图片ID和衍生图名称确定，重复处理同一图片时会覆盖旧文件
+func GenerateRenditions(originalKey string, imageID uint, specs []config.Rendition) ([]RenditionResult, error) {
+	img, _, err := DecodeImageFile(originalKey)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]RenditionResult, 0, len(specs))
+	for _, spec := range specs {
+		result, err := generateRendition(img, imageID, spec)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// generateRendition 生成单个衍生图并写入存储
+func generateRendition(img image.Image, imageID uint, spec config.Rendition) (RenditionResult, error) {
+	spec = normalizeSpec(spec)
+	resized := ResizeImage(img, spec.Width, spec.Height, spec.Fit)
+
+	var buf bytes.Buffer
+	if err := EncodeImage(&buf, resized, spec.Format, spec.Quality); err != nil {
+		log.Printf("错误: 编码衍生图 %s/%d 失败: %v", spec.Name, imageID, err)
+		return RenditionResult{}, fmt.Errorf("无法保存衍生图 %s", spec.Name)
+	}
+
+	key := path.Join(renditionPath, spec.Name, fmt.Sprintf("%d%s", imageID, FormatExtension(spec.Format)))
+	size := int64(buf.Len())
+	if err := storage.Backend.Put(context.Background(), key, &buf, size, FormatContentType(spec.Format)); err != nil {
+		log.Printf("错误: 写入衍生图 %s 失败: %v", key, err)
+		return RenditionResult{}, fmt.Errorf("无法保存衍生图 %s", spec.Name)
+	}
+
+	bounds := resized.Bounds()
+	return RenditionResult{
+		Name:     spec.Name,
+		Path:     key,
+		Width:    bounds.Dx(),
+		Height:   bounds.Dy(),
+		Format:   spec.Format,
+		FileSize: size,
+	}, nil
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret RFC 6238 附录B中SHA-1测试向量使用的密钥 "12345678901234567890"
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+// TestTOTPCodeRFC6238 RFC 6238 附录B的SHA-1测试向量；向量为8位，6位验证码取其后6位
+func TestTOTPCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	key := []byte("12345678901234567890")
+
+	for _, tt := range tests {
+		want := tt.code[len(tt.code)-totpDigits:]
+		if got := totpCode(key, tt.unix/totpPeriod); got != want {
+			t.Errorf("totpCode(T=%d) = %s, want %s", tt.unix, got, want)
+		}
+
+		step, ok := matchTOTP(rfc6238Secret, want, 0, time.Unix(tt.unix, 0))
+		if !ok || step != tt.unix/totpPeriod {
+			t.Errorf("matchTOTP(T=%d) = %d, %v, want %d, true", tt.unix, step, ok, tt.unix/totpPeriod)
+		}
+	}
+}
+
+// TestMatchTOTPSkew 前后一个时间步内的验证码有效，超出后无效
+func TestMatchTOTPSkew(t *testing.T) {
+	key := []byte("12345678901234567890")
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / totpPeriod
+
+	for offset := int64(-3); offset <= 3; offset++ {
+		code := totpCode(key, current+offset)
+		_, ok := matchTOTP(rfc6238Secret, code, 0, now)
+		if want := offset >= -totpSkew && offset <= totpSkew; ok != want {
+			t.Errorf("偏差 %d 个时间步: ok = %v, want %v", offset, ok, want)
+		}
+	}
+}
+
+// TestMatchTOTPReplay 已使用的时间步及更早的时间步不能再次使用
+func TestMatchTOTPReplay(t *testing.T) {
+	key := []byte("12345678901234567890")
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / totpPeriod
+	code := totpCode(key, current)
+
+	step, ok := matchTOTP(rfc6238Secret, code, 0, now)
+	if !ok || step != current {
+		t.Fatalf("首次使用: step = %d, ok = %v", step, ok)
+	}
+	if _, ok := matchTOTP(rfc6238Secret, code, step, now); ok {
+		t.Fatal("同一时间步的验证码被重复接受")
+	}
+	if _, ok := matchTOTP(rfc6238Secret, totpCode(key, current-1), step, now); ok {
+		t.Fatal("已使用时间步之前的验证码被接受")
+	}
+	if _, ok := matchTOTP(rfc6238Secret, totpCode(key, current+1), step, now); !ok {
+		t.Fatal("下一个时间步的验证码被拒绝")
+	}
+}
+
+// TestMatchTOTPInvalid 格式错误的密钥或验证码直接拒绝
+func TestMatchTOTPInvalid(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	for _, tt := range []struct{ secret, code string }{
+		{"not base32!", "123456"},
+		{rfc6238Secret, ""},
+		{rfc6238Secret, "12345"},
+		{rfc6238Secret, "1234567"},
+	} {
+		if _, ok := matchTOTP(tt.secret, tt.code, 0, now); ok {
+			t.Errorf("matchTOTP(%q, %q) 通过了校验", tt.secret, tt.code)
+		}
+	}
+}
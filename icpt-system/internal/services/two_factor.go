@@ -0,0 +1,290 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"icpt-system/internal/config"
+	"icpt-system/internal/models"
+	"icpt-system/internal/store"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultChallengeTTL 未配置时两步登录挑战令牌的有效期
+	defaultChallengeTTL = 5 * time.Minute
+
+	// maxChallengeAttempts 每个挑战令牌允许提交验证码的次数，用完后需要重新输入密码
+	maxChallengeAttempts = 5
+
+	// recoveryCodeCount 每次生成的恢复码数量
+	recoveryCodeCount = 10
+
+	// challengePrefix 挑战令牌的Redis键前缀：icpt:2fa:challenge:{令牌SHA-256}，值为用户ID
+	challengePrefix = "icpt:2fa:challenge:"
+)
+
+var (
+	// ErrTwoFactorEnabled 已开启两步验证，需要先关闭才能重新绑定
+	ErrTwoFactorEnabled = errors.New("已开启两步验证")
+
+	// ErrTwoFactorNotEnabled 未开启两步验证
+	ErrTwoFactorNotEnabled = errors.New("未开启两步验证")
+
+	// ErrTwoFactorNotSetup 确认绑定前没有生成密钥
+	ErrTwoFactorNotSetup = errors.New("请先获取两步验证密钥")
+
+	// ErrInvalidOTP 验证码或恢复码错误
+	ErrInvalidOTP = errors.New("验证码错误")
+
+	// ErrChallengeInvalid 挑战令牌不存在、已过期或尝试次数已用完
+	ErrChallengeInvalid = errors.New("登录验证已过期，请重新登录")
+)
+
+// challengeTTL 返回配置的挑战令牌有效期
+func challengeTTL() time.Duration {
+	if minutes := config.Cfg.TwoFactor.ChallengeMinutes; minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return defaultChallengeTTL
+}
+
+// twoFactorIssuer 返回验证器应用中显示的服务名称
+func twoFactorIssuer() string {
+	if issuer := config.Cfg.TwoFactor.Issuer; issuer != "" {
+		return issuer
+	}
+	return "ICPT"
+}
+
+// BeginTwoFactorSetup 为用户生成新的TOTP密钥，返回密钥和 otpauth:// 地址
+// 用户确认验证码之前两步验证不生效，重复调用会替换未确认的密钥
+func BeginTwoFactorSetup(user *models.User) (secret, uri string, err error) {
+	if user.TwoFactorEnabled {
+		return "", "", ErrTwoFactorEnabled
+	}
+	if secret, err = newTOTPSecret(); err != nil {
+		return "", "", err
+	}
+	if err = store.DB.Model(user).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error; err != nil {
+		return "", "", err
+	}
+	return secret, totpProvisioningURI(twoFactorIssuer(), user.Username, secret), nil
+}
+
+// EnableTwoFactor 校验验证码后开启两步验证并生成恢复码，用户的全部会话失效
+// 调用方需要为当前客户端重新签发令牌
+func EnableTwoFactor(ctx context.Context, user *models.User, code string) ([]string, error) {
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotSetup
+	}
+	step, ok := matchTOTP(user.TOTPSecret, normalizeCode(code), user.TOTPLastStep, time.Now())
+	if !ok {
+		return nil, ErrInvalidOTP
+	}
+
+	var codes []string
+	err := store.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(user).Updates(map[string]interface{}{"two_factor_enabled": true, "totp_last_step": step}).Error
+		if err != nil {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, RevokeUserSessions(ctx, user.ID)
+}
+
+// DisableTwoFactor 校验密码和验证码（或恢复码）后关闭两步验证，删除密钥和恢复码
+func DisableTwoFactor(user *models.User, password, code string) error {
+	if !user.TwoFactorEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+	if !user.CheckPassword(password) {
+		return ErrWrongPassword
+	}
+	if err := VerifySecondFactor(user, code); err != nil {
+		return err
+	}
+	return ResetTwoFactor(user.ID)
+}
+
+// ResetTwoFactor 关闭用户的两步验证，管理员为丢失验证器和恢复码的用户重置时使用
+func ResetTwoFactor(userID uint) error {
+	return store.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{"two_factor_enabled": false, "totp_secret": "", "totp_last_step": 0}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+}
+
+// RegenerateRecoveryCodes 校验验证码后生成新的恢复码，原有的恢复码全部失效
+func RegenerateRecoveryCodes(user *models.User, code string) ([]string, error) {
+	if !user.TwoFactorEnabled {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	if err := verifyTOTP(user, code); err != nil {
+		return nil, err
+	}
+	var codes []string
+	err := store.DB.Transaction(func(tx *gorm.DB) (err error) {
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	return codes, err
+}
+
+// VerifySecondFactor 校验验证码或恢复码，两者都只能使用一次
+func VerifySecondFactor(user *models.User, code string) error {
+	code = normalizeCode(code)
+	if len(code) == totpDigits {
+		return verifyTOTP(user, code)
+	}
+
+	result := store.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashToken(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidOTP
+	}
+	return nil
+}
+
+// verifyTOTP 校验验证码并记录时间步；条件更新保证同一验证码在并发请求中也只能使用一次
+func verifyTOTP(user *models.User, code string) error {
+	step, ok := matchTOTP(user.TOTPSecret, normalizeCode(code), user.TOTPLastStep, time.Now())
+	if !ok {
+		return ErrInvalidOTP
+	}
+	result := store.DB.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidOTP
+	}
+	user.TOTPLastStep = step
+	return nil
+}
+
+// normalizeCode 去掉用户输入中的空格和连字符，恢复码不区分大小写
+func normalizeCode(code string) string {
+	code = strings.NewReplacer(" ", "", "-", "").Replace(code)
+	return strings.ToUpper(code)
+}
+
+// replaceRecoveryCodes 删除用户原有的恢复码并生成新的一组，返回恢复码原文
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	records := make([]models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		// 80位随机数，Base32编码为16个字符，按4位分组便于抄写
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := base32.StdEncoding.EncodeToString(b)
+		codes[i] = fmt.Sprintf("%s-%s-%s-%s", raw[0:4], raw[4:8], raw[8:12], raw[12:16])
+		records[i] = models.RecoveryCode{UserID: userID, CodeHash: hashToken(raw)}
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// CreateLoginChallenge 密码验证通过后为开启两步验证的用户创建挑战令牌
+func CreateLoginChallenge(ctx context.Context, user *models.User) (*models.TwoFactorChallenge, error) {
+	raw, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	ttl := challengeTTL()
+	if err := store.Rdb.Set(ctx, challengePrefix+hashToken(raw), user.ID, ttl).Err(); err != nil {
+		return nil, err
+	}
+	return &models.TwoFactorChallenge{
+		TwoFactorRequired: true,
+		ChallengeToken:    raw,
+		ExpiresIn:         int64(ttl / time.Second),
+	}, nil
+}
+
+// LoginChallengeUser 返回挑战令牌所属的用户；令牌无效或用户已不能登录时返回 ErrChallengeInvalid
+func LoginChallengeUser(ctx context.Context, token string) (*models.User, error) {
+	key := challengePrefix + hashToken(token)
+	userID, err := store.Rdb.Get(ctx, key).Uint64()
+	if err == redis.Nil {
+		return nil, ErrChallengeInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := store.DB.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrChallengeInvalid
+		}
+		return nil, err
+	}
+	if user.Status != models.StatusActive || !user.TwoFactorEnabled {
+		store.Rdb.Del(ctx, key)
+		return nil, ErrChallengeInvalid
+	}
+	return &user, nil
+}
+
+// CompleteLoginChallenge 校验验证码（或恢复码）完成两步登录，成功后挑战令牌失效
+// 错误次数达到上限后令牌作废，需要重新输入密码
+func CompleteLoginChallenge(ctx context.Context, token string, user *models.User, code string) error {
+	key := challengePrefix + hashToken(token)
+	attemptsKey := key + ":attempts"
+
+	if err := VerifySecondFactor(user, code); err != nil {
+		if err == ErrInvalidOTP {
+			attempts, _ := store.Rdb.Incr(ctx, attemptsKey).Result()
+			store.Rdb.Expire(ctx, attemptsKey, challengeTTL())
+			if attempts >= maxChallengeAttempts {
+				store.Rdb.Del(ctx, key, attemptsKey)
+			}
+		}
+		return err
+	}
+
+	// 令牌只能使用一次，并发请求中只有删除成功的一方完成登录
+	deleted, err := store.Rdb.Del(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrChallengeInvalid
+	}
+	store.Rdb.Del(ctx, attemptsKey)
+	return nil
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"icpt-system/internal/models"
+	"icpt-system/internal/store"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeExecFunc 处理一条写语句，返回影响的行数
+type fakeExecFunc func(query string, args []driver.NamedValue) int64
+
+// fakeDriver 只支持写语句的 database/sql 驱动，由测试按SQL模拟MySQL的条件更新
+type fakeDriver struct {
+	mu   sync.Mutex
+	exec fakeExecFunc
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{d: d}, nil }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fakedb: prepared statements not supported")
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	return driver.RowsAffected(c.d.exec(query, args)), nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+var (
+	fakeDB       = &fakeDriver{}
+	registerOnce sync.Once
+)
+
+// useFakeDB 让 store.DB 使用假驱动，写语句交给 exec 处理
+func useFakeDB(t *testing.T, exec fakeExecFunc) {
+	t.Helper()
+	registerOnce.Do(func() { sql.Register("icpt-fakedb", fakeDB) })
+	fakeDB.mu.Lock()
+	fakeDB.exec = exec
+	fakeDB.mu.Unlock()
+
+	sqlDB, err := sql.Open("icpt-fakedb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}),
+		&gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := store.DB
+	store.DB = db
+	t.Cleanup(func() {
+		store.DB = previous
+		sqlDB.Close()
+	})
+}
+
+// TestRecoveryCodeSingleUse 恢复码只能使用一次；输入时的空格、连字符和大小写不影响匹配
+func TestRecoveryCodeSingleUse(t *testing.T) {
+	const raw = "ABCDEFGHIJKLMNOP"
+	used := map[string]bool{hashToken(raw): false} // 恢复码哈希 -> 是否已使用
+
+	useFakeDB(t, func(query string, args []driver.NamedValue) int64 {
+		// UPDATE `recovery_codes` SET `used_at`=? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+		if !strings.Contains(query, "`recovery_codes`") || !strings.Contains(query, "used_at IS NULL") {
+			t.Fatalf("意外的语句: %s", query)
+		}
+		hash := args[len(args)-1].Value.(string)
+		if done, ok := used[hash]; !ok || done {
+			return 0
+		}
+		used[hash] = true
+		return 1
+	})
+
+	user := &models.User{ID: 1}
+	if err := VerifySecondFactor(user, "abcd-efgh ijkl-mnop"); err != nil {
+		t.Fatalf("首次使用恢复码: %v", err)
+	}
+	if err := VerifySecondFactor(user, raw); !errors.Is(err, ErrInvalidOTP) {
+		t.Fatalf("再次使用恢复码: err = %v, want ErrInvalidOTP", err)
+	}
+	if err := VerifySecondFactor(user, "QRST-UVWX-YZ23-4567"); !errors.Is(err, ErrInvalidOTP) {
+		t.Fatalf("不存在的恢复码: err = %v, want ErrInvalidOTP", err)
+	}
+}
+
+// TestVerifyTOTPReplay 同一个验证码在校验通过并记录时间步后不能再次使用，
+// 并发请求通过条件更新只有一个成功
+func TestVerifyTOTPReplay(t *testing.T) {
+	var lastStep int64
+	useFakeDB(t, func(query string, args []driver.NamedValue) int64 {
+		// UPDATE `users` SET `totp_last_step`=?,`updated_at`=? WHERE id = ? AND totp_last_step < ?
+		if !strings.Contains(query, "`users`") || !strings.Contains(query, "totp_last_step < ?") {
+			t.Fatalf("意外的语句: %s", query)
+		}
+		step := args[0].Value.(int64)
+		if lastStep >= args[len(args)-1].Value.(int64) {
+			return 0
+		}
+		lastStep = step
+		return 1
+	})
+
+	code := totpCode([]byte("12345678901234567890"), time.Now().Unix()/totpPeriod)
+
+	// 两个请求读取到的是同一个用户状态（TOTPLastStep 为0）
+	first := &models.User{ID: 1, TOTPSecret: rfc6238Secret}
+	second := &models.User{ID: 1, TOTPSecret: rfc6238Secret}
+
+	if err := VerifySecondFactor(first, code); err != nil {
+		t.Fatalf("首次使用验证码: %v", err)
+	}
+	if first.TOTPLastStep == 0 {
+		t.Fatal("校验通过后没有记录时间步")
+	}
+	if err := VerifySecondFactor(second, code); !errors.Is(err, ErrInvalidOTP) {
+		t.Fatalf("并发重放验证码: err = %v, want ErrInvalidOTP", err)
+	}
+	if err := VerifySecondFactor(first, code); !errors.Is(err, ErrInvalidOTP) {
+		t.Fatalf("重放验证码: err = %v, want ErrInvalidOTP", err)
+	}
+}
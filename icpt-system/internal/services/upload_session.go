@@ -0,0 +1,519 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"icpt-system/internal/config"
+	"icpt-system/internal/storage"
+	"icpt-system/internal/store"
+	"icpt-system/internal/tasks"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// uploadSessionPrefix 分片上传会话的Redis哈希表前缀，后接会话ID
+	uploadSessionPrefix = "icpt:upload:"
+
+	// uploadExpiryKey 按过期时间排序的会话索引，用于清理过期会话留下的分片
+	uploadExpiryKey = "icpt:uploads:expiry"
+
+	// uploadChunkPath 分片的存储键前缀：chunks/{会话ID}/{序号}
+	uploadChunkPath = "chunks"
+
+	defaultChunkSize        = 5 << 20
+	defaultUploadSessionTTL = 24 * time.Hour
+
+	// uploadLockTTL 写入分片时持有的会话锁时长，超过后视为写入方已崩溃
+	uploadLockTTL = 5 * time.Minute
+
+	// finalizedUploadTTL 完成后保留会话的时长，客户端没收到响应重试时仍能拿到图片ID
+	finalizedUploadTTL = time.Hour
+
+	// defaultUploadCleanupInterval 清理过期会话的间隔
+	defaultUploadCleanupInterval = 10 * time.Minute
+)
+
+var (
+	// ErrUploadNotFound 会话不存在或已过期
+	ErrUploadNotFound = errors.New("上传会话不存在或已过期")
+
+	// ErrUploadOffsetMismatch 分片的偏移量与已接收的数据量不一致
+	ErrUploadOffsetMismatch = errors.New("分片偏移量与已上传的数据量不一致")
+
+	// ErrUploadBusy 会话正在写入其他分片
+	ErrUploadBusy = errors.New("上传会话正在写入其他分片")
+
+	// ErrChunkTooLarge 分片超过允许的大小或超出文件声明的大小
+	ErrChunkTooLarge = errors.New("分片过大")
+
+	// ErrUploadIncomplete 还有数据没有上传
+	ErrUploadIncomplete = errors.New("文件尚未上传完成")
+)
+
+// UploadSession 分片上传会话，保存在Redis中，任何一个API节点都可以接收后续分片
+type UploadSession struct {
+	ID        string
+	UserID    uint
+	Filename  string
+	Size      int64                  // 文件总大小
+	Offset    int64                  // 已接收的字节数
+	Chunks    int                    // 已接收的分片数
+	Optimize  *tasks.OptimizeOptions // 创建会话时确定的原图优化选项
+	ImageID   uint                   // 完成后创建的图片ID，0表示尚未完成
+	ExpiresAt time.Time
+}
+
+// UploadChunkSize 返回配置的最大分片大小
+func UploadChunkSize() int64 {
+	if mb := config.Cfg.Upload.ChunkSize; mb > 0 {
+		return int64(mb) << 20
+	}
+	return defaultChunkSize
+}
+
+// uploadSessionTTL 返回配置的会话有效期
+func uploadSessionTTL() time.Duration {
+	if hours := config.Cfg.Upload.SessionTTL; hours > 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return defaultUploadSessionTTL
+}
+
+func uploadSessionKey(id string) string {
+	return uploadSessionPrefix + id
+}
+
+func uploadLockKey(id string) string {
+	return uploadSessionPrefix + id + ":lock"
+}
+
+// uploadChunkKey 返回分片的存储键，序号补零使其按字典序排列
+func uploadChunkKey(id string, index int) string {
+	return path.Join(uploadChunkPath, id, fmt.Sprintf("%06d", index))
+}
+
+// newUploadID 生成随机会话ID
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CreateUploadSession 创建分片上传会话
+func CreateUploadSession(ctx context.Context, userID uint, filename string, size int64, optimize *tasks.OptimizeOptions) (*UploadSession, error) {
+	id, err := newUploadID()
+	if err != nil {
+		return nil, err
+	}
+
+	optimizeJSON := ""
+	if optimize != nil {
+		data, err := json.Marshal(optimize)
+		if err != nil {
+			return nil, err
+		}
+		optimizeJSON = string(data)
+	}
+
+	session := &UploadSession{
+		ID:        id,
+		UserID:    userID,
+		Filename:  filename,
+		Size:      size,
+		Optimize:  optimize,
+		ExpiresAt: time.Now().Add(uploadSessionTTL()),
+	}
+
+	_, err = store.Rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, uploadSessionKey(id), map[string]interface{}{
+			"user_id":    userID,
+			"filename":   filename,
+			"size":       size,
+			"offset":     0,
+			"chunks":     0,
+			"optimize":   optimizeJSON,
+			"image_id":   0,
+			"expires_at": session.ExpiresAt.Unix(),
+		})
+		pipe.ZAdd(ctx, uploadExpiryKey, &redis.Z{Score: float64(session.ExpiresAt.Unix()), Member: id})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetUploadSession 读取分片上传会话
+func GetUploadSession(ctx context.Context, id string) (*UploadSession, error) {
+	fields, err := store.Rdb.HGetAll(ctx, uploadSessionKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrUploadNotFound
+	}
+
+	userID, _ := strconv.ParseUint(fields["user_id"], 10, 64)
+	size, _ := strconv.ParseInt(fields["size"], 10, 64)
+	offset, _ := strconv.ParseInt(fields["offset"], 10, 64)
+	chunks, _ := strconv.Atoi(fields["chunks"])
+	imageID, _ := strconv.ParseUint(fields["image_id"], 10, 64)
+	expiresAt, _ := strconv.ParseInt(fields["expires_at"], 10, 64)
+
+	session := &UploadSession{
+		ID:        id,
+		UserID:    uint(userID),
+		Filename:  fields["filename"],
+		Size:      size,
+		Offset:    offset,
+		Chunks:    chunks,
+		ImageID:   uint(imageID),
+		ExpiresAt: time.Unix(expiresAt, 0),
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, ErrUploadNotFound
+	}
+	if data := fields["optimize"]; data != "" {
+		var optimize tasks.OptimizeOptions
+		if err := json.Unmarshal([]byte(data), &optimize); err != nil {
+			return nil, fmt.Errorf("会话的优化选项无效: %w", err)
+		}
+		session.Optimize = &optimize
+	}
+	return session, nil
+}
+
+// unlockScript 只有锁的值仍是自己的令牌时才删除，避免锁过期后删掉下一个持有者的锁
+var unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// extendLockScript 只有锁的值仍是自己的令牌时才续期
+var extendLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// lockUploadSession 获取会话锁，同一会话同时只能写入一个分片或进行合并
+// 锁的值为随机令牌，持有期间每 uploadLockTTL/3 续期一次，释放时比较令牌后再删除
+func lockUploadSession(ctx context.Context, id string) (func(), error) {
+	token, err := newUploadID()
+	if err != nil {
+		return nil, err
+	}
+	key := uploadLockKey(id)
+	ok, err := store.Rdb.SetNX(ctx, key, token, uploadLockTTL).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrUploadBusy
+	}
+
+	// 合并大文件或写入慢速存储时可能超过锁时长，持有期间持续续期
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(uploadLockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				extended, err := extendLockScript.Run(context.Background(), store.Rdb, []string{key},
+					token, uploadLockTTL.Milliseconds()).Int()
+				if err != nil {
+					log.Printf("续期上传会话 %s 的锁失败: %v", id, err)
+				} else if extended == 0 {
+					log.Printf("警告: 上传会话 %s 的锁已失效", id)
+					return
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			if err := unlockScript.Run(context.Background(), store.Rdb, []string{key}, token).Err(); err != nil {
+				log.Printf("释放上传会话 %s 的锁失败: %v", id, err)
+			}
+		})
+	}, nil
+}
+
+// AppendUploadChunk 在 offset 处追加一个分片，返回追加后的偏移量
+// 分片读取中断时丢弃不完整的数据，客户端查询偏移量后从上一个完整分片之后继续
+func AppendUploadChunk(ctx context.Context, id string, offset int64, r io.Reader) (*UploadSession, error) {
+	unlock, err := lockUploadSession(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// 加锁后重新读取，其他节点可能刚写入了分片
+	session, err := GetUploadSession(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if session.ImageID != 0 || offset != session.Offset {
+		return session, ErrUploadOffsetMismatch
+	}
+
+	limit := min(UploadChunkSize(), session.Size-session.Offset)
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return session, fmt.Errorf("读取分片失败: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return session, ErrChunkTooLarge
+	}
+	if len(data) == 0 {
+		return session, nil
+	}
+
+	key := uploadChunkKey(id, session.Chunks)
+	if err := storage.PutBytes(ctx, storage.Backend, key, data, "application/octet-stream"); err != nil {
+		return session, fmt.Errorf("保存分片失败: %w", err)
+	}
+
+	session.Offset += int64(len(data))
+	session.Chunks++
+	session.ExpiresAt = time.Now().Add(uploadSessionTTL())
+	_, err = store.Rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, uploadSessionKey(id), map[string]interface{}{
+			"offset":     session.Offset,
+			"chunks":     session.Chunks,
+			"expires_at": session.ExpiresAt.Unix(),
+		})
+		pipe.ZAdd(ctx, uploadExpiryKey, &redis.Z{Score: float64(session.ExpiresAt.Unix()), Member: id})
+		return nil
+	})
+	if err != nil {
+		storage.Backend.Delete(ctx, key)
+		return nil, err
+	}
+	return session, nil
+}
+
+// StageUploadSession 将全部分片按顺序合并到临时文件并计算内容哈希，之后与普通上传走相同的流程
+// 合并成功时会话锁保持到调用 release 为止，调用方应在 CompleteUploadSession 或 AbortUploadSession
+// 之后再释放，期间重复的完成请求返回 ErrUploadBusy，不会重复创建图片
+// 会话已完成时 staged 为 nil，release 总是非nil，可以直接 defer
+func StageUploadSession(ctx context.Context, id string) (session *UploadSession, staged *StagedUpload, release func(), err error) {
+	release = func() {}
+	unlock, err := lockUploadSession(ctx, id)
+	if err != nil {
+		return nil, nil, release, err
+	}
+	defer func() {
+		if staged == nil {
+			unlock()
+		}
+	}()
+
+	session, err = GetUploadSession(ctx, id)
+	if err != nil {
+		return nil, nil, release, err
+	}
+	if session.ImageID != 0 {
+		return session, nil, release, nil
+	}
+	if session.Offset != session.Size {
+		return session, nil, release, ErrUploadIncomplete
+	}
+
+	reader := &chunkReader{ctx: ctx, id: id, count: session.Chunks}
+	defer reader.Close()
+
+	staged, err = StageUpload(reader, session.Filename)
+	if err != nil {
+		return session, nil, release, err
+	}
+	if staged.Size != session.Size {
+		staged.Discard()
+		return session, nil, release, fmt.Errorf("合并后的大小 %d 与声明的大小 %d 不一致", staged.Size, session.Size)
+	}
+	return session, staged, unlock, nil
+}
+
+// CompleteUploadSession 记录会话对应的图片并删除分片，调用方需持有 StageUploadSession 的会话锁
+// 会话再保留一段时间，客户端重复提交完成请求时返回同一张图片
+func CompleteUploadSession(ctx context.Context, session *UploadSession, imageID uint) error {
+	session.ImageID = imageID
+	session.ExpiresAt = time.Now().Add(finalizedUploadTTL)
+	_, err := store.Rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, uploadSessionKey(session.ID), map[string]interface{}{
+			"image_id":   imageID,
+			"chunks":     0,
+			"expires_at": session.ExpiresAt.Unix(),
+		})
+		pipe.ZAdd(ctx, uploadExpiryKey, &redis.Z{Score: float64(session.ExpiresAt.Unix()), Member: session.ID})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	deleteUploadChunks(ctx, session.ID, session.Chunks)
+	return nil
+}
+
+// AbortUploadSession 合并后的文件无法使用时删除会话和分片，调用方需持有 StageUploadSession 的会话锁
+func AbortUploadSession(ctx context.Context, session *UploadSession) error {
+	return deleteUploadSession(ctx, session.ID)
+}
+
+// DeleteUploadSession 取消上传，删除会话和已上传的分片
+func DeleteUploadSession(ctx context.Context, session *UploadSession) error {
+	unlock, err := lockUploadSession(ctx, session.ID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return deleteUploadSession(ctx, session.ID)
+}
+
+// deleteUploadSession 删除会话和分片，调用方需持有会话锁
+func deleteUploadSession(ctx context.Context, id string) error {
+	chunks, err := store.Rdb.HGet(ctx, uploadSessionKey(id), "chunks").Int()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	deleteUploadChunks(ctx, id, chunks)
+
+	_, err = store.Rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, uploadSessionKey(id))
+		pipe.ZRem(ctx, uploadExpiryKey, id)
+		return nil
+	})
+	return err
+}
+
+// deleteUploadChunks 删除会话的分片，失败只记录日志
+func deleteUploadChunks(ctx context.Context, id string, count int) {
+	for i := 0; i < count; i++ {
+		if err := storage.Backend.Delete(ctx, uploadChunkKey(id, i)); err != nil {
+			log.Printf("删除上传分片 %s 失败: %v", uploadChunkKey(id, i), err)
+		}
+	}
+}
+
+// CleanupExpiredUploads 删除过期的上传会话及其分片，返回清理的会话数
+func CleanupExpiredUploads(ctx context.Context) (int, error) {
+	ids, err := store.Rdb.ZRangeByScore(ctx, uploadExpiryKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().Unix(), 10),
+	}).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	cleaned := 0
+	for _, id := range ids {
+		unlock, err := lockUploadSession(ctx, id)
+		if err != nil {
+			continue // 正在写入分片的会话下一轮再检查
+		}
+		// 加锁期间会话可能刚被续期
+		expiresAt, err := store.Rdb.HGet(ctx, uploadSessionKey(id), "expires_at").Int64()
+		if err == nil && time.Unix(expiresAt, 0).After(time.Now()) {
+			unlock()
+			continue
+		}
+		if err := deleteUploadSession(ctx, id); err != nil {
+			log.Printf("清理上传会话 %s 失败: %v", id, err)
+		} else {
+			cleaned++
+		}
+		unlock()
+	}
+	return cleaned, nil
+}
+
+// RunUploadCleanup 定期清理过期的上传会话，直到ctx被取消
+func RunUploadCleanup(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultUploadCleanupInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := CleanupExpiredUploads(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("错误: 清理过期上传会话失败: %v", err)
+			} else if n > 0 {
+				log.Printf("已清理 %d 个过期的上传会话", n)
+			}
+		}
+	}
+}
+
+// chunkReader 按顺序读取会话的全部分片
+type chunkReader struct {
+	ctx     context.Context
+	id      string
+	count   int
+	next    int
+	current io.ReadCloser
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if r.next >= r.count {
+				return 0, io.EOF
+			}
+			chunk, err := storage.Backend.Get(r.ctx, uploadChunkKey(r.id, r.next))
+			if err != nil {
+				return 0, fmt.Errorf("读取分片 %d 失败: %w", r.next, err)
+			}
+			r.current = chunk
+			r.next++
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
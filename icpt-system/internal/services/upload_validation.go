@@ -0,0 +1,198 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"icpt-system/internal/config"
+)
+
+// 上传校验的默认限制
+const (
+	defaultMaxUploadSize = 20 << 20 // 20MB
+	defaultMaxPixels     = 50       // 5000万像素
+	maxFilenameBytes     = 255
+	sniffLen             = 512
+)
+
+// uploadFormats 服务器能够解码处理的格式：嗅探到的MIME类型 → 格式名和存储扩展名
+var uploadFormats = map[string]struct{ name, ext string }{
+	"image/jpeg": {"jpeg", ".jpg"},
+	"image/png":  {"png", ".png"},
+	"image/gif":  {"gif", ".gif"},
+}
+
+// defaultAllowedFormats 未配置 upload.allowed_formats 时允许的格式
+var defaultAllowedFormats = []string{"jpeg", "png", "gif"}
+
+// UploadError 上传校验失败，Code 和 Status 直接用于API响应
+type UploadError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *UploadError) Error() string {
+	return e.Message
+}
+
+// ImageInfo 校验通过的图片信息
+type ImageInfo struct {
+	Format   string
+	MimeType string
+	Width    int
+	Height   int
+}
+
+// MaxUploadSize 返回配置的单个文件最大字节数
+func MaxUploadSize() int64 {
+	if mb := config.Cfg.Upload.MaxFileSize; mb > 0 {
+		return int64(mb) << 20
+	}
+	return defaultMaxUploadSize
+}
+
+// maxUploadPixels 返回配置的最大像素数（宽×高）
+func maxUploadPixels() int64 {
+	if mp := config.Cfg.Upload.MaxPixels; mp > 0 {
+		return int64(mp) * 1000000
+	}
+	return defaultMaxPixels * 1000000
+}
+
+// allowedFormat 判断格式是否在允许列表中
+func allowedFormat(name string) bool {
+	allowed := config.Cfg.Upload.AllowedFormats
+	if len(allowed) == 0 {
+		allowed = defaultAllowedFormats
+	}
+	for _, format := range allowed {
+		if strings.EqualFold(format, name) || (name == "jpeg" && strings.EqualFold(format, "jpg")) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckUploadSize 检查文件大小是否在允许范围内
+func CheckUploadSize(size int64) error {
+	if size <= 0 {
+		return &UploadError{Status: http.StatusBadRequest, Code: "EMPTY_FILE", Message: "文件为空"}
+	}
+	if max := MaxUploadSize(); size > max {
+		return &UploadError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Code:    "FILE_TOO_LARGE",
+			Message: fmt.Sprintf("文件过大，最大允许 %d MB", max>>20),
+		}
+	}
+	return nil
+}
+
+// ValidateImage 根据文件内容（而不是文件名或客户端声明的类型）校验图片
+// 先按文件头嗅探格式并检查允许列表，再只解码图片头获取尺寸，
+// 在完整解码前拒绝像素数过大的图片，防止解压炸弹耗尽Worker内存
+func ValidateImage(r io.ReadSeeker) (*ImageInfo, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	mimeType := http.DetectContentType(head[:n])
+	format, ok := uploadFormats[mimeType]
+	if !ok || !allowedFormat(format.name) {
+		return nil, &UploadError{
+			Status:  http.StatusUnsupportedMediaType,
+			Code:    "UNSUPPORTED_FORMAT",
+			Message: fmt.Sprintf("不支持的文件类型: %s", mimeType),
+		}
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	cfg, decoded, err := image.DecodeConfig(r)
+	if err != nil || decoded != format.name || cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, &UploadError{
+			Status:  http.StatusUnprocessableEntity,
+			Code:    "INVALID_IMAGE",
+			Message: "图片文件已损坏或格式与内容不符",
+		}
+	}
+
+	if max := maxUploadPixels(); int64(cfg.Width)*int64(cfg.Height) > max {
+		return nil, &UploadError{
+			Status:  http.StatusUnprocessableEntity,
+			Code:    "IMAGE_TOO_LARGE",
+			Message: fmt.Sprintf("图片尺寸过大 (%dx%d)，最多允许 %d 万像素", cfg.Width, cfg.Height, max/10000),
+		}
+	}
+
+	return &ImageInfo{
+		Format:   format.name,
+		MimeType: mimeType,
+		Width:    cfg.Width,
+		Height:   cfg.Height,
+	}, nil
+}
+
+// ValidateStagedUpload 校验暂存的上传文件，通过后按实际格式设置存储扩展名
+func ValidateStagedUpload(staged *StagedUpload) (*ImageInfo, error) {
+	if err := CheckUploadSize(staged.Size); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(staged.TmpPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := ValidateImage(file)
+	if err != nil {
+		return nil, err
+	}
+	// 存储键的扩展名决定了文件对外提供时的Content-Type，必须与实际内容一致
+	staged.Ext = uploadFormats[info.MimeType].ext
+	return info, nil
+}
+
+// SanitizeFilename 清理客户端提供的文件名，只保留最后一段路径，
+// 去掉控制字符和首尾的空格、点，并限制长度；清理后为空时返回 "image"
+// 文件名只用于显示，不能直接用来拼接存储路径
+func SanitizeFilename(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+
+	if len(name) > maxFilenameBytes {
+		ext := filepath.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		base := name[:maxFilenameBytes-len(ext)]
+		for !utf8.ValidString(base) {
+			base = base[:len(base)-1]
+		}
+		name = base + ext
+	}
+
+	if name == "" {
+		return "image"
+	}
+	return name
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Local 本地文件系统存储，存储键是相对于根目录的路径
+type Local struct {
+	root   string
+	signer *URLSigner
+}
+
+// NewLocal 创建本地文件系统存储
+// baseURL 是根目录对外的访问地址，signingKey 用于签名URL
+func NewLocal(root, baseURL string, signingKey []byte) *Local {
+	return &Local{
+		root:   root,
+		signer: NewURLSigner(baseURL, signingKey),
+	}
+}
+
+// Path 返回存储键对应的本地文件路径
+// 存储键经过清理，不能通过 ../ 访问根目录以外的文件
+func (l *Local) Path(key string) string {
+	clean := path.Clean("/" + key)
+	return filepath.Join(l.root, filepath.FromSlash(clean))
+}
+
+// Put 写入对象，先写临时文件再重命名，读取方不会读到写了一半的文件
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	target := l.Path(key)
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// Get 读取对象
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	file, err := os.Open(l.Path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+// Delete 删除对象
+func (l *Local) Delete(ctx context.Context, key string) error {
+	target := l.Path(key)
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// 删除变空的上级目录（如分片上传的 chunks/{id}），目录非空时 Remove 失败即停止
+	root := filepath.Clean(l.root)
+	for dir := filepath.Dir(target); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// Stat 获取对象信息
+func (l *Local) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	info, err := os.Stat(l.Path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &ObjectInfo{
+		Key:         key,
+		Size:        info.Size(),
+		ModTime:     info.ModTime(),
+		ContentType: mime.TypeByExtension(extension(key)),
+	}, nil
+}
+
+// SignedURL 返回带HMAC签名和过期时间的访问URL
+func (l *Local) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return l.signer.SignedURL(key, expiry), nil
+}
+
+// VerifySignature 校验签名URL中的过期时间和签名
+func (l *Local) VerifySignature(key, expires, signature string) bool {
+	return l.signer.VerifySignature(key, expires, signature)
+}
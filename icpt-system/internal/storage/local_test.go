@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStorage(t *testing.T) {
+	testStorage(t, NewLocal(t.TempDir(), "http://example.com/static", []byte("secret")))
+}
+
+// TestLocalPathTraversal 存储键中的 ../ 不能访问根目录以外的文件
+func TestLocalPathTraversal(t *testing.T) {
+	root := t.TempDir()
+	l := NewLocal(root, "http://example.com/static", []byte("secret"))
+
+	for _, key := range []string{"../etc/passwd", "a/../../etc/passwd", "/etc/passwd"} {
+		path := l.Path(key)
+		if !strings.HasPrefix(path, root+string(filepath.Separator)) {
+			t.Errorf("Path(%q) = %s, 不在根目录 %s 下", key, path, root)
+		}
+	}
+}
+
+// TestLocalDeleteRemovesEmptyDirs 删除对象后清理变空的上级目录，但保留根目录
+func TestLocalDeleteRemovesEmptyDirs(t *testing.T) {
+	root := t.TempDir()
+	l := NewLocal(root, "http://example.com/static", []byte("secret"))
+	ctx := context.Background()
+
+	if err := PutBytes(ctx, l, "chunks/abc/0", []byte("chunk"), ""); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := l.Delete(ctx, "chunks/abc/0"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "chunks")); !os.IsNotExist(err) {
+		t.Fatalf("空目录 chunks 没有删除: err = %v", err)
+	}
+	if _, err := os.Stat(root); err != nil {
+		t.Fatalf("根目录被删除: %v", err)
+	}
+}
+
+// parseSignedURL 拆出签名URL中的存储键、过期时间和签名
+func parseSignedURL(t *testing.T, raw, baseURL string) (key, expires, signature string) {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("解析签名URL %s: %v", raw, err)
+	}
+	base, _ := url.Parse(baseURL)
+	if u.Host != base.Host || !strings.HasPrefix(u.Path, base.Path+"/") {
+		t.Fatalf("签名URL %s 不在 %s 下", raw, baseURL)
+	}
+	return strings.TrimPrefix(u.Path, base.Path+"/"), u.Query().Get("expires"), u.Query().Get("signature")
+}
+
+func TestLocalSignedURL(t *testing.T) {
+	const baseURL = "http://example.com/static"
+	l := NewLocal(t.TempDir(), baseURL+"/", []byte("secret"))
+	ctx := context.Background()
+
+	raw, err := l.SignedURL(ctx, "thumbnails/ab/a b.jpg", time.Minute)
+	if err != nil {
+		t.Fatalf("SignedURL: %v", err)
+	}
+	key, expires, signature := parseSignedURL(t, raw, baseURL)
+	if key != "thumbnails/ab/a b.jpg" {
+		t.Fatalf("签名URL中的存储键 = %q", key)
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		if !l.VerifySignature(key, expires, signature) {
+			t.Fatal("有效的签名校验失败")
+		}
+	})
+
+	t.Run("OtherKey", func(t *testing.T) {
+		if l.VerifySignature("thumbnails/ab/other.jpg", expires, signature) {
+			t.Fatal("签名可以用于其他文件")
+		}
+	})
+
+	t.Run("TamperedExpiry", func(t *testing.T) {
+		if l.VerifySignature(key, expires+"0", signature) {
+			t.Fatal("修改过期时间后签名仍然有效")
+		}
+		if l.VerifySignature(key, "abc", signature) {
+			t.Fatal("过期时间不是数字时签名仍然有效")
+		}
+	})
+
+	t.Run("TamperedSignature", func(t *testing.T) {
+		if l.VerifySignature(key, expires, strings.Repeat("0", len(signature))) {
+			t.Fatal("错误的签名校验通过")
+		}
+		if l.VerifySignature(key, expires, "") {
+			t.Fatal("空签名校验通过")
+		}
+	})
+
+	t.Run("OtherSigningKey", func(t *testing.T) {
+		other := NewLocal(t.TempDir(), baseURL, []byte("another secret"))
+		if other.VerifySignature(key, expires, signature) {
+			t.Fatal("其他密钥签发的URL校验通过")
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		raw, err := l.SignedURL(ctx, key, -time.Second)
+		if err != nil {
+			t.Fatalf("SignedURL: %v", err)
+		}
+		key, expires, signature := parseSignedURL(t, raw, baseURL)
+		if l.VerifySignature(key, expires, signature) {
+			t.Fatal("过期的签名URL校验通过")
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeObject 假S3服务中保存的对象
+type fakeObject struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+// fakeS3 进程内的S3兼容服务，只实现存储后端用到的接口（路径风格，不校验签名）
+type fakeS3 struct {
+	bucket  string
+	mu      sync.Mutex
+	objects map[string]fakeObject
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		f.writeError(w, r, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	if key == "" {
+		if _, ok := r.URL.Query()["location"]; ok {
+			w.Header().Set("Content-Type", "application/xml")
+			io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`)
+			return
+		}
+		// HEAD 存储桶：BucketExists
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := readS3Payload(r)
+		if err != nil {
+			f.writeError(w, r, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		f.objects[key] = fakeObject{data: data, contentType: r.Header.Get("Content-Type"), modTime: time.Now().UTC()}
+		w.Header().Set("ETag", etag(data))
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		obj, ok := f.objects[key]
+		if !ok {
+			f.writeError(w, r, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Header().Set("Last-Modified", obj.modTime.Format(http.TimeFormat))
+		w.Header().Set("ETag", etag(obj.data))
+		w.Header().Set("Accept-Ranges", "bytes")
+		http.ServeContent(w, r, "", obj.modTime, bytes.NewReader(obj.data))
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.writeError(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// writeError 返回S3格式的错误，HEAD请求没有响应体
+func (f *fakeS3) writeError(w http.ResponseWriter, r *http.Request, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code><Message>%s</Message><BucketName>%s</BucketName><Resource>%s</Resource></Error>`,
+			code, code, f.bucket, r.URL.Path)
+	}
+}
+
+// etag 计算对象的ETag
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// readS3Payload 读取上传的数据，客户端使用流式签名时按 aws-chunked 格式解码
+func readS3Payload(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+
+	var data []byte
+	br := bufio.NewReader(r.Body)
+	for {
+		// 每个分块的格式：{十六进制长度};chunk-signature=...\r\n{数据}\r\n，长度为0的分块表示结束
+		header, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(header), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return data, nil
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk...)
+		if _, err := br.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// newFakeS3Storage 启动假S3服务并返回连接到它的存储后端
+func newFakeS3Storage(t *testing.T) *S3 {
+	t.Helper()
+	fake := &fakeS3{bucket: "icpt", objects: make(map[string]fakeObject)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	u, _ := url.Parse(server.URL)
+	s, err := NewS3(S3Options{
+		Endpoint:  u.Host,
+		Region:    "us-east-1",
+		Bucket:    fake.bucket,
+		AccessKey: "minio",
+		SecretKey: "minio123",
+		PathStyle: true,
+	})
+	if err != nil {
+		t.Fatalf("NewS3: %v", err)
+	}
+	return s
+}
+
+func TestS3Storage(t *testing.T) {
+	testStorage(t, newFakeS3Storage(t))
+}
+
+// TestS3MissingBucket 存储桶不存在时 NewS3 返回错误
+func TestS3MissingBucket(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{bucket: "icpt", objects: make(map[string]fakeObject)})
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	if _, err := NewS3(S3Options{Endpoint: u.Host, Region: "us-east-1", Bucket: "other", PathStyle: true}); err == nil {
+		t.Fatal("存储桶不存在时 NewS3 没有返回错误")
+	}
+}
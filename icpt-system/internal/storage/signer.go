@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// URLSigner 签发和校验指向API服务器 /static 的访问URL
+// 本地存储的全部文件以及任何存储下的原图都通过这种URL访问：
+// 原图必须经过API服务器才能按隐私配置去除EXIF、GPS等元数据，不能直接使用S3预签名地址
+type URLSigner struct {
+	baseURL string
+	key     []byte
+}
+
+// NewURLSigner 创建URL签名器，baseURL 为 /static 对外的访问地址，key 为HMAC密钥
+func NewURLSigner(baseURL string, key []byte) *URLSigner {
+	return &URLSigner{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		key:     key,
+	}
+}
+
+// SignedURL 返回带HMAC签名和过期时间的访问URL
+func (s *URLSigner) SignedURL(key string, expiry time.Duration) string {
+	expires := time.Now().Add(expiry).Unix()
+	return fmt.Sprintf("%s/%s?expires=%d&signature=%s",
+		s.baseURL, (&url.URL{Path: key}).EscapedPath(), expires, s.sign(key, expires))
+}
+
+// VerifySignature 校验签名URL中的过期时间和签名
+func (s *URLSigner) VerifySignature(key, expires, signature string) bool {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(s.sign(key, exp)))
+}
+
+// sign 计算存储键和过期时间的签名
+func (s *URLSigner) sign(key string, expires int64) string {
+	mac := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(mac, "%s|%d", key, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
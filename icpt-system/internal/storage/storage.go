@@ -0,0 +1,187 @@
+// Package storage 定义文件存储后端
+// 数据库中保存的是存储键（如 originals/ab/{hash}.jpg），而不是本地路径，
+// 这样API服务器和Worker可以运行在多个节点上，共享同一个S3兼容存储
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"icpt-system/internal/config"
+)
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("storage: object not found")
+
+// ObjectInfo 对象信息
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+}
+
+// Storage 文件存储后端
+type Storage interface {
+	// Put 写入对象，已存在时覆盖
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+
+	// Get 读取对象，不存在时返回 ErrNotFound
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Delete 删除对象，不存在时不报错
+	Delete(ctx context.Context, key string) error
+
+	// Stat 获取对象信息，不存在时返回 ErrNotFound
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+
+	// SignedURL 返回在 expiry 时间内有效的访问URL
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// Backend 全局存储后端，由 InitStorage 按配置创建
+var Backend Storage
+
+// Signer 签发 /static 访问URL，与存储后端无关；原图总是使用它，以便经过API服务器去除元数据
+var Signer *URLSigner
+
+// InitStorage 按配置初始化存储后端
+func InitStorage() {
+	c := config.Cfg.Storage
+
+	baseURL := c.Local.BaseURL
+	if baseURL == "" || (c.Driver != "" && c.Driver != "local") {
+		baseURL = strings.TrimSuffix(config.Cfg.Server.PublicHost, "/") + "/static"
+	}
+	Signer = NewURLSigner(baseURL, signingKey())
+
+	switch c.Driver {
+	case "", "local":
+		root := c.Local.Root
+		if root == "" {
+			root = "uploads"
+		}
+		Backend = NewLocal(root, baseURL, signingKey())
+		log.Printf("文件存储: 本地目录 %s", root)
+	case "s3":
+		s3, err := NewS3(S3Options{
+			Endpoint:  c.S3.Endpoint,
+			Region:    c.S3.Region,
+			Bucket:    c.S3.Bucket,
+			AccessKey: c.S3.AccessKey,
+			SecretKey: c.S3.SecretKey,
+			UseSSL:    c.S3.UseSSL,
+			PathStyle: c.S3.PathStyle,
+		})
+		if err != nil {
+			log.Fatalf("错误: 无法初始化S3存储: %v", err)
+		}
+		Backend = s3
+		log.Printf("文件存储: S3 %s/%s", c.S3.Endpoint, c.S3.Bucket)
+	default:
+		log.Fatalf("错误: 未知的存储后端: %s", c.Driver)
+	}
+}
+
+// signingKey 返回签名URL使用的HMAC密钥
+func signingKey() []byte {
+	if key := config.Cfg.Storage.SigningKey; key != "" {
+		return []byte(key)
+	}
+	return []byte(config.Cfg.JWT.SecretKey)
+}
+
+// URLExpiry 返回配置的签名URL有效期
+func URLExpiry() time.Duration {
+	if seconds := config.Cfg.Storage.SignedURLExpiry; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return time.Hour
+}
+
+// ReadAll 读取整个对象
+func ReadAll(ctx context.Context, s Storage, key string) ([]byte, error) {
+	r, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// PutBytes 将内存中的数据写入存储
+func PutBytes(ctx context.Context, s Storage, key string, data []byte, contentType string) error {
+	return s.Put(ctx, key, bytes.NewReader(data), int64(len(data)), contentType)
+}
+
+// PutFile 将本地文件写入存储
+func PutFile(ctx context.Context, s Storage, key, path, contentType string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, key, file, info.Size(), contentType)
+}
+
+// localPather 可以直接提供本地文件路径的存储（本地文件系统）
+type localPather interface {
+	Path(key string) string
+}
+
+// LocalFile 返回对象在本地文件系统中的路径，供需要文件路径的处理器（如OpenCV）使用
+// 本地存储直接返回文件路径；其他存储下载到临时文件，用完后调用 cleanup 删除
+func LocalFile(ctx context.Context, s Storage, key string) (path string, cleanup func(), err error) {
+	if lp, ok := s.(localPather); ok {
+		path := lp.Path(key)
+		if _, err := os.Stat(path); err != nil {
+			if os.IsNotExist(err) {
+				return "", nil, ErrNotFound
+			}
+			return "", nil, err
+		}
+		return path, func() {}, nil
+	}
+
+	r, err := s.Get(ctx, key)
+	if err != nil {
+		return "", nil, err
+	}
+	defer r.Close()
+
+	tmp, err := os.CreateTemp("", "icpt-*"+extension(key))
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", nil, fmt.Errorf("下载 %s 失败: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", nil, err
+	}
+	return tmp.Name(), func() { os.Remove(tmp.Name()) }, nil
+}
+
+// extension 返回存储键的扩展名（含点）
+func extension(key string) string {
+	slash := strings.LastIndex(key, "/")
+	if dot := strings.LastIndex(key, "."); dot > slash {
+		return key[dot:]
+	}
+	return ""
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// testStorage 对任意存储后端运行相同的用例，保证本地存储和S3存储的行为一致
+func testStorage(t *testing.T, s Storage) {
+	ctx := context.Background()
+	const key = "originals/ab/test.jpg"
+	data := []byte("\xff\xd8\xff\xe0 fake jpeg data")
+
+	t.Run("GetMissing", func(t *testing.T) {
+		if _, err := s.Get(ctx, "originals/ab/missing.jpg"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get 不存在的对象: err = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("StatMissing", func(t *testing.T) {
+		if _, err := s.Stat(ctx, "originals/ab/missing.jpg"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Stat 不存在的对象: err = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("DeleteMissing", func(t *testing.T) {
+		if err := s.Delete(ctx, "originals/ab/missing.jpg"); err != nil {
+			t.Fatalf("Delete 不存在的对象: err = %v, want nil", err)
+		}
+	})
+
+	t.Run("PutGetStat", func(t *testing.T) {
+		if err := s.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "image/jpeg"); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+
+		got, err := ReadAll(ctx, s, key)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("Get = %q, want %q", got, data)
+		}
+
+		info, err := s.Stat(ctx, key)
+		if err != nil {
+			t.Fatalf("Stat: %v", err)
+		}
+		if info.Key != key || info.Size != int64(len(data)) || info.ContentType != "image/jpeg" {
+			t.Fatalf("Stat = %+v, want key %s size %d type image/jpeg", info, key, len(data))
+		}
+		if info.ModTime.IsZero() {
+			t.Fatal("Stat 没有返回修改时间")
+		}
+	})
+
+	t.Run("PutOverwrite", func(t *testing.T) {
+		replaced := []byte("\xff\xd8\xff\xe0 replaced")
+		if err := PutBytes(ctx, s, key, replaced, "image/jpeg"); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		got, err := ReadAll(ctx, s, key)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if !bytes.Equal(got, replaced) {
+			t.Fatalf("覆盖后 Get = %q, want %q", got, replaced)
+		}
+	})
+
+	t.Run("LocalFile", func(t *testing.T) {
+		path, cleanup, err := LocalFile(ctx, s, key)
+		if err != nil {
+			t.Fatalf("LocalFile: %v", err)
+		}
+		defer cleanup()
+		if path == "" {
+			t.Fatal("LocalFile 返回空路径")
+		}
+		if _, _, err := LocalFile(ctx, s, "originals/ab/missing.jpg"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("LocalFile 不存在的对象: err = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if err := s.Delete(ctx, key); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("删除后 Get: err = %v, want ErrNotFound", err)
+		}
+		if _, err := s.Stat(ctx, key); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("删除后 Stat: err = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("SignedURL", func(t *testing.T) {
+		url, err := s.SignedURL(ctx, key, time.Minute)
+		if err != nil {
+			t.Fatalf("SignedURL: %v", err)
+		}
+		if url == "" {
+			t.Fatal("SignedURL 返回空地址")
+		}
+	})
+
+}
@@ -35,11 +35,93 @@ func InitDB() {
 
 	log.Println("数据库连接成功！")
 
+	// 配额用量字段是新增的，添加后需要根据已有图片统计一次
+	hasUsage := DB.Migrator().HasColumn(&models.User{}, "storage_used")
+
 	// 自动迁移，确保数据库表结构与我们的模型定义一致
-	// 这行代码会自动创建或更新 'images' 和 'users' 表
-	err = DB.AutoMigrate(&models.Image{}, &models.User{})
+	// 这行代码会自动创建或更新 'images'、'users' 和 'image_renditions' 表
+	err = DB.AutoMigrate(&models.Image{}, &models.User{}, &models.ImageRendition{}, &models.ImageMetadata{}, &models.Blob{}, &models.RefreshToken{}, &models.PasswordResetToken{}, &models.APIKey{}, &models.LoginAttempt{}, &models.RecoveryCode{})
 	if err != nil {
 		log.Fatalf("错误: 数据库迁移失败: %v", err)
 	}
 	log.Println("数据库迁移成功！")
+
+	migrateStorageKeys()
+	promoteConfiguredAdmins()
+
+	if !hasUsage {
+		if err := RecalculateUsage(DB); err != nil {
+			log.Fatalf("错误: 统计用户存储用量失败: %v", err)
+		}
+		log.Println("已根据现有图片统计用户存储用量")
+	}
+}
+
+// promoteConfiguredAdmins 将配置文件中列出的用户名设为管理员，用于创建第一个管理员账户
+// 之后的角色调整通过管理接口完成
+func promoteConfiguredAdmins() {
+	usernames := config.Cfg.Admin.Usernames
+	if len(usernames) == 0 {
+		return
+	}
+	result := DB.Model(&models.User{}).
+		Where("username IN ? AND role <> ?", usernames, models.RoleAdmin).
+		Update("role", models.RoleAdmin)
+	if result.Error != nil {
+		log.Printf("设置管理员失败: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("已将 %d 个配置中的用户设为管理员", result.RowsAffected)
+	}
+}
+
+// legacyPathPrefix 引入存储后端之前，数据库中保存的是带 uploads/ 前缀的本地路径
+const legacyPathPrefix = "uploads/"
+
+// migrateStorageKeys 将历史记录中的本地路径转换为存储键（去掉 uploads/ 前缀）
+// 已转换的记录不再匹配前缀，重复执行不会产生影响
+func migrateStorageKeys() {
+	columns := []struct {
+		model  interface{}
+		column string
+	}{
+		{&models.Image{}, "storage_path"},
+		{&models.Image{}, "thumbnail_path"},
+		{&models.Image{}, "raw_original_path"},
+		{&models.ImageRendition{}, "storage_path"},
+		{&models.Blob{}, "storage_path"},
+	}
+
+	for _, c := range columns {
+		result := DB.Model(c.model).
+			Where(c.column+" LIKE ?", legacyPathPrefix+"%").
+			Update(c.column, gorm.Expr("SUBSTRING("+c.column+", ?)", len(legacyPathPrefix)+1))
+		if result.Error != nil {
+			log.Fatalf("错误: 转换存储路径 %s 失败: %v", c.column, result.Error)
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("已将 %d 条记录的 %s 转换为存储键", result.RowsAffected, c.column)
+		}
+	}
+}
+
+// RecalculateUsage 根据图片和衍生图记录重新统计用户的存储用量和图片数量，不指定用户时统计全部用户
+// 用量计数在上传、删除等操作时增量更新，这里用于初始化和修正偏差
+func RecalculateUsage(db *gorm.DB, userIDs ...uint) error {
+	query := db.Model(&models.User{})
+	if len(userIDs) > 0 {
+		query = query.Where("id IN ?", userIDs)
+	} else {
+		query = query.Where("1 = 1")
+	}
+
+	// 原图按当前大小计算，优化时保留的未压缩原图另外计算
+	return query.Updates(map[string]interface{}{
+		"image_count": gorm.Expr("(SELECT COUNT(*) FROM images WHERE images.user_id = users.id)"),
+		"storage_used": gorm.Expr(`COALESCE((SELECT SUM(images.file_size + CASE WHEN images.raw_original_path <> '' THEN images.original_size ELSE 0 END)
+			FROM images WHERE images.user_id = users.id), 0) +
+			COALESCE((SELECT SUM(image_renditions.file_size) FROM image_renditions
+			JOIN images ON images.id = image_renditions.image_id WHERE images.user_id = users.id), 0)`),
+	}).Error
 }
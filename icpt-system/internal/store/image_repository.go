@@ -0,0 +1,99 @@
+package store
+
+import (
+	"errors"
+
+	"icpt-system/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ImageRepository 图片查询，按所有者限定范围
+// API处理器只通过这里读写图片记录：不属于该用户的图片与不存在的图片一样返回 gorm.ErrRecordNotFound，
+// 避免通过遍历ID探测其他用户的图片
+type ImageRepository struct {
+	db *gorm.DB
+}
+
+// Images 返回使用全局数据库连接的图片查询
+func Images() *ImageRepository {
+	return &ImageRepository{db: DB}
+}
+
+// owned 限定为 ownerID 的图片
+func (r *ImageRepository) owned(ownerID uint) *gorm.DB {
+	return r.db.Where("images.user_id = ?", ownerID)
+}
+
+// FindOwned 查询用户拥有的单张图片，id 来自请求路径，非法或不属于该用户时返回 gorm.ErrRecordNotFound
+func (r *ImageRepository) FindOwned(ownerID uint, id string) (*models.Image, error) {
+	var image models.Image
+	if err := r.owned(ownerID).Where("images.id = ?", id).First(&image).Error; err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
+
+// FindOwnedByIDs 查询用户拥有的多张图片，不属于该用户的ID被忽略
+func (r *ImageRepository) FindOwnedByIDs(ownerID uint, ids []uint) ([]models.Image, error) {
+	var images []models.Image
+	err := r.owned(ownerID).Where("images.id IN ?", ids).Find(&images).Error
+	return images, err
+}
+
+// FindOwnedByHash 查询用户已上传的相同内容的图片，用于秒传
+func (r *ImageRepository) FindOwnedByHash(ownerID uint, contentHash string) (*models.Image, error) {
+	var image models.Image
+	if err := r.owned(ownerID).Where("content_hash = ?", contentHash).First(&image).Error; err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
+
+// ListOwned 按创建时间倒序分页列出用户的图片，status 为空时不过滤
+func (r *ImageRepository) ListOwned(ownerID uint, status string, offset, limit int) ([]models.Image, int64, error) {
+	query := r.owned(ownerID).Model(&models.Image{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var images []models.Image
+	err := query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&images).Error
+	return images, total, err
+}
+
+// DeleteOwned 删除用户拥有的图片记录，返回实际删除的数量
+func (r *ImageRepository) DeleteOwned(ownerID uint, ids []uint) (int64, error) {
+	result := r.owned(ownerID).Where("images.id IN ?", ids).Delete(&models.Image{})
+	return result.RowsAffected, result.Error
+}
+
+// FindByStorageKey 查找引用了存储键的图片（原图、缩略图或衍生图）
+// ownerID 不为0时只查找该用户的图片；内容相同的原图可能被多个用户的图片共享
+func (r *ImageRepository) FindByStorageKey(key string, ownerID uint) (*models.Image, error) {
+	scoped := func() *gorm.DB {
+		if ownerID != 0 {
+			return r.owned(ownerID)
+		}
+		return r.db
+	}
+
+	var image models.Image
+	err := scoped().
+		Where("storage_path = ? OR thumbnail_path = ? OR raw_original_path = ?", key, key, key).
+		First(&image).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return &image, err
+	}
+
+	err = scoped().
+		Joins("JOIN image_renditions ON image_renditions.image_id = images.id").
+		Where("image_renditions.storage_path = ?", key).
+		First(&image).Error
+	return &image, err
+}
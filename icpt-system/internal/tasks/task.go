@@ -0,0 +1,120 @@
+// Package tasks 定义处理队列中传递的任务信封及其编解码
+// 信封带有版本号，Worker只处理自己认识的版本，便于平滑地增加新的任务类型和字段
+package tasks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CurrentVersion 当前任务信封版本
+const CurrentVersion = 1
+
+// ErrUnsupportedVersion 任务信封版本不受支持
+var ErrUnsupportedVersion = errors.New("unsupported task version")
+
+// Type 任务类型
+type Type string
+
+const (
+	TypeProcessImage Type = "process_image" // 新上传图像的处理
+	TypeReprocess    Type = "reprocess"     // 重新处理已有图像
+	TypeExport       Type = "export"        // 导出图像
+	TypeDeleteFiles  Type = "delete_files"  // 删除图像文件
+)
+
+// 可请求的处理操作
+const (
+	OpThumbnail  = "thumbnail"  // 生成缩略图
+	OpRenditions = "renditions" // 生成配置的全部衍生图
+	OpOptimize   = "optimize"   // 缩小并重新编码原图，选项见 Task.Optimize
+)
+
+// OptimizeOptions 原图优化选项
+type OptimizeOptions struct {
+	Preset       string `json:"preset"`        // 压缩预设名称，见 imageprocessor.PresetConfig
+	KeepOriginal bool   `json:"keep_original"` // 是否保留未压缩的原图
+}
+
+// Task 队列中的任务信封
+type Task struct {
+	Version    int              `json:"v"`
+	Type       Type             `json:"type"`
+	ImageID    uint             `json:"image_id"`
+	UserID     uint             `json:"user_id"`
+	Operations []string         `json:"operations,omitempty"`
+	Optimize   *OptimizeOptions `json:"optimize,omitempty"`
+	Attempt    int              `json:"attempt"` // 已经失败的次数，首次投递为0
+	EnqueuedAt time.Time        `json:"enqueued_at"`
+	TraceID    string           `json:"trace_id"`
+}
+
+// New 创建当前版本的任务，并生成追踪ID
+func New(taskType Type, imageID, userID uint, operations ...string) *Task {
+	return &Task{
+		Version:    CurrentVersion,
+		Type:       taskType,
+		ImageID:    imageID,
+		UserID:     userID,
+		Operations: operations,
+		EnqueuedAt: time.Now(),
+		TraceID:    newTraceID(),
+	}
+}
+
+// HasOperation 判断任务是否请求了某个处理操作
+func (t *Task) HasOperation(op string) bool {
+	for _, o := range t.Operations {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// Encode 将任务编码为队列中的字符串
+func Encode(task *Task) (string, error) {
+	if task.Version == 0 {
+		task.Version = CurrentVersion
+	}
+	data, err := json.Marshal(task)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Decode 从队列中的字符串解析任务，版本不受支持时返回 ErrUnsupportedVersion
+func Decode(payload string) (*Task, error) {
+	var probe struct {
+		Version int `json:"v"`
+	}
+	if err := json.Unmarshal([]byte(payload), &probe); err != nil {
+		return nil, fmt.Errorf("无法解析任务: %w", err)
+	}
+	if probe.Version != CurrentVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, probe.Version)
+	}
+
+	var task Task
+	if err := json.Unmarshal([]byte(payload), &task); err != nil {
+		return nil, fmt.Errorf("无法解析任务: %w", err)
+	}
+	if task.Type == "" {
+		return nil, fmt.Errorf("任务缺少类型")
+	}
+	return &task, nil
+}
+
+// newTraceID 生成随机追踪ID，用于串联上传请求、队列和Worker日志
+func newTraceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
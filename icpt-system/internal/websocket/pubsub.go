@@ -0,0 +1,130 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// NotificationChannel 跨进程通知使用的Redis发布/订阅频道
+// Worker等没有WebSocket连接的进程向该频道发布事件，所有API服务器实例订阅后推送给本机上的用户连接
+const NotificationChannel = "icpt:ws_notifications"
+
+// Event 在Redis频道中传递的通知事件
+type Event struct {
+	UserID uint             `json:"user_id"`
+	Type   NotificationType `json:"type"`
+	Data   json.RawMessage  `json:"data"`
+}
+
+// Publisher 通过Redis发布通知，不直接持有任何WebSocket连接
+type Publisher struct {
+	rdb     *redis.Client
+	channel string
+}
+
+// NewPublisher 创建通知发布器
+func NewPublisher(rdb *redis.Client) *Publisher {
+	return &Publisher{
+		rdb:     rdb,
+		channel: NotificationChannel,
+	}
+}
+
+// NotifyUser 发布发给特定用户的通知，由持有该用户连接的服务器实例负责推送
+func (p *Publisher) NotifyUser(userID uint, notificationType NotificationType, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("序列化通知数据失败: %v", err)
+		return
+	}
+
+	event, err := json.Marshal(Event{
+		UserID: userID,
+		Type:   notificationType,
+		Data:   payload,
+	})
+	if err != nil {
+		log.Printf("序列化通知事件失败: %v", err)
+		return
+	}
+
+	if err := p.rdb.Publish(context.Background(), p.channel, event).Err(); err != nil {
+		log.Printf("发布通知到Redis失败: %v", err)
+		return
+	}
+
+	log.Printf("发布通知到用户 %d: %s", userID, notificationType)
+}
+
+// NotifyImageProcessing 发布图像处理开始事件
+func (p *Publisher) NotifyImageProcessing(userID uint, imageID uint, fileName string) {
+	p.NotifyUser(userID, ImageProcessing, ImageNotification{
+		ImageID:  imageID,
+		Status:   "processing",
+		FileName: fileName,
+	})
+}
+
+// NotifyImageCompleted 发布图像处理完成事件
+func (p *Publisher) NotifyImageCompleted(userID uint, imageID uint, fileName, thumbnailURL string) {
+	p.NotifyUser(userID, ImageCompleted, ImageNotification{
+		ImageID:      imageID,
+		Status:       "completed",
+		FileName:     fileName,
+		ThumbnailURL: thumbnailURL,
+	})
+}
+
+// NotifyImageFailed 发布图像处理失败事件
+func (p *Publisher) NotifyImageFailed(userID uint, imageID uint, fileName, errorInfo string) {
+	p.NotifyUser(userID, ImageFailed, ImageNotification{
+		ImageID:   imageID,
+		Status:    "failed",
+		FileName:  fileName,
+		ErrorInfo: errorInfo,
+	})
+}
+
+// SubscribeRedis 订阅Redis通知频道，把收到的事件推送给连接在本实例上的用户
+// 订阅在后台协程中运行，ctx取消后退出；连接断开时go-redis会自动重连
+func (h *Hub) SubscribeRedis(ctx context.Context, rdb *redis.Client) {
+	pubsub := rdb.Subscribe(ctx, NotificationChannel)
+
+	go func() {
+		defer pubsub.Close()
+
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+
+				var event Event
+				if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+					log.Printf("解析Redis通知事件失败: %v", err)
+					continue
+				}
+
+				h.NotifyUser(event.UserID, event.Type, event.Data)
+			}
+		}
+	}()
+
+	log.Printf("WebSocket Hub 已订阅Redis通知频道: %s", NotificationChannel)
+}
+
+// 全局Publisher实例
+var GlobalPublisher *Publisher
+
+// InitPublisher 初始化全局Publisher
+func InitPublisher(rdb *redis.Client) {
+	GlobalPublisher = NewPublisher(rdb)
+	log.Println("WebSocket 通知发布器已启动")
+}
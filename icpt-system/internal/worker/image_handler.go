@@ -0,0 +1,330 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"icpt-system/internal/config"
+	"icpt-system/internal/models"
+	"icpt-system/internal/services"
+	"icpt-system/internal/storage"
+	"icpt-system/internal/store"
+	"icpt-system/internal/tasks"
+	"icpt-system/internal/websocket"
+	"icpt-system/pkg/imageprocessor"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// optimizedPath 优化后原图的存储键前缀
+const optimizedPath = "optimized"
+
+// ImageHandler 图像处理任务处理器：按需优化原图，生成缩略图和各尺寸衍生图、更新数据库并推送通知
+type ImageHandler struct {
+	notifier  *websocket.Publisher
+	processor imageprocessor.ImageProcessor
+}
+
+// NewImageHandler 创建图像处理任务处理器，通知通过全局Publisher经Redis转发
+func NewImageHandler(processor imageprocessor.ImageProcessor) *ImageHandler {
+	return &ImageHandler{
+		notifier:  websocket.GlobalPublisher,
+		processor: processor,
+	}
+}
+
+// Handle 处理一个图像任务
+func (h *ImageHandler) Handle(ctx context.Context, task *tasks.Task) error {
+	var image models.Image
+	// 根据 ID 从数据库中查找记录
+	if err := store.DB.WithContext(ctx).First(&image, task.ImageID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 记录已被删除，任务无需处理
+			log.Printf("图片 (ID: %d) 已不存在，跳过任务", task.ImageID)
+			return nil
+		}
+		return fmt.Errorf("查询图片失败: %w", err)
+	}
+
+	// 发送开始处理通知
+	if h.notifier != nil {
+		h.notifier.NotifyImageProcessing(image.UserID, image.ID, image.OriginalFilename)
+	}
+
+	// 提取EXIF元数据：必须在优化原图之前，重新编码后的文件不再含有EXIF
+	// 优化过的图片在之前的尝试中已经提取过，不再从优化后的文件覆盖
+	if image.OptimizedSize == 0 {
+		h.saveMetadata(ctx, &image)
+	}
+
+	// 优化原图：之后的衍生图都从优化后的文件生成
+	if task.HasOperation(tasks.OpOptimize) {
+		if err := h.optimizeOriginal(ctx, &image, task.Optimize); err != nil {
+			store.DB.WithContext(ctx).Model(&image).
+				Update("error_info", fmt.Sprintf("第 %d 次处理失败: %v", task.Attempt+1, err))
+			return err
+		}
+	}
+
+	// 生成衍生图：请求了全部衍生图时按配置生成，否则只生成缩略图
+	specs := services.RenditionSpecs()
+	if !task.HasOperation(tasks.OpRenditions) {
+		spec, _ := services.FindRenditionSpec(services.ThumbnailRendition)
+		specs = []config.Rendition{spec}
+	}
+
+	results, err := services.GenerateRenditions(image.StoragePath, image.ID, specs)
+	if err != nil {
+		// 记录本次失败原因，图片保持 "processing" 状态等待重试
+		store.DB.WithContext(ctx).Model(&image).
+			Update("error_info", fmt.Sprintf("第 %d 次处理失败: %v", task.Attempt+1, err))
+		return err
+	}
+
+	thumbPath := ""
+	renditions := make([]models.ImageRendition, len(results))
+	for i, r := range results {
+		if r.Name == services.ThumbnailRendition {
+			thumbPath = r.Path
+		}
+		renditions[i] = models.ImageRendition{
+			ImageID:     image.ID,
+			Name:        r.Name,
+			Width:       r.Width,
+			Height:      r.Height,
+			Format:      r.Format,
+			StoragePath: r.Path,
+			FileSize:    r.FileSize,
+		}
+	}
+
+	// 在一个事务中替换衍生图记录并将状态标记为完成
+	now := time.Now()
+	err = store.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		names := make([]string, len(renditions))
+		for i, r := range renditions {
+			names[i] = r.Name
+		}
+		// 重新生成时替换同名衍生图，配额只计算大小的变化
+		var replacedSize, newSize int64
+		if err := tx.Model(&models.ImageRendition{}).
+			Where("image_id = ? AND name IN ?", image.ID, names).
+			Select("COALESCE(SUM(file_size), 0)").Scan(&replacedSize).Error; err != nil {
+			return err
+		}
+		for _, r := range renditions {
+			newSize += r.FileSize
+		}
+		if err := tx.Where("image_id = ? AND name IN ?", image.ID, names).
+			Delete(&models.ImageRendition{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&renditions).Error; err != nil {
+			return err
+		}
+		if err := services.AdjustUsage(tx, image.UserID, newSize-replacedSize, 0); err != nil {
+			return err
+		}
+		return tx.Model(&image).Updates(map[string]interface{}{
+			"thumbnail_path": thumbPath,
+			"status":         "completed",
+			"error_info":     "",   // 清空错误信息（包括之前重试留下的）
+			"processed_at":   &now, // 设置处理完成时间
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("更新图片状态失败: %w", err)
+	}
+
+	log.Printf("✅ 成功处理图片 (ID: %d), 生成 %d 个衍生图, 缩略图路径: %s", image.ID, len(renditions), thumbPath)
+
+	// 发送完成通知
+	if h.notifier != nil {
+		h.notifier.NotifyImageCompleted(image.UserID, image.ID, image.OriginalFilename, thumbnailURL(ctx, thumbPath))
+	}
+	return nil
+}
+
+// saveMetadata 提取并保存图片的EXIF元数据，失败时只记录日志，不影响图片处理
+func (h *ImageHandler) saveMetadata(ctx context.Context, image *models.Image) {
+	meta, err := services.ExtractMetadata(image.StoragePath)
+	if err != nil {
+		log.Printf("提取图片 (ID: %d) 元数据失败: %v", image.ID, err)
+		return
+	}
+
+	record := models.ImageMetadata{
+		ImageID:     image.ID,
+		CameraMake:  meta.CameraMake,
+		CameraModel: meta.CameraModel,
+		LensModel:   meta.LensModel,
+		TakenAt:     meta.TakenAt,
+		Width:       meta.Width,
+		Height:      meta.Height,
+		Orientation: meta.Orientation,
+	}
+	if config.Cfg.Privacy.StoreGPS {
+		record.Latitude = meta.Latitude
+		record.Longitude = meta.Longitude
+	}
+
+	// 重复处理同一图片时覆盖旧记录
+	if err := store.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "image_id"}},
+		UpdateAll: true,
+	}).Create(&record).Error; err != nil {
+		log.Printf("保存图片 (ID: %d) 元数据失败: %v", image.ID, err)
+	}
+}
+
+// optimizeOriginal 按压缩预设缩小并重新编码原图，用优化后的文件替换原图
+// 重试时如果已经优化过则直接跳过；优化后文件反而更大时保留原文件
+func (h *ImageHandler) optimizeOriginal(ctx context.Context, image *models.Image, opts *tasks.OptimizeOptions) error {
+	if image.OptimizedSize > 0 {
+		return nil
+	}
+
+	var options tasks.OptimizeOptions
+	if opts != nil {
+		options = *opts
+	}
+	cfg, ok := imageprocessor.PresetConfig(options.Preset)
+	if !ok {
+		return Permanent(fmt.Errorf("未知的压缩预设: %s", options.Preset))
+	}
+
+	// GIF重新编码会丢失动画，不做优化
+	ext := strings.ToLower(filepath.Ext(image.StoragePath))
+	if ext == ".gif" {
+		return nil
+	}
+	if ext != ".png" {
+		ext = ".jpg"
+	}
+
+	originalSize := image.OriginalSize
+	if originalSize == 0 {
+		info, err := storage.Backend.Stat(ctx, image.StoragePath)
+		if err != nil {
+			return fmt.Errorf("无法读取原图: %w", err)
+		}
+		originalSize = info.Size
+	}
+
+	// 图像处理器按文件路径工作：S3等远程存储先下载到临时文件，结果也先写到临时文件
+	inputPath, cleanup, err := storage.LocalFile(ctx, storage.Backend, image.StoragePath)
+	if err != nil {
+		return fmt.Errorf("无法读取原图: %w", err)
+	}
+	defer cleanup()
+
+	tmp, err := os.CreateTemp("", fmt.Sprintf("optimized-%d-*%s", image.ID, ext))
+	if err != nil {
+		return fmt.Errorf("无法创建临时文件: %w", err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := h.processor.CompressImage(inputPath, tmp.Name(), cfg); err != nil {
+		return fmt.Errorf("优化原图失败: %w", err)
+	}
+	info, err := os.Stat(tmp.Name())
+	if err != nil {
+		return fmt.Errorf("优化原图失败: %w", err)
+	}
+
+	// 没有收益时丢弃优化结果，记录大小避免重试时重复优化
+	if info.Size() >= originalSize {
+		log.Printf("图片 (ID: %d) 优化后没有变小 (%d -> %d bytes)，保留原文件", image.ID, originalSize, info.Size())
+		return store.DB.WithContext(ctx).Model(image).Updates(map[string]interface{}{
+			"original_size":  originalSize,
+			"optimized_size": originalSize,
+		}).Error
+	}
+
+	outputPath := path.Join(optimizedPath, fmt.Sprintf("%d%s", image.ID, ext))
+	if err := storage.PutFile(ctx, storage.Backend, outputPath, tmp.Name(), mime.TypeByExtension(ext)); err != nil {
+		return fmt.Errorf("保存优化后的原图失败: %w", err)
+	}
+
+	sourcePath := image.StoragePath
+	rawPath := ""
+	if options.KeepOriginal {
+		rawPath = sourcePath
+	}
+	// 配额按替换后的原图（以及保留的未压缩原图）重新计算
+	usageDelta := info.Size() - image.FileSize
+	if options.KeepOriginal {
+		usageDelta += originalSize
+	}
+	err = store.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(image).Updates(map[string]interface{}{
+			"storage_path":      outputPath,
+			"file_size":         info.Size(),
+			"original_size":     originalSize,
+			"optimized_size":    info.Size(),
+			"raw_original_path": rawPath,
+		}).Error; err != nil {
+			return err
+		}
+		return services.AdjustUsage(tx, image.UserID, usageDelta, 0)
+	})
+	if err != nil {
+		storage.Backend.Delete(ctx, outputPath)
+		return fmt.Errorf("更新图片记录失败: %w", err)
+	}
+	image.StoragePath = outputPath
+	image.RawOriginalPath = rawPath
+
+	// 数据库已指向优化后的文件，再删除原文件（其他图片共享同一原图时只释放引用）
+	if !options.KeepOriginal {
+		if err := services.RemoveImageFile(image.ContentHash, sourcePath); err != nil {
+			log.Printf("删除原图 %s 失败: %v", sourcePath, err)
+		}
+	}
+
+	log.Printf("🗜️ 图片 (ID: %d) 原图已优化: %d -> %d bytes (预设: %s)", image.ID, originalSize, info.Size(), options.Preset)
+	return nil
+}
+
+// Failed 重试用尽后将图片标记为失败并通知用户
+func (h *ImageHandler) Failed(ctx context.Context, task *tasks.Task, cause error) {
+	var image models.Image
+	if err := store.DB.WithContext(ctx).First(&image, task.ImageID).Error; err != nil {
+		log.Printf("错误: 无法在数据库中找到 ID 为 %d 的图片: %v", task.ImageID, err)
+		return
+	}
+
+	now := time.Now()
+	if err := store.DB.WithContext(ctx).Model(&image).Updates(models.Image{
+		Status:      "failed",
+		ErrorInfo:   cause.Error(),
+		ProcessedAt: &now, // 设置处理完成时间
+	}).Error; err != nil {
+		log.Printf("错误: 更新图片 (ID: %d) 状态失败: %v", image.ID, err)
+	}
+
+	// 发送失败通知
+	if h.notifier != nil {
+		h.notifier.NotifyImageFailed(image.UserID, image.ID, image.OriginalFilename, cause.Error())
+	}
+}
+
+// thumbnailURL 返回缩略图的签名访问URL
+func thumbnailURL(ctx context.Context, thumbPath string) string {
+	url, err := storage.Backend.SignedURL(ctx, thumbPath, storage.URLExpiry())
+	if err != nil {
+		log.Printf("生成缩略图 %s 的访问URL失败: %v", thumbPath, err)
+		return ""
+	}
+	return url
+}
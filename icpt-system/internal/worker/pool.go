@@ -0,0 +1,391 @@
+// Package worker 提供并发的后台任务处理池
+// Pool 从可靠队列中取出任务，按任务类型交给注册的 Handler 处理，并统一负责确认、重试和死信
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"icpt-system/internal/config"
+	"icpt-system/internal/queue"
+	"icpt-system/internal/tasks"
+	"icpt-system/pkg/imageprocessor"
+)
+
+const (
+	// 每次等待任务的最长时间，超时后重新检查停止信号
+	dequeueTimeout = 2 * time.Second
+
+	// 统计信息打印和上报间隔
+	statsInterval = 30 * time.Second
+)
+
+// Handler 任务处理器
+type Handler interface {
+	// Handle 处理一个任务。返回nil表示处理完成；返回错误时由Pool按重试策略延迟重试，
+	// 用Permanent包装的错误不再重试
+	Handle(ctx context.Context, task *tasks.Task) error
+
+	// Failed 在任务最终失败（重试用尽或永久错误）、即将移入死信队列时调用
+	Failed(ctx context.Context, task *tasks.Task, err error)
+}
+
+// permanentError 不应重试的错误
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent 将错误标记为永久错误，任务会直接移入死信队列而不再重试
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Pool 并发任务处理池
+type Pool struct {
+	queue       *queue.Queue
+	handlers    map[tasks.Type]Handler
+	retryPolicy queue.RetryPolicy
+	workerCount int
+	hostname    string
+	ctx         context.Context // 取任务使用的上下文，Stop时取消
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+	startedAt   time.Time
+	stats       Stats
+	processor   imageprocessor.ProcessorStats
+	statsMu     sync.RWMutex
+}
+
+// Stats 处理池统计信息
+type Stats struct {
+	TotalProcessed   int64         `json:"total_processed"`    // 总处理数
+	SuccessCount     int64         `json:"success_count"`      // 成功数
+	RetryCount       int64         `json:"retry_count"`        // 重试数
+	FailureCount     int64         `json:"failure_count"`      // 最终失败（进入死信队列）数
+	AverageLatency   time.Duration `json:"average_latency"`    // 平均处理耗时
+	CurrentQueueSize int64         `json:"current_queue_size"` // 当前队列大小
+	WorkerCount      int           `json:"worker_count"`       // 并发数
+}
+
+// NewPool 创建任务处理池，并发数取自 config.Performance.WorkerCount
+// 启动前需通过 Register 为要处理的任务类型注册 Handler
+func NewPool(q *queue.Queue) *Pool {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	workerCount := config.Cfg.Performance.WorkerCount
+	if workerCount <= 0 {
+		workerCount = runtime.NumCPU() // 默认使用CPU核心数
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "worker"
+	}
+
+	return &Pool{
+		queue:       q,
+		handlers:    make(map[tasks.Type]Handler),
+		retryPolicy: queue.RetryPolicyFromConfig(),
+		workerCount: workerCount,
+		hostname:    hostname,
+		ctx:         ctx,
+		cancel:      cancel,
+		stats:       Stats{WorkerCount: workerCount},
+	}
+}
+
+// Register 为任务类型注册处理器，必须在 Start 之前调用
+func (p *Pool) Register(taskType tasks.Type, handler Handler) {
+	p.handlers[taskType] = handler
+}
+
+// consumerName 返回第i个协程的消费者名称
+// 名称在重启后保持不变，这样才能接管自己上次崩溃前未确认的任务
+func (p *Pool) consumerName(i int) string {
+	return fmt.Sprintf("%s-%d", p.hostname, i)
+}
+
+// Start 启动处理池
+func (p *Pool) Start() {
+	log.Printf("🚀 启动Worker池，并发数: %d", p.workerCount)
+	p.startedAt = time.Now()
+
+	for i := 0; i < p.workerCount; i++ {
+		consumer := p.consumerName(i)
+		if n, err := p.queue.Recover(p.ctx, consumer, redeliverer{p}); err != nil {
+			log.Printf("错误: 恢复消费者 %s 的未确认任务失败: %v", consumer, err)
+		} else if n > 0 {
+			log.Printf("♻️ 已接管消费者 %s 上次未确认的 %d 个任务（重新投递或移入死信队列）", consumer, n)
+		}
+
+		p.wg.Add(1)
+		go p.workerRoutine(i, consumer)
+	}
+
+	// 回收过期租约、转移到期的重试任务
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.queue.RunReaper(p.ctx, queue.ReapInterval(), redeliverer{p})
+	}()
+
+	// 启动统计协程，并立即上报一次状态
+	p.publishStatus()
+	p.wg.Add(1)
+	go p.statsRoutine()
+
+	log.Println("✅ Worker池启动成功")
+}
+
+// Stop 停止取新任务，并等待正在处理的任务全部完成
+func (p *Pool) Stop() {
+	log.Println("🛑 停止Worker池，等待进行中的任务完成...")
+	p.cancel()
+	p.wg.Wait()
+	p.printStats()
+	p.removeStatus()
+	log.Println("✅ Worker池已停止")
+}
+
+// workerRoutine 工作协程
+func (p *Pool) workerRoutine(workerID int, consumer string) {
+	defer p.wg.Done()
+
+	log.Printf("Worker-%d 启动 (消费者: %s)", workerID, consumer)
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			log.Printf("Worker-%d 收到停止信号", workerID)
+			return
+		default:
+		}
+
+		// 若取消恰好发生在出队脚本返回途中，任务已登记租约，租约到期后由回收协程重新投递
+		delivery, err := p.queue.Dequeue(p.ctx, consumer, dequeueTimeout)
+		if err != nil {
+			if p.ctx.Err() == nil {
+				log.Printf("Worker-%d 获取任务失败: %v. 5秒后重试...", workerID, err)
+				time.Sleep(5 * time.Second)
+			}
+			continue
+		}
+		if delivery == nil {
+			continue // 等待超时，继续等待
+		}
+
+		// 已取出的任务使用独立的上下文处理，停止时不会被中断
+		p.process(context.Background(), workerID, delivery)
+	}
+}
+
+// process 处理一个任务，并根据结果确认、延迟重试或移入死信队列
+// 队列操作本身失败时任务保持未确认状态，租约到期后会被重新投递
+func (p *Pool) process(ctx context.Context, workerID int, delivery *queue.Delivery) {
+	startTime := time.Now()
+
+	task, err := tasks.Decode(delivery.Payload)
+	if err != nil {
+		log.Printf("Worker-%d 无效的任务内容 %q: %v", workerID, delivery.Payload, err)
+		p.deadLetter(ctx, delivery, delivery.Payload, err)
+		p.updateStats(outcomeFailure, time.Since(startTime))
+		return
+	}
+
+	handler, ok := p.handlers[task.Type]
+	if !ok {
+		log.Printf("Worker-%d 没有处理器的任务类型: %s (trace=%s)", workerID, task.Type, task.TraceID)
+		p.deadLetter(ctx, delivery, delivery.Payload, fmt.Errorf("不支持的任务类型: %s", task.Type))
+		p.updateStats(outcomeFailure, time.Since(startTime))
+		return
+	}
+
+	log.Printf("Worker-%d 开始处理任务: 类型=%s, 图片 ID=%d, trace=%s (第 %d 次尝试)",
+		workerID, task.Type, task.ImageID, task.TraceID, task.Attempt+1)
+
+	// 处理期间持续续期租约，耗时超过租约时长的任务不会被回收后重复处理
+	stopKeepAlive := p.queue.KeepAlive(delivery)
+	err = handler.Handle(ctx, task)
+	stopKeepAlive()
+	latency := time.Since(startTime)
+
+	if err == nil {
+		if err := p.queue.Ack(ctx, delivery); err != nil {
+			log.Printf("Worker-%d 确认任务失败: %v", workerID, err)
+		}
+		p.updateStats(outcomeSuccess, latency)
+		log.Printf("Worker-%d 任务处理成功，耗时: %v", workerID, latency)
+		return
+	}
+
+	task.Attempt++
+	var permanent *permanentError
+	if !errors.As(err, &permanent) && !p.retryPolicy.Exhausted(task.Attempt) {
+		// 还有重试机会：放入延迟队列，指数退避后重新处理
+		delay := p.retryPolicy.Backoff(task.Attempt)
+		payload, encodeErr := tasks.Encode(task)
+		if encodeErr == nil {
+			encodeErr = p.queue.Retry(ctx, delivery, payload, delay)
+		}
+		if encodeErr != nil {
+			log.Printf("Worker-%d 任务加入重试队列失败: %v", workerID, encodeErr)
+			return
+		}
+		p.updateStats(outcomeRetry, latency)
+		log.Printf("Worker-%d 任务第 %d 次失败: %v，🔁 将在 %v 后重试", workerID, task.Attempt, err, delay)
+		return
+	}
+
+	// 永久错误或重试次数用尽
+	log.Printf("Worker-%d ❌ 任务最终失败 (共尝试 %d 次): %v", workerID, task.Attempt, err)
+	handler.Failed(ctx, task, err)
+
+	payload, encodeErr := tasks.Encode(task)
+	if encodeErr != nil {
+		payload = delivery.Payload
+	}
+	p.deadLetter(ctx, delivery, payload, err)
+	p.updateStats(outcomeFailure, latency)
+}
+
+// deadLetter 将任务移入死信队列，等待管理员检查
+func (p *Pool) deadLetter(ctx context.Context, delivery *queue.Delivery, payload string, reason error) {
+	entry, err := p.queue.DeadLetter(ctx, delivery, payload, reason.Error())
+	if err != nil {
+		log.Printf("错误: 任务 %s 移入死信队列失败: %v", delivery.Payload, err)
+		return
+	}
+	log.Printf("☠️ 任务已移入死信队列: ID=%s, 原因: %v", entry.ID, reason)
+}
+
+// redeliverer 处理租约过期或上次崩溃时未确认的任务
+// 这类任务视为失败一次并计入重试次数，否则反复使Worker崩溃的任务会被无限重新投递
+type redeliverer struct {
+	p *Pool
+}
+
+// Redeliver 增加任务的尝试次数，重试次数用尽时移入死信队列
+func (r redeliverer) Redeliver(payload string) (string, bool, string) {
+	task, err := tasks.Decode(payload)
+	if err != nil {
+		return payload, true, err.Error()
+	}
+
+	task.Attempt++
+	next, err := tasks.Encode(task)
+	if err != nil {
+		return payload, false, ""
+	}
+	if r.p.retryPolicy.Exhausted(task.Attempt) {
+		return next, true, fmt.Sprintf("处理超时或Worker崩溃，已尝试 %d 次", task.Attempt)
+	}
+	return next, false, ""
+}
+
+// DeadLettered 通知任务的处理器任务已最终失败
+func (r redeliverer) DeadLettered(entry *queue.DeadLetter) {
+	r.p.statsMu.Lock()
+	r.p.stats.FailureCount++
+	r.p.statsMu.Unlock()
+
+	task, err := tasks.Decode(entry.Payload)
+	if err != nil {
+		return
+	}
+	if handler, ok := r.p.handlers[task.Type]; ok {
+		handler.Failed(context.Background(), task, errors.New(entry.Error))
+	}
+}
+
+// taskOutcome 单个任务的处理结果
+type taskOutcome int
+
+const (
+	outcomeSuccess taskOutcome = iota
+	outcomeRetry
+	outcomeFailure
+)
+
+// updateStats 更新统计信息
+func (p *Pool) updateStats(outcome taskOutcome, latency time.Duration) {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+
+	p.stats.TotalProcessed++
+	switch outcome {
+	case outcomeSuccess:
+		p.stats.SuccessCount++
+	case outcomeRetry:
+		p.stats.RetryCount++
+	case outcomeFailure:
+		p.stats.FailureCount++
+	}
+
+	// 计算平均延迟
+	if p.stats.TotalProcessed == 1 {
+		p.stats.AverageLatency = latency
+	} else {
+		totalLatency := time.Duration(p.stats.TotalProcessed-1)*p.stats.AverageLatency + latency
+		p.stats.AverageLatency = totalLatency / time.Duration(p.stats.TotalProcessed)
+	}
+}
+
+// statsRoutine 统计协程
+func (p *Pool) statsRoutine() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			p.printStats()
+			p.publishStatus()
+		}
+	}
+}
+
+// printStats 打印统计信息
+func (p *Pool) printStats() {
+	stats := p.GetStats()
+
+	successRate := float64(0)
+	if stats.TotalProcessed > 0 {
+		successRate = float64(stats.SuccessCount) / float64(stats.TotalProcessed) * 100
+	}
+
+	log.Printf("📊 Worker统计信息:")
+	log.Printf("  总处理数: %d", stats.TotalProcessed)
+	log.Printf("  成功数: %d", stats.SuccessCount)
+	log.Printf("  重试数: %d", stats.RetryCount)
+	log.Printf("  失败数: %d", stats.FailureCount)
+	log.Printf("  成功率: %.1f%%", successRate)
+	log.Printf("  平均延迟: %v", stats.AverageLatency)
+	log.Printf("  当前队列: %d", stats.CurrentQueueSize)
+	log.Printf("  Worker数: %d", stats.WorkerCount)
+}
+
+// GetStats 获取统计信息
+func (p *Pool) GetStats() Stats {
+	p.statsMu.RLock()
+	statsCopy := p.stats
+	p.statsMu.RUnlock()
+
+	// 获取当前队列大小（停止后上下文已取消，使用独立上下文）
+	queueSize, _ := p.queue.Len(context.Background())
+	statsCopy.CurrentQueueSize = queueSize
+
+	return statsCopy
+}
@@ -0,0 +1,91 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"icpt-system/internal/store"
+	"icpt-system/pkg/imageprocessor"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// StatusKey 保存各Worker进程状态的Redis哈希，字段为主机名
+// Worker与API服务器是不同的进程，API服务器通过它查询Worker的运行情况
+const StatusKey = "icpt:worker_status"
+
+// statusStaleAfter 超过该时间未更新的Worker视为离线
+const statusStaleAfter = 3 * statsInterval
+
+// Status 一个Worker进程的运行状态
+type Status struct {
+	Hostname  string                        `json:"hostname"`
+	Processor imageprocessor.ProcessorStats `json:"processor"`
+	Pool      Stats                         `json:"pool"`
+	StartedAt time.Time                     `json:"started_at"`
+	UpdatedAt time.Time                     `json:"updated_at"`
+	Online    bool                          `json:"online"`
+}
+
+// SetProcessor 记录Worker使用的图像处理器，随状态一起上报
+func (p *Pool) SetProcessor(stats imageprocessor.ProcessorStats) {
+	p.statsMu.Lock()
+	p.processor = stats
+	p.statsMu.Unlock()
+}
+
+// publishStatus 将当前状态写入Redis
+func (p *Pool) publishStatus() {
+	p.statsMu.RLock()
+	processor := p.processor
+	p.statsMu.RUnlock()
+
+	status := Status{
+		Hostname:  p.hostname,
+		Processor: processor,
+		Pool:      p.GetStats(),
+		StartedAt: p.startedAt,
+		UpdatedAt: time.Now(),
+	}
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		return
+	}
+	if err := store.Rdb.HSet(context.Background(), StatusKey, p.hostname, data).Err(); err != nil {
+		log.Printf("上报Worker状态失败: %v", err)
+	}
+}
+
+// removeStatus 进程退出时删除自己的状态
+func (p *Pool) removeStatus() {
+	if err := store.Rdb.HDel(context.Background(), StatusKey, p.hostname).Err(); err != nil {
+		log.Printf("删除Worker状态失败: %v", err)
+	}
+}
+
+// ListStatuses 查询全部Worker上报的状态，按主机名排序
+func ListStatuses(ctx context.Context, rdb *redis.Client) ([]Status, error) {
+	entries, err := rdb.HGetAll(ctx, StatusKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(entries))
+	for _, data := range entries {
+		var status Status
+		if err := json.Unmarshal([]byte(data), &status); err != nil {
+			continue
+		}
+		status.Online = time.Since(status.UpdatedAt) < statusStaleAfter
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Hostname < statuses[j].Hostname
+	})
+	return statuses, nil
+}
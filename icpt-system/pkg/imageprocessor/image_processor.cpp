@@ -1,3 +1,5 @@
+//go:build opencv && cgo
+
 // image_processor.cpp - 高性能C++图像处理模块
 // 使用OpenCV实现快速图像压缩和缩略图生成
 
@@ -8,6 +10,7 @@
 #include <vector>
 #include <memory>
 #include <cstring>
+#include <algorithm>
 
 extern "C" {
 
@@ -0,0 +1,179 @@
+//go:build opencv && cgo
+
+package imageprocessor
+
+/*
+#cgo CXXFLAGS: -std=c++11 -I/usr/include/opencv4
+#cgo LDFLAGS: -lopencv_core -lopencv_imgproc -lopencv_imgcodecs -lstdc++
+#include <stdlib.h>
+#include "image_processor.h"
+*/
+import "C"
+import (
+	"fmt"
+	"unsafe"
+)
+
+// openCVProcessor 通过CGO调用OpenCV实现的C++库
+type openCVProcessor struct{}
+
+// newOpenCVProcessor 返回OpenCV处理器，库不可用时返回nil
+func newOpenCVProcessor() ImageProcessor {
+	if C.GoString(C.get_version()) == "" {
+		return nil
+	}
+	return openCVProcessor{}
+}
+
+// toCConfig 转换压缩配置
+func toCConfig(config CompressConfig) C.CompressConfig {
+	return C.CompressConfig{
+		quality:       C.int(config.Quality),
+		max_width:     C.int(config.MaxWidth),
+		max_height:    C.int(config.MaxHeight),
+		enable_resize: C.bool(config.EnableResize),
+	}
+}
+
+func (openCVProcessor) Name() string { return BackendOpenCV }
+
+// CompressImage 压缩图像文件
+func (openCVProcessor) CompressImage(inputPath, outputPath string, config CompressConfig) error {
+	cInputPath := C.CString(inputPath)
+	cOutputPath := C.CString(outputPath)
+	defer C.free(unsafe.Pointer(cInputPath))
+	defer C.free(unsafe.Pointer(cOutputPath))
+
+	cConfig := toCConfig(config)
+
+	result := C.compress_image(cInputPath, cOutputPath, &cConfig)
+	if result != 0 {
+		return fmt.Errorf("压缩失败，错误码: %d", int(result))
+	}
+
+	return nil
+}
+
+// GenerateThumbnail 生成缩略图
+func (openCVProcessor) GenerateThumbnail(inputPath, outputPath string, thumbWidth int) error {
+	cInputPath := C.CString(inputPath)
+	cOutputPath := C.CString(outputPath)
+	defer C.free(unsafe.Pointer(cInputPath))
+	defer C.free(unsafe.Pointer(cOutputPath))
+
+	result := C.generate_thumbnail(cInputPath, cOutputPath, C.int(thumbWidth))
+	if result != 0 {
+		return fmt.Errorf("生成缩略图失败，错误码: %d", int(result))
+	}
+
+	return nil
+}
+
+// GetImageInfo 获取图像信息
+func (openCVProcessor) GetImageInfo(inputPath string) (*ImageInfo, error) {
+	cInputPath := C.CString(inputPath)
+	defer C.free(unsafe.Pointer(cInputPath))
+
+	var cInfo C.ImageInfo
+	result := C.get_image_info(cInputPath, &cInfo)
+	if result != 0 {
+		return nil, fmt.Errorf("获取图像信息失败，错误码: %d", int(result))
+	}
+
+	info := &ImageInfo{
+		Width:    int(cInfo.width),
+		Height:   int(cInfo.height),
+		Channels: int(cInfo.channels),
+		DataSize: int(cInfo.data_size),
+		Format:   C.GoString(&cInfo.format[0]),
+	}
+
+	return info, nil
+}
+
+// BatchProcessImages 批量处理图像
+func (openCVProcessor) BatchProcessImages(inputPaths, outputPaths []string, config CompressConfig) (int, error) {
+	if len(inputPaths) != len(outputPaths) {
+		return 0, fmt.Errorf("输入路径和输出路径数量不匹配")
+	}
+
+	count := len(inputPaths)
+	if count == 0 {
+		return 0, nil
+	}
+
+	// 转换为C字符串数组
+	cInputPaths := make([]*C.char, count)
+	cOutputPaths := make([]*C.char, count)
+
+	for i, path := range inputPaths {
+		cInputPaths[i] = C.CString(path)
+	}
+	for i, path := range outputPaths {
+		cOutputPaths[i] = C.CString(path)
+	}
+
+	// 释放内存
+	defer func() {
+		for i := 0; i < count; i++ {
+			C.free(unsafe.Pointer(cInputPaths[i]))
+			C.free(unsafe.Pointer(cOutputPaths[i]))
+		}
+	}()
+
+	cConfig := toCConfig(config)
+
+	result := C.batch_process_images(
+		(**C.char)(unsafe.Pointer(&cInputPaths[0])),
+		(**C.char)(unsafe.Pointer(&cOutputPaths[0])),
+		C.int(count),
+		&cConfig,
+	)
+	if result < 0 {
+		return 0, fmt.Errorf("批量处理失败，错误码: %d", int(result))
+	}
+
+	return int(result), nil
+}
+
+// ProcessImageMemory 在内存中处理图像
+func (openCVProcessor) ProcessImageMemory(inputData []byte, config CompressConfig) ([]byte, error) {
+	if len(inputData) == 0 {
+		return nil, fmt.Errorf("输入数据为空")
+	}
+
+	var outputData *C.uchar
+	var outputSize C.size_t
+
+	cConfig := toCConfig(config)
+
+	result := C.process_image_memory(
+		(*C.uchar)(unsafe.Pointer(&inputData[0])),
+		C.size_t(len(inputData)),
+		&outputData,
+		&outputSize,
+		&cConfig,
+	)
+
+	if result != 0 {
+		return nil, fmt.Errorf("内存中图像处理失败，错误码: %d", int(result))
+	}
+
+	// 转换C内存到Go切片
+	output := C.GoBytes(unsafe.Pointer(outputData), C.int(outputSize))
+
+	// 释放C分配的内存
+	C.free_image_data(outputData)
+
+	return output, nil
+}
+
+// Stats 返回处理器信息
+func (openCVProcessor) Stats() ProcessorStats {
+	return ProcessorStats{
+		Backend:       BackendOpenCV,
+		Version:       C.GoString(C.get_version()),
+		OpenCVVersion: C.GoString(C.get_opencv_version()),
+		Available:     true,
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !opencv || !cgo
+
+package imageprocessor
+
+// newOpenCVProcessor 未启用OpenCV构建，始终返回nil
+func newOpenCVProcessor() ImageProcessor {
+	return nil
+}
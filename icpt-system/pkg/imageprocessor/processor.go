@@ -1,16 +1,18 @@
-// Package imageprocessor 提供高性能C++图像处理功能
-// 通过CGO调用OpenCV实现的C++库
+// Package imageprocessor 提供图像压缩、缩略图生成等处理功能
+// 使用 -tags opencv 构建且启用CGO时，可通过OpenCV实现的C++库处理图像；
+// 否则使用基于 image/* 和 nfnt/resize 的纯Go实现，无需安装OpenCV即可构建
 package imageprocessor
 
-/*
-#cgo CXXFLAGS: -std=c++11 -I/usr/include/opencv4
-#cgo LDFLAGS: -lopencv_core -lopencv_imgproc -lopencv_imgcodecs -lstdc++
-#include "image_processor.h"
-*/
-import "C"
 import (
 	"fmt"
-	"unsafe"
+	"sync"
+)
+
+// 处理器实现名称
+const (
+	BackendAuto   = "auto"   // 优先OpenCV，不可用时使用纯Go实现
+	BackendOpenCV = "opencv" // CGO + OpenCV
+	BackendGo     = "go"     // 纯Go
 )
 
 // ImageInfo 图像信息结构体
@@ -60,163 +62,131 @@ func ThumbnailConfig() CompressConfig {
 	}
 }
 
-// CompressImage 压缩图像文件
-func CompressImage(inputPath, outputPath string, config CompressConfig) error {
-	cInputPath := C.CString(inputPath)
-	cOutputPath := C.CString(outputPath)
-	defer C.free(unsafe.Pointer(cInputPath))
-	defer C.free(unsafe.Pointer(cOutputPath))
-
-	cConfig := C.CompressConfig{
-		quality:       C.int(config.Quality),
-		max_width:     C.int(config.MaxWidth),
-		max_height:    C.int(config.MaxHeight),
-		enable_resize: C.bool(config.EnableResize),
-	}
+// 压缩预设名称
+const (
+	PresetDefault     = "default"      // DefaultCompressConfig
+	PresetHighQuality = "high_quality" // HighQualityConfig
+	PresetThumbnail   = "thumbnail"    // ThumbnailConfig
+)
 
-	result := C.compress_image(cInputPath, cOutputPath, &cConfig)
-	if result != 0 {
-		return fmt.Errorf("压缩失败，错误码: %d", int(result))
+// PresetConfig 按名称返回压缩预设，名称为空时返回默认配置
+func PresetConfig(name string) (CompressConfig, bool) {
+	switch name {
+	case "", PresetDefault:
+		return DefaultCompressConfig(), true
+	case PresetHighQuality:
+		return HighQualityConfig(), true
+	case PresetThumbnail:
+		return ThumbnailConfig(), true
+	default:
+		return CompressConfig{}, false
 	}
-
-	return nil
 }
 
-// GenerateThumbnail 生成缩略图
-func GenerateThumbnail(inputPath, outputPath string, thumbWidth int) error {
-	cInputPath := C.CString(inputPath)
-	cOutputPath := C.CString(outputPath)
-	defer C.free(unsafe.Pointer(cInputPath))
-	defer C.free(unsafe.Pointer(cOutputPath))
-
-	result := C.generate_thumbnail(cInputPath, cOutputPath, C.int(thumbWidth))
-	if result != 0 {
-		return fmt.Errorf("生成缩略图失败，错误码: %d", int(result))
-	}
-
-	return nil
+// ProcessorStats 处理器统计信息
+type ProcessorStats struct {
+	Backend       string `json:"backend"`
+	Version       string `json:"version"`
+	OpenCVVersion string `json:"opencv_version,omitempty"`
+	Available     bool   `json:"available"`
 }
 
-// GetImageInfo 获取图像信息
-func GetImageInfo(inputPath string) (*ImageInfo, error) {
-	cInputPath := C.CString(inputPath)
-	defer C.free(unsafe.Pointer(cInputPath))
+// ImageProcessor 图像处理器
+type ImageProcessor interface {
+	// Name 返回实现名称（BackendOpenCV 或 BackendGo）
+	Name() string
 
-	var cInfo C.ImageInfo
-	result := C.get_image_info(cInputPath, &cInfo)
-	if result != 0 {
-		return nil, fmt.Errorf("获取图像信息失败，错误码: %d", int(result))
-	}
+	// CompressImage 压缩图像文件，输出格式由输出文件扩展名决定
+	CompressImage(inputPath, outputPath string, config CompressConfig) error
 
-	info := &ImageInfo{
-		Width:    int(cInfo.width),
-		Height:   int(cInfo.height),
-		Channels: int(cInfo.channels),
-		DataSize: int(cInfo.data_size),
-		Format:   C.GoString(&cInfo.format[0]),
-	}
+	// GenerateThumbnail 按指定宽度等比生成JPEG缩略图
+	GenerateThumbnail(inputPath, outputPath string, thumbWidth int) error
 
-	return info, nil
-}
+	// GetImageInfo 获取图像信息
+	GetImageInfo(inputPath string) (*ImageInfo, error)
 
-// BatchProcessImages 批量处理图像
-func BatchProcessImages(inputPaths, outputPaths []string, config CompressConfig) (int, error) {
-	if len(inputPaths) != len(outputPaths) {
-		return 0, fmt.Errorf("输入路径和输出路径数量不匹配")
-	}
+	// ProcessImageMemory 在内存中处理图像，输出JPEG数据
+	ProcessImageMemory(inputData []byte, config CompressConfig) ([]byte, error)
 
-	count := len(inputPaths)
-	if count == 0 {
-		return 0, nil
-	}
-
-	// 转换为C字符串数组
-	cInputPaths := make([]*C.char, count)
-	cOutputPaths := make([]*C.char, count)
+	// BatchProcessImages 批量压缩图像，返回成功处理的数量
+	BatchProcessImages(inputPaths, outputPaths []string, config CompressConfig) (int, error)
 
-	for i, path := range inputPaths {
-		cInputPaths[i] = C.CString(path)
-	}
-	for i, path := range outputPaths {
-		cOutputPaths[i] = C.CString(path)
-	}
+	// Stats 返回处理器信息
+	Stats() ProcessorStats
+}
 
-	// 释放内存
-	defer func() {
-		for i := 0; i < count; i++ {
-			C.free(unsafe.Pointer(cInputPaths[i]))
-			C.free(unsafe.Pointer(cOutputPaths[i]))
+// New 按名称创建图像处理器
+// backend 为空或 auto 时优先使用OpenCV，未编译OpenCV支持或库不可用时使用纯Go实现
+func New(backend string) (ImageProcessor, error) {
+	switch backend {
+	case "", BackendAuto:
+		if p := newOpenCVProcessor(); p != nil {
+			return p, nil
 		}
-	}()
-
-	cConfig := C.CompressConfig{
-		quality:       C.int(config.Quality),
-		max_width:     C.int(config.MaxWidth),
-		max_height:    C.int(config.MaxHeight),
-		enable_resize: C.bool(config.EnableResize),
+		return goProcessor{}, nil
+	case BackendOpenCV:
+		if p := newOpenCVProcessor(); p != nil {
+			return p, nil
+		}
+		return nil, fmt.Errorf("OpenCV处理器不可用，请使用 -tags opencv 构建并安装OpenCV")
+	case BackendGo:
+		return goProcessor{}, nil
+	default:
+		return nil, fmt.Errorf("未知的图像处理器: %s", backend)
 	}
-
-	result := C.batch_process_images(
-		(**C.char)(unsafe.Pointer(&cInputPaths[0])),
-		(**C.char)(unsafe.Pointer(&cOutputPaths[0])),
-		C.int(count),
-		&cConfig,
-	)
-
-	return int(result), nil
 }
 
-// ProcessImageMemory 在内存中处理图像
-func ProcessImageMemory(inputData []byte, config CompressConfig) ([]byte, error) {
-	if len(inputData) == 0 {
-		return nil, fmt.Errorf("输入数据为空")
-	}
-
-	var outputData *C.uchar
-	var outputSize C.size_t
+var (
+	defaultProcessor     ImageProcessor
+	defaultProcessorOnce sync.Once
+)
 
-	cConfig := C.CompressConfig{
-		quality:       C.int(config.Quality),
-		max_width:     C.int(config.MaxWidth),
-		max_height:    C.int(config.MaxHeight),
-		enable_resize: C.bool(config.EnableResize),
-	}
+// Default 返回自动选择的默认处理器，供包级函数使用
+func Default() ImageProcessor {
+	defaultProcessorOnce.Do(func() {
+		defaultProcessor, _ = New(BackendAuto)
+	})
+	return defaultProcessor
+}
 
-	result := C.process_image_memory(
-		(*C.uchar)(unsafe.Pointer(&inputData[0])),
-		C.size_t(len(inputData)),
-		&outputData,
-		&outputSize,
-		&cConfig,
-	)
+// CompressImage 使用默认处理器压缩图像文件
+func CompressImage(inputPath, outputPath string, config CompressConfig) error {
+	return Default().CompressImage(inputPath, outputPath, config)
+}
 
-	if result != 0 {
-		return nil, fmt.Errorf("内存中图像处理失败，错误码: %d", int(result))
-	}
+// GenerateThumbnail 使用默认处理器生成缩略图
+func GenerateThumbnail(inputPath, outputPath string, thumbWidth int) error {
+	return Default().GenerateThumbnail(inputPath, outputPath, thumbWidth)
+}
 
-	// 转换C内存到Go切片
-	output := C.GoBytes(unsafe.Pointer(outputData), C.int(outputSize))
+// GetImageInfo 使用默认处理器获取图像信息
+func GetImageInfo(inputPath string) (*ImageInfo, error) {
+	return Default().GetImageInfo(inputPath)
+}
 
-	// 释放C分配的内存
-	C.free_image_data(outputData)
+// BatchProcessImages 使用默认处理器批量处理图像
+func BatchProcessImages(inputPaths, outputPaths []string, config CompressConfig) (int, error) {
+	return Default().BatchProcessImages(inputPaths, outputPaths, config)
+}
 
-	return output, nil
+// ProcessImageMemory 使用默认处理器在内存中处理图像
+func ProcessImageMemory(inputData []byte, config CompressConfig) ([]byte, error) {
+	return Default().ProcessImageMemory(inputData, config)
 }
 
-// GetVersion 获取库版本信息
+// GetVersion 获取默认处理器的版本信息
 func GetVersion() string {
-	return C.GoString(C.get_version())
+	return Default().Stats().Version
 }
 
-// GetOpenCVVersion 获取OpenCV版本信息
+// GetOpenCVVersion 获取OpenCV版本信息，未使用OpenCV时为空
 func GetOpenCVVersion() string {
-	return C.GoString(C.get_opencv_version())
+	return Default().Stats().OpenCVVersion
 }
 
-// IsAvailable 检查C++库是否可用
+// IsAvailable 检查OpenCV实现是否可用
 func IsAvailable() bool {
-	version := GetVersion()
-	return version != ""
+	return newOpenCVProcessor() != nil
 }
 
 // CompressImageWithQuality 使用指定质量压缩图像（快捷方法）
@@ -231,20 +201,9 @@ func GenerateThumbnailWithConfig(inputPath, outputPath string, config CompressCo
 	return CompressImage(inputPath, outputPath, config)
 }
 
-// ProcessorStats 处理器统计信息
-type ProcessorStats struct {
-	Version       string `json:"version"`
-	OpenCVVersion string `json:"opencv_version"`
-	Available     bool   `json:"available"`
-}
-
-// GetStats 获取处理器统计信息
+// GetStats 获取默认处理器的统计信息
 func GetStats() ProcessorStats {
-	return ProcessorStats{
-		Version:       GetVersion(),
-		OpenCVVersion: GetOpenCVVersion(),
-		Available:     IsAvailable(),
-	}
+	return Default().Stats()
 }
 
 // ValidateConfig 验证压缩配置
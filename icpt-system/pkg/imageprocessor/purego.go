@@ -0,0 +1,225 @@
+package imageprocessor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	_ "image/gif" // 注册GIF解码器
+
+	"github.com/nfnt/resize"
+)
+
+// goVersion 纯Go实现的版本信息
+const goVersion = "ICPT Go Image Processor v1.0.0"
+
+// goProcessor 基于 image/* 和 nfnt/resize 的纯Go实现
+// 行为与OpenCV实现保持一致：不放大图像，按EXIF方向标记旋转，缩略图固定输出质量95的JPEG；
+// 区别是缩略图不做锐化处理
+type goProcessor struct{}
+
+func (goProcessor) Name() string { return BackendGo }
+
+// CompressImage 压缩图像文件
+func (goProcessor) CompressImage(inputPath, outputPath string, config CompressConfig) error {
+	img, err := decodeFile(inputPath)
+	if err != nil {
+		return err
+	}
+
+	img = fitWithin(img, config)
+	return encodeFile(outputPath, img, config.Quality)
+}
+
+// GenerateThumbnail 生成缩略图
+func (goProcessor) GenerateThumbnail(inputPath, outputPath string, thumbWidth int) error {
+	if thumbWidth <= 0 {
+		return fmt.Errorf("缩略图宽度必须大于0")
+	}
+
+	img, err := decodeFile(inputPath)
+	if err != nil {
+		return err
+	}
+
+	thumbnail := resize.Resize(uint(thumbWidth), 0, img, resize.Lanczos3)
+	return encodeFile(outputPath, thumbnail, 95)
+}
+
+// GetImageInfo 获取图像信息，只解析文件头，不解码完整图像
+func (goProcessor) GetImageInfo(inputPath string) (*ImageInfo, error) {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("获取图像信息失败: %w", err)
+	}
+	defer file.Close()
+
+	cfg, format, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, fmt.Errorf("获取图像信息失败: %w", err)
+	}
+
+	channels, bytesPerChannel := colorModelLayout(cfg.ColorModel)
+	return &ImageInfo{
+		Width:    cfg.Width,
+		Height:   cfg.Height,
+		Channels: channels,
+		DataSize: cfg.Width * cfg.Height * channels * bytesPerChannel,
+		Format:   format,
+	}, nil
+}
+
+// BatchProcessImages 并发压缩一批图像，单张失败不影响其他图像
+func (p goProcessor) BatchProcessImages(inputPaths, outputPaths []string, config CompressConfig) (int, error) {
+	if len(inputPaths) != len(outputPaths) {
+		return 0, fmt.Errorf("输入路径和输出路径数量不匹配")
+	}
+
+	var (
+		wg           sync.WaitGroup
+		mu           sync.Mutex
+		successCount int
+	)
+	sem := make(chan struct{}, runtime.NumCPU())
+
+	for i := range inputPaths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := p.CompressImage(inputPaths[i], outputPaths[i], config); err == nil {
+				mu.Lock()
+				successCount++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	return successCount, nil
+}
+
+// ProcessImageMemory 在内存中处理图像
+func (goProcessor) ProcessImageMemory(inputData []byte, config CompressConfig) ([]byte, error) {
+	if len(inputData) == 0 {
+		return nil, fmt.Errorf("输入数据为空")
+	}
+
+	img, err := decodeOriented(bytes.NewReader(inputData))
+	if err != nil {
+		return nil, fmt.Errorf("内存中图像处理失败: %w", err)
+	}
+
+	img = fitWithin(img, config)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: clampQuality(config.Quality)}); err != nil {
+		return nil, fmt.Errorf("内存中图像处理失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Stats 返回处理器信息
+func (goProcessor) Stats() ProcessorStats {
+	return ProcessorStats{
+		Backend:   BackendGo,
+		Version:   goVersion,
+		Available: true,
+	}
+}
+
+// decodeFile 打开并解码图像文件
+func decodeFile(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("无法打开图像文件: %w", err)
+	}
+	defer file.Close()
+
+	img, err := decodeOriented(file)
+	if err != nil {
+		return nil, fmt.Errorf("无法解码图像: %w", err)
+	}
+	return img, nil
+}
+
+// decodeOriented 解码图像，JPEG按EXIF方向标记转正（与OpenCV imread的默认行为一致）
+func decodeOriented(r io.ReadSeeker) (image.Image, error) {
+	img, format, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	if format != "jpeg" {
+		return img, nil
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return img, nil
+	}
+	return ApplyOrientation(img, ReadOrientation(r)), nil
+}
+
+// fitWithin 启用尺寸调整且图像超出最大尺寸时等比缩小
+func fitWithin(img image.Image, config CompressConfig) image.Image {
+	if !config.EnableResize || config.MaxWidth <= 0 || config.MaxHeight <= 0 {
+		return img
+	}
+	return resize.Thumbnail(uint(config.MaxWidth), uint(config.MaxHeight), img, resize.Lanczos3)
+}
+
+// encodeFile 按输出文件扩展名编码并保存图像，PNG以外的格式都保存为JPEG
+func encodeFile(path string, img image.Image, quality int) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("无法创建输出文件: %w", err)
+	}
+
+	if err := encode(out, filepath.Ext(path), img, quality); err != nil {
+		out.Close()
+		os.Remove(path)
+		return fmt.Errorf("保存图像失败: %w", err)
+	}
+	return out.Close()
+}
+
+// encode 按扩展名编码图像
+func encode(w io.Writer, ext string, img image.Image, quality int) error {
+	if strings.EqualFold(ext, ".png") {
+		return png.Encode(w, img)
+	}
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: clampQuality(quality)})
+}
+
+// clampQuality 将JPEG质量限制在1-100之间
+func clampQuality(quality int) int {
+	if quality < 1 || quality > 100 {
+		return DefaultCompressConfig().Quality
+	}
+	return quality
+}
+
+// colorModelLayout 返回颜色模型对应的通道数和每通道字节数
+func colorModelLayout(model color.Model) (int, int) {
+	switch model {
+	case color.GrayModel:
+		return 1, 1
+	case color.Gray16Model:
+		return 1, 2
+	case color.YCbCrModel:
+		return 3, 1
+	case color.RGBA64Model, color.NRGBA64Model:
+		return 4, 2
+	default:
+		return 4, 1
+	}
+}
@@ -3,6 +3,7 @@ import { get, post } from './request'
 // Auth API endpoints
 const AUTH_ENDPOINTS = {
   LOGIN: '/auth/login',
+  VERIFY_2FA: '/auth/2fa/verify',
   REGISTER: '/auth/register',
   PROFILE: '/profile',
   REFRESH: '/auth/refresh',
@@ -23,6 +24,19 @@ export const login = (credentials) => {
   })
 }
 
+/**
+ * Second step of login for accounts with two-factor authentication
+ * @param {string} challengeToken - Challenge token returned by login
+ * @param {string} code - TOTP code or recovery code
+ * @returns {Promise<Object>} Login response with token and user info
+ */
+export const verifyTwoFactor = (challengeToken, code) => {
+  return post(AUTH_ENDPOINTS.VERIFY_2FA, {
+    challenge_token: challengeToken,
+    code,
+  })
+}
+
 /**
  * User registration
  * @param {Object} userData - Registration data
@@ -59,18 +73,23 @@ export const updateUserProfile = (updates) => {
 
 /**
  * Refresh authentication token
+ * The refresh token is rotated: store the returned refresh_token and discard the old one
+ * @param {string} refreshToken - Current refresh token
  * @returns {Promise<Object>} New token data
  */
-export const refreshToken = () => {
-  return post(AUTH_ENDPOINTS.REFRESH)
+export const refreshToken = (refreshToken) => {
+  return post(AUTH_ENDPOINTS.REFRESH, { refresh_token: refreshToken })
 }
 
 /**
- * User logout (if backend supports logout endpoint)
+ * User logout, revokes the access token and the refresh token's session
+ * @param {string} [refreshToken] - Refresh token to revoke
+ * @param {string} [accessToken] - Access token to revoke, sent explicitly since local tokens may already be cleared
  * @returns {Promise<Object>} Logout response
  */
-export const logout = () => {
-  return post(AUTH_ENDPOINTS.LOGOUT)
+export const logout = (refreshToken, accessToken) => {
+  const config = accessToken ? { headers: { Authorization: `Bearer ${accessToken}` } } : {}
+  return post(AUTH_ENDPOINTS.LOGOUT, { refresh_token: refreshToken }, config)
 }
 
 /**
@@ -116,8 +135,11 @@ export const resetPassword = (resetData) => {
  * @param {Object} passwordData - Password change data
  * @param {string} passwordData.currentPassword - Current password
  * @param {string} passwordData.newPassword - New password
- * @returns {Promise<Object>} Password change response
+ * @returns {Promise<Object>} New token pair; sessions on other devices are revoked
  */
 export const changePassword = (passwordData) => {
-  return post('/auth/change-password', passwordData)
+  return post('/auth/change-password', {
+    current_password: passwordData.currentPassword,
+    new_password: passwordData.newPassword,
+  })
 } 
\ No newline at end of file
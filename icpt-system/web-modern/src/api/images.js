@@ -1,4 +1,5 @@
 import { get, post, del, upload } from './request'
+import { getToken } from '@/utils/auth'
 
 // Image API endpoints
 const IMAGE_ENDPOINTS = {
@@ -139,35 +140,41 @@ export const searchImages = (searchParams) => {
 /**
  * Get image download URL
  * @param {number|string} imageId - Image ID
- * @param {string} [size] - Image size (original, thumbnail)
+ * @param {string} [size] - Image size (original, thumbnail, medium, large, mobile)
  * @returns {string} Download URL
  */
 export const getImageUrl = (imageId, size = 'original') => {
-    return `/static/images/${imageId}?size=${size}`
+    // <img> tags cannot send the Authorization header, so pass the token as a query parameter
+    return `/api/v1/images/${imageId}/renditions/${size}?token=${encodeURIComponent(getToken() || '')}`
 }
 
 /**
- * Get image thumbnail URL from a relative path
- * @param {string} thumbnailPath - Thumbnail path from API response (e.g., "thumbnails/thumb-...")
- * @returns {string} Full, usable thumbnail URL
+ * Resolve a file URL from the API response
+ * The backend returns signed, time-limited URLs (absolute, or already rooted at /static)
+ * that work in <img> tags without the Authorization header; bare storage keys are
+ * prefixed with /static/ so the Vite proxy forwards them
+ * @param {string} url - URL or storage key from API response
+ * @returns {string} Usable URL
  */
-export const getThumbnailUrl = (thumbnailPath) => {
-    if (!thumbnailPath) return null
-    // The backend now provides a relative path like "thumbnails/thumb-foo.jpg"
-    // We prepend the '/static/' base to make it a valid URL
-    return `/static/${thumbnailPath}`
+const resolveFileUrl = (url) => {
+    if (!url) return null
+    if (/^https?:\/\//.test(url) || url.startsWith('/')) return url
+    return `/static/${url}`
 }
 
 /**
- * Get original image URL from a relative path
- * @param {string} originalPath - Original image path from API response (e.g., "originals/foo.jpg")
+ * Get image thumbnail URL
+ * @param {string} thumbnailUrl - Signed thumbnail URL from API response
+ * @returns {string} Full, usable thumbnail URL
+ */
+export const getThumbnailUrl = (thumbnailUrl) => resolveFileUrl(thumbnailUrl)
+
+/**
+ * Get original image URL
+ * @param {string} originalUrl - Signed original image URL from API response
  * @returns {string} Full, usable original image URL
  */
-export const getOriginalUrl = (originalPath) => {
-    if (!originalPath) return null
-    // Use relative path for proxy - Vite will proxy /static requests to backend
-    return `/static/${originalPath}`
-}
+export const getOriginalUrl = (originalUrl) => resolveFileUrl(originalUrl)
 
 /**
  * Update image metadata
@@ -1,6 +1,6 @@
 import axios from 'axios'
 import { ElMessage, ElMessageBox } from 'element-plus'
-import { getToken, removeToken } from '@/utils/auth'
+import { getToken, removeToken, getRefreshToken, setToken, setRefreshToken } from '@/utils/auth'
 import router from '@/router'
 import NProgress from 'nprogress'
 
@@ -40,6 +40,29 @@ request.interceptors.request.use(
   }
 )
 
+// Shared refresh request so concurrent 401s only rotate the refresh token once
+let refreshPromise = null
+
+/**
+ * Exchange the stored refresh token for a new access token
+ * @returns {Promise<string>} New access token
+ */
+const refreshAccessToken = () => {
+  if (!refreshPromise) {
+    refreshPromise = axios
+      .post(`${request.defaults.baseURL}/auth/refresh`, { refresh_token: getRefreshToken() })
+      .then(({ data }) => {
+        setToken(data.data.token)
+        setRefreshToken(data.data.refresh_token)
+        return data.data.token
+      })
+      .finally(() => {
+        refreshPromise = null
+      })
+  }
+  return refreshPromise
+}
+
 // Response interceptor
 request.interceptors.response.use(
   (response) => {
@@ -59,11 +82,11 @@ request.interceptors.response.use(
   async (error) => {
     NProgress.done()
     
-    const { response, request, message } = error
+    const { response, request: pendingRequest, message } = error
     
     // Network error
     if (!response) {
-      if (request) {
+      if (pendingRequest) {
         ElMessage.error('网络连接失败，请检查网络设置')
       } else {
         ElMessage.error('请求配置错误')
@@ -72,6 +95,19 @@ request.interceptors.response.use(
     }
     
     const { status, data } = response
+
+    // Access tokens are short-lived: refresh once and replay the request before giving up
+    const { config } = error
+    if (status === 401 && !config._retried && !config.url.startsWith('/auth/') && getRefreshToken()) {
+      config._retried = true
+      try {
+        const token = await refreshAccessToken()
+        config.headers.Authorization = `Bearer ${token}`
+        return request(config)
+      } catch (refreshError) {
+        console.error('Token refresh failed:', refreshError)
+      }
+    }
     
     // Handle different error status codes
     switch (status) {
@@ -114,7 +150,7 @@ request.interceptors.response.use(
         break
         
       case 429:
-        ElMessage.error('请求过于频繁，请稍后再试')
+        ElMessage.error(data?.message || data?.error || '请求过于频繁，请稍后再试')
         break
         
       case 500:
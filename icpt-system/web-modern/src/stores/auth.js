@@ -1,8 +1,8 @@
 import { defineStore } from 'pinia'
 import { ref, computed } from 'vue'
 import { ElMessage } from 'element-plus'
-import { login, register, getUserProfile } from '@/api/auth'
-import { removeToken, setToken, getToken } from '@/utils/auth'
+import { login, register, getUserProfile, logout as logoutRequest, verifyTwoFactor } from '@/api/auth'
+import { removeToken, setToken, getToken, getRefreshToken, setRefreshToken } from '@/utils/auth'
 
 export const useAuthStore = defineStore('auth', () => {
   // State
@@ -33,10 +33,16 @@ export const useAuthStore = defineStore('auth', () => {
       isLoading.value = true
       const response = await login(credentials)
       
+      // Two-factor accounts get a challenge token; the caller asks for the code
+      if (response.data?.two_factor_required) {
+        return Promise.resolve(response)
+      }
+
       if (response.data) {
-        const { token: authToken, user: userInfo } = response.data
+        const { token: authToken, refresh_token: refreshToken, user: userInfo } = response.data
         
         setAuthToken(authToken)
+        setRefreshToken(refreshToken)
         setUserInfo(userInfo)
         
         ElMessage.success('登录成功！')
@@ -54,6 +60,27 @@ export const useAuthStore = defineStore('auth', () => {
     }
   }
 
+  // Second login step for two-factor accounts
+  const verifyTwoFactorLogin = async (challengeToken, code) => {
+    try {
+      isLoading.value = true
+      const response = await verifyTwoFactor(challengeToken, code)
+      const { token: authToken, refresh_token: refreshToken, user: userInfo } = response.data
+
+      setAuthToken(authToken)
+      setRefreshToken(refreshToken)
+      setUserInfo(userInfo)
+
+      ElMessage.success('登录成功！')
+      return Promise.resolve(response)
+    } catch (error) {
+      console.error('Two-factor verify error:', error)
+      return Promise.reject(error)
+    } finally {
+      isLoading.value = false
+    }
+  }
+
   // Register action
   const registerUser = async (userData) => {
     try {
@@ -61,9 +88,10 @@ export const useAuthStore = defineStore('auth', () => {
       const response = await register(userData)
       
       if (response.data) {
-        const { token: authToken, user: userInfo } = response.data
+        const { token: authToken, refresh_token: refreshToken, user: userInfo } = response.data
         
         setAuthToken(authToken)
+        setRefreshToken(refreshToken)
         setUserInfo(userInfo)
         
         ElMessage.success('注册成功！')
@@ -110,6 +138,11 @@ export const useAuthStore = defineStore('auth', () => {
 
   // Logout action
   const logout = () => {
+    // Revoke tokens on the server; local state is cleared even if this fails
+    if (token.value) {
+      logoutRequest(getRefreshToken(), token.value).catch(() => {})
+    }
+
     user.value = null
     token.value = null
     removeToken()
@@ -167,6 +200,7 @@ export const useAuthStore = defineStore('auth', () => {
     login: loginUser,        // 添加别名
     register: registerUser,  // 添加别名
     loginUser,
+    verifyTwoFactorLogin,
     registerUser,
     getUserInfo,
     logout,